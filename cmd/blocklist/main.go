@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// BlocklistRequest is the Lambda payload, which defaults to listing blocked contacts
+type BlocklistRequest struct {
+	Command string `json:"command"`
+	Contact string `json:"contact"`
+	Reason  string `json:"reason"`
+}
+
+func openDB() (*gorm.DB, error) {
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		return gorm.Open("postgres", databaseURL)
+	}
+	return gorm.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s password=%s",
+		os.Getenv("RDS_HOST"),
+		os.Getenv("RDS_PORT"),
+		os.Getenv("RDS_USERNAME"),
+		os.Getenv("RDS_DB_NAME"),
+		os.Getenv("RDS_PASSWORD"),
+	))
+}
+
+func blocklist(request BlocklistRequest) ([]chat.BlockedContact, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	limiter := chat.NewGormRateLimiter(db, chat.NewRateLimitPolicy())
+
+	// Phone numbers are stored in E.164 format, like they're received from providers
+	contact := request.Contact
+	if contact != "" && svc.ChannelForAddress(contact) == svc.SMSChannel {
+		contact = svc.E164(contact)
+	}
+	switch request.Command {
+	case "", "list":
+		return limiter.BlockedContacts()
+	case "block":
+		if contact == "" {
+			return nil, fmt.Errorf("A contact is required to block")
+		}
+		log.Printf("Blocking %s", contact)
+		return nil, limiter.Block(contact, request.Reason)
+	case "unblock":
+		log.Printf("Unblocking %s", contact)
+		return nil, limiter.Unblock(contact)
+	default:
+		return nil, fmt.Errorf("Unknown command %s, expected list, block or unblock", request.Command)
+	}
+}
+
+func main() {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(blocklist)
+		return
+	}
+
+	// Run locally with DATABASE_URL or RDS_* set, like "blocklist block +13125550100 spam"
+	request := BlocklistRequest{}
+	if len(os.Args) > 1 {
+		request.Command = os.Args[1]
+	}
+	if len(os.Args) > 2 {
+		request.Contact = os.Args[2]
+	}
+	if len(os.Args) > 3 {
+		request.Reason = strings.Join(os.Args[3:], " ")
+	}
+	blocked, err := blocklist(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, contact := range blocked {
+		log.Printf("%s %s %s", contact.Contact, contact.CreatedAt.Format("2006-01-02 15:04:05"), contact.Reason)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+const helpText = `Type a message to send it to the chat, or a command:
+  /lang <code>  switch the chat language, like /lang es
+  /state        print the serialized chat state
+  /reset        start a new conversation
+  /help         show this message
+  /quit         exit`
+
+// Repl runs a directory chat conversation in a terminal
+type Repl struct {
+	Contact   string
+	Number    string
+	Resources directory.ResourceStore
+	chat      *directory.DirectoryChat
+	out       io.Writer
+}
+
+// NewRepl is a constructor for Repl structs
+func NewRepl(contact, number, lang string, resources directory.ResourceStore, out io.Writer) *Repl {
+	repl := &Repl{Contact: contact, Number: number, Resources: resources, out: out}
+	repl.reset(lang)
+	return repl
+}
+
+func (r *Repl) reset(lang string) {
+	r.chat = directory.NewDirectoryChat(r.Contact)
+	r.chat.Resources = r.Resources
+	if lang != "" {
+		r.chat.Language = lang
+	}
+}
+
+// Chat state is saved and loaded between messages the same way as in handle_message,
+// so anything that isn't serialized is lost like it would be in production
+func (r *Repl) reload() error {
+	chatJSON, err := json.Marshal(r.chat)
+	if err != nil {
+		return err
+	}
+	var directoryChat directory.DirectoryChat
+	if err := json.Unmarshal(chatJSON, &directoryChat); err != nil {
+		return err
+	}
+	directoryChat.Resources = r.Resources
+	r.chat = &directoryChat
+	return nil
+}
+
+// HandleLine runs a command or sends a message, returning false when the REPL should exit
+func (r *Repl) HandleLine(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return true, r.send(line)
+	}
+
+	switch fields[0] {
+	case "/lang":
+		if len(fields) < 2 {
+			fmt.Fprintf(r.out, "Language is %s\n", r.chat.Language)
+			return true, nil
+		}
+		r.chat.Language = fields[1]
+		fmt.Fprintf(r.out, "Switched language to %s\n", r.chat.Language)
+		return true, r.reload()
+	case "/state":
+		stateJSON, err := json.MarshalIndent(r.chat, "", "  ")
+		if err != nil {
+			return true, err
+		}
+		fmt.Fprintln(r.out, string(stateJSON))
+	case "/reset":
+		r.reset(r.chat.Language)
+		fmt.Fprintln(r.out, "Started a new conversation")
+	case "/help":
+		fmt.Fprintln(r.out, helpText)
+	case "/quit", "/exit":
+		return false, nil
+	default:
+		fmt.Fprintf(r.out, "Unknown command %s\n", fields[0])
+	}
+	return true, nil
+}
+
+func (r *Repl) send(body string) error {
+	createdAt := time.Now()
+	message := chat.Message{
+		ID:        fmt.Sprintf("repl_%d", createdAt.UnixNano()),
+		Sender:    r.Contact,
+		Recipient: r.Number,
+		Body:      body,
+		CreatedAt: &createdAt,
+	}
+	replies, err := r.chat.HandleMessage(message)
+	if err != nil {
+		return err
+	}
+	if len(replies) == 0 {
+		fmt.Fprintln(r.out, "(no reply)")
+	}
+	for _, reply := range replies {
+		r.printReply(reply)
+	}
+	return r.reload()
+}
+
+func (r *Repl) printReply(reply chat.Message) {
+	segments, encoding := svc.SMSSegments(reply.Body)
+	fmt.Fprintf(r.out, "\n%s\n", reply.Body)
+	for _, media := range reply.Media {
+		fmt.Fprintf(r.out, "[media %s %s]\n", media.ContentType, media.URL)
+	}
+	if reply.Menu != nil {
+		options := []string{}
+		for _, option := range reply.Menu.Options {
+			options = append(options, fmt.Sprintf("%s=%s", option.Value, option.Label))
+		}
+		fmt.Fprintf(r.out, "[menu %s]\n", strings.Join(options, ", "))
+	}
+	fmt.Fprintf(
+		r.out,
+		"[%d characters, %d segment(s), %s]\n\n",
+		len([]rune(reply.Body)),
+		segments,
+		encoding,
+	)
+}
+
+func main() {
+	resourcesFile := flag.String("resources", "resources.json", "Local JSON file of resources in the format saved to S3")
+	lang := flag.String("lang", "", "Language to start the conversation in")
+	contact := flag.String("from", "+15555555556", "Address of the contact sending messages")
+	number := flag.String("to", "+15555555555", "Address of the automated number")
+	flag.Parse()
+
+	// Check the file up front so a missing file isn't reported after choosing filters
+	if _, err := directory.LoadResourcesFile(*resourcesFile); err != nil {
+		log.Fatalf("Could not load resources from %s: %v", *resourcesFile, err)
+	}
+	repl := NewRepl(*contact, *number, *lang, directory.NewFileResourceStore(*resourcesFile), os.Stdout)
+	fmt.Println(helpText)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
+		keepGoing, err := repl.HandleLine(scanner.Text())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		if !keepGoing {
+			break
+		}
+	}
+}
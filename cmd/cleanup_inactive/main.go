@@ -2,15 +2,27 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"time"
 
 	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 )
 
+const inboundMessageTTL = 7 * 24 * time.Hour
+
+// Buckets that haven't been used for a day would be full again, so they can be removed
+const rateBucketTTL = 24 * time.Hour
+
+// Deliveries are kept as long as SQS can keep the send request, so a redelivered event
+// isn't sent again
+const deliveryTTL = 14 * 24 * time.Hour
+
 func handler(request events.CloudWatchEvent) error {
 	db, err := gorm.Open("postgres", fmt.Sprintf(
 		"host=%s port=%s user=%s dbname=%s password=%s",
@@ -26,6 +38,37 @@ func handler(request events.CloudWatchEvent) error {
 	defer db.Close()
 
 	chat.CleanupInactiveConversations(db)
+	// Twilio only retries webhooks for a short time, so the ledger doesn't need to be kept long
+	expired, err := chat.NewGormLedger(db).ExpireMessages(time.Now().Add(-inboundMessageTTL))
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired %d inbound messages", expired)
+	expired, err = chat.NewGormRateLimiter(db, chat.NewRateLimitPolicy()).ExpireBuckets(time.Now().Add(-rateBucketTTL))
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired %d rate limit buckets", expired)
+	expired, err = svc.NewS3DeliveryStore().ExpireDeliveries(time.Now().Add(-deliveryTTL))
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired %d deliveries", expired)
+
+	policy, err := chat.NewRetentionPolicy()
+	if err != nil {
+		return err
+	}
+	result, err := policy.Apply(db, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf(
+		"Pseudonymized %d conversations, deleted %d, removed %d unreachable contacts",
+		result.Pseudonymized,
+		result.Deleted,
+		result.Unreachable,
+	)
 	return nil
 }
 
@@ -3,11 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/getsentry/sentry-go"
 	"github.com/jinzhu/gorm"
@@ -18,51 +16,15 @@ import (
 	"github.com/City-Bureau/chicovidchat/pkg/svc"
 )
 
-func handleReceivedMessage(message chat.Message, conversation *chat.Conversation, db *gorm.DB) ([]chat.Message, error) {
-	var directoryChat directory.DirectoryChat
-	err := json.Unmarshal(conversation.Data.RawMessage, &directoryChat)
-	if err != nil {
-		return []chat.Message{}, err
-	}
-	replies, replyErr := directoryChat.HandleMessage(message)
-	if replyErr != nil {
-		return []chat.Message{}, replyErr
-	}
-	updateErr := directory.UpdateDirectoryChatConversation(&directoryChat, conversation, db)
-	if updateErr != nil {
-		return []chat.Message{}, updateErr
-	}
-	return replies, nil
-}
-
-func handleSentMessage(message chat.Message, conversation *chat.Conversation, db *gorm.DB) error {
-	var directoryChat directory.DirectoryChat
-	err := json.Unmarshal(conversation.Data.RawMessage, &directoryChat)
+func handler(payload json.RawMessage) error {
+	busEvents, err := svc.LambdaEvents(payload)
 	if err != nil {
 		sentry.CaptureException(err)
 		return err
 	}
-	lastMessage := directoryChat.Messages[len(directoryChat.Messages)-1]
-	// TODO: Update this conditional
-	if lastMessage.ID != message.ID && (*lastMessage.CreatedAt).Before(*message.CreatedAt) {
-		directoryChat.Messages = append(directoryChat.Messages, message)
-	}
-
-	return directory.UpdateDirectoryChatConversation(&directoryChat, conversation, db)
-}
-
-func handler(request events.SNSEvent) error {
-	if len(request.Records) < 1 {
+	if len(busEvents) < 1 {
 		return nil
 	}
-	snsRecord := request.Records[0].SNS
-
-	var message chat.Message
-	err := json.Unmarshal([]byte(snsRecord.Message), &message)
-	if err != nil {
-		sentry.CaptureException(err)
-		return err
-	}
 	db, dbErr := gorm.Open("postgres", fmt.Sprintf(
 		"host=%s port=%s user=%s dbname=%s password=%s",
 		os.Getenv("RDS_HOST"),
@@ -76,31 +38,30 @@ func handler(request events.SNSEvent) error {
 		return dbErr
 	}
 	defer db.Close()
-	snsClient := svc.NewSNSClient()
+	bus, err := svc.NewBus()
+	if err != nil {
+		return err
+	}
+	resources, err := directory.NewResourceStore(db)
+	if err != nil {
+		return err
+	}
+	// Events can be delivered more than once, so received messages are only processed once
+	messageHandler := &directory.MessageHandler{
+		Store:     chat.NewGormStore(db),
+		Bus:       bus,
+		Resources: resources,
+		Ledger:    chat.NewGormLedger(db),
+		Limiter:   chat.NewGormRateLimiter(db, chat.NewRateLimitPolicy()),
+	}
 
-	if feed, ok := snsRecord.MessageAttributes["feed"]; ok {
-		feedMap, _ := feed.(map[string]interface{})
-		feedVal, _ := feedMap["Value"].(string)
-		if feedVal == svc.ReceivedMessageFeed {
-			conversation, _ := directory.GetOrCreateConversationFromMessage(message.Sender, message, db)
-			replies, replyErr := handleReceivedMessage(message, conversation, db)
-			if replyErr != nil {
-				sentry.CaptureException(replyErr)
-				return replyErr
-			}
-			repliesJSON, _ := json.Marshal(replies)
-			return snsClient.Publish(string(repliesJSON), os.Getenv("SNS_TOPIC_ARN"), svc.SendSMSFeed)
-		} else if feedVal == svc.SentMessageFeed {
-			conversation, _ := directory.GetOrCreateConversationFromMessage(message.Recipient, message, db)
-			return handleSentMessage(message, conversation, db)
-		} else {
-			log.Printf("No handler for feed %s", feedVal)
-			return nil
+	for _, event := range busEvents {
+		if err := messageHandler.HandleEvent(event); err != nil {
+			sentry.CaptureException(err)
+			return err
 		}
-	} else {
-		log.Println("Feed not present in SNS message")
-		return nil
 	}
+	return nil
 }
 
 func main() {
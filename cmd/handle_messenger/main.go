@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func handleVerify(request events.APIGatewayProxyRequest, messengerChat *svc.MessengerChat) (events.APIGatewayProxyResponse, error) {
+	query := url.Values{}
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	challenge, ok := messengerChat.VerifySubscription(query)
+	if !ok {
+		return events.APIGatewayProxyResponse{StatusCode: 403}, nil
+	}
+	return events.APIGatewayProxyResponse{
+		Body:       challenge,
+		Headers:    map[string]string{"content-type": "text/plain"},
+		StatusCode: 200,
+	}, nil
+}
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	provider, err := svc.NewChannelProvider(svc.MessengerChannel, "", "")
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if request.HTTPMethod == "GET" {
+		return handleVerify(request, provider.(*svc.MessengerChat))
+	}
+
+	messages, err := svc.ReceiveWebhook(provider, svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT")))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	bus, err := svc.NewBus()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	for _, message := range messages {
+		messageJSON, _ := json.Marshal(message)
+		log.Println(string(messageJSON))
+
+		err = bus.Publish(svc.ReceivedEvent(message))
+		if err != nil {
+			sentry.CaptureException(err)
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	body, contentType := provider.WebhookResponse()
+	return events.APIGatewayProxyResponse{
+		Body:       body,
+		Headers:    map[string]string{"content-type": contentType},
+		StatusCode: 200,
+	}, nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// Handles inbound message webhooks for any SMS provider, selected by the provider path parameter
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	provider, err := svc.NewSMSProvider(request.PathParameters["provider"], "", "")
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+	}
+
+	messages, err := svc.ReceiveWebhook(provider, svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT")))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	bus, err := svc.NewBus()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	for _, message := range messages {
+		messageJSON, _ := json.Marshal(message)
+		log.Println(string(messageJSON))
+
+		err = bus.Publish(svc.ReceivedEvent(message))
+		if err != nil {
+			sentry.CaptureException(err)
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	body, contentType := provider.WebhookResponse()
+	return events.APIGatewayProxyResponse{
+		Body:       body,
+		Headers:    map[string]string{"content-type": contentType},
+		StatusCode: 200,
+	}, nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// Handles delivery status callbacks for any SMS provider, selected by the provider path parameter
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	provider, err := svc.NewSMSProvider(request.PathParameters["provider"], "", "")
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+	}
+
+	statuses, err := svc.ReceiveStatusCallback(provider, svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT")))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	bus, err := svc.NewBus()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	for _, status := range statuses {
+		statusJSON, _ := json.Marshal(status)
+		log.Println(string(statusJSON))
+
+		err = bus.Publish(svc.DeliveryStatusEvent(status))
+		if err != nil {
+			sentry.CaptureException(err)
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -4,79 +4,69 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
 	"os"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/getsentry/sentry-go"
-	"github.com/gorilla/schema"
-	"github.com/sfreiberg/gotwilio"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 
 	"github.com/City-Bureau/chicovidchat/pkg/chat"
 	"github.com/City-Bureau/chicovidchat/pkg/svc"
 )
 
 func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	values, err := url.ParseQuery(request.Body)
+	provider, err := svc.NewSMSProvider(svc.TwilioProvider, os.Getenv("TWILIO_FROM"), "")
 	if err != nil {
 		sentry.CaptureException(err)
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	client := gotwilio.NewTwilioClient(
-		os.Getenv("TWILIO_ACCOUNT_SID"),
-		os.Getenv("TWILIO_AUTH_TOKEN"),
-	)
-	twilioChat := svc.NewTwilioChat(client, os.Getenv("TWILIO_FROM"), "")
-	isValid, signatureErr := twilioChat.CheckSignature(
-		fmt.Sprintf("%s%s", os.Getenv("GW_ENDPOINT"), request.Path),
-		request.Headers["X-Twilio-Signature"],
-		values,
-	)
-	if signatureErr != nil {
-		sentry.CaptureException(signatureErr)
-		return events.APIGatewayProxyResponse{}, signatureErr
-	}
-	if !isValid {
-		return events.APIGatewayProxyResponse{}, fmt.Errorf("Twilio signature is not valid")
+	// Media attachments and interactive replies are recorded on the message,
+	// replies are handled by the chat
+	messages, err := svc.ReceiveWebhook(provider, svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT")))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
 	}
 
-	var smsWebhook gotwilio.SMSWebhook
-
-	// Create custom decoder ignoring keys not in webhook struct
-	formDecoder := schema.NewDecoder()
-	formDecoder.IgnoreUnknownKeys(true)
-	formDecoder.SetAliasTag("form")
-	err = formDecoder.Decode(&smsWebhook, values)
+	for _, message := range messages {
+		messageJSON, _ := json.Marshal(message)
+		log.Println(string(messageJSON))
+	}
 
+	db, err := gorm.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s password=%s",
+		os.Getenv("RDS_HOST"),
+		os.Getenv("RDS_PORT"),
+		os.Getenv("RDS_USERNAME"),
+		os.Getenv("RDS_DB_NAME"),
+		os.Getenv("RDS_PASSWORD"),
+	))
 	if err != nil {
 		sentry.CaptureException(err)
 		return events.APIGatewayProxyResponse{}, err
 	}
+	defer db.Close()
 
-	snsClient := svc.NewSNSClient()
-	createdAt := time.Now()
-	message := chat.Message{
-		ID:        smsWebhook.MessageSid,
-		Sender:    smsWebhook.From,
-		Recipient: smsWebhook.To,
-		Body:      smsWebhook.Body,
-		CreatedAt: &createdAt,
+	bus, err := svc.NewBus()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
 	}
-	messageJSON, _ := json.Marshal(message)
-	log.Println(string(messageJSON))
-
-	err = snsClient.Publish(string(messageJSON), os.Getenv("SNS_TOPIC_ARN"), svc.ReceivedMessageFeed)
+	// Twilio retries webhooks that time out, so messages already received are skipped
+	err = svc.PublishReceivedMessages(bus, chat.NewGormLedger(db), messages)
 	if err != nil {
 		sentry.CaptureException(err)
 		return events.APIGatewayProxyResponse{}, err
 	}
 
+	body, contentType := provider.WebhookResponse()
 	return events.APIGatewayProxyResponse{
-		Body:       `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`,
-		Headers:    map[string]string{"content-type": "text/html"},
+		Body:       body,
+		Headers:    map[string]string{"content-type": contentType},
 		StatusCode: 200,
 	}, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	provider, err := svc.NewSMSProvider(svc.TwilioProvider, os.Getenv("TWILIO_FROM"), "")
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	webhookRequest := svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT"))
+	isValid, signatureErr := provider.VerifyWebhook(webhookRequest)
+	if signatureErr != nil {
+		sentry.CaptureException(signatureErr)
+		return events.APIGatewayProxyResponse{}, signatureErr
+	}
+	if !isValid {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("Twilio signature is not valid")
+	}
+
+	db, err := gorm.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s password=%s",
+		os.Getenv("RDS_HOST"),
+		os.Getenv("RDS_PORT"),
+		os.Getenv("RDS_USERNAME"),
+		os.Getenv("RDS_DB_NAME"),
+		os.Getenv("RDS_PASSWORD"),
+	))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+	resources, err := directory.NewResourceStore(db)
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	voiceCall := directory.NewVoiceCall(fmt.Sprintf("%s%s", os.Getenv("GW_ENDPOINT"), request.Path), webhookRequest.Query)
+	voiceCall.Resources = resources
+	voiceCall.Caller = values.Get("From")
+	voiceCall.Called = values.Get("To")
+	twiml, sendText, err := voiceCall.HandleInput(values.Get("Digits"), values.Get("SpeechResult"))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	if sendText {
+		bus, err := svc.NewBus()
+		if err != nil {
+			sentry.CaptureException(err)
+			return events.APIGatewayProxyResponse{}, err
+		}
+		// Results are published like replies to messages, so unreachable and blocked contacts
+		// are skipped and texts count toward the outbound limit
+		messageHandler := &directory.MessageHandler{
+			Store:   chat.NewGormStore(db),
+			Bus:     bus,
+			Limiter: chat.NewGormRateLimiter(db, chat.NewRateLimitPolicy()),
+		}
+		if err := messageHandler.TextVoiceResults(voiceCall); err != nil {
+			sentry.CaptureException(err)
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       twiml,
+		Headers:    map[string]string{"content-type": "text/xml"},
+		StatusCode: 200,
+	}, nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -1,15 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/City-Bureau/chicovidchat/pkg/directory"
 )
@@ -23,20 +19,24 @@ func handler(request events.CloudWatchEvent) error {
 		return err
 	}
 
-	recordsJSON, jsonErr := json.Marshal(records)
-	if jsonErr != nil {
+	db, err := directory.OpenResourceDB()
+	if err != nil {
 		return err
 	}
-
-	client, _ := session.NewSession()
-	_, err = s3.New(client).PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(os.Getenv("S3_BUCKET")),
-		Key:         aws.String("latest.json"),
-		ACL:         aws.String("private"),
-		Body:        bytes.NewReader(recordsJSON),
-		ContentType: aws.String("application/json"),
-	})
-
+	if db != nil {
+		defer db.Close()
+	}
+	store, err := directory.NewResourceStore(db)
+	if err != nil {
+		return err
+	}
+	report, err := directory.PublishResources(store, records, directory.NewImportPolicy())
+	log.Printf(
+		"Validated %d resources with %d errors and %d warnings",
+		report.Resources,
+		report.Errors,
+		report.Warnings,
+	)
 	return err
 }
 
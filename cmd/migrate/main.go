@@ -2,18 +2,28 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 
-	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/migrations"
 )
 
-func handler(request events.CloudWatchEvent) error {
-	db, err := gorm.Open("postgres", fmt.Sprintf(
+// MigrateRequest is the Lambda payload, which defaults to applying pending migrations
+type MigrateRequest struct {
+	Command string `json:"command"`
+	Steps   int    `json:"steps"`
+}
+
+func openDB() (*gorm.DB, error) {
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		return gorm.Open("postgres", databaseURL)
+	}
+	return gorm.Open("postgres", fmt.Sprintf(
 		"host=%s port=%s user=%s dbname=%s password=%s",
 		os.Getenv("RDS_HOST"),
 		os.Getenv("RDS_PORT"),
@@ -21,16 +31,66 @@ func handler(request events.CloudWatchEvent) error {
 		os.Getenv("RDS_DB_NAME"),
 		os.Getenv("RDS_PASSWORD"),
 	))
+}
+
+func migrate(request MigrateRequest) error {
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
-	// db.DropTable(&chat.Conversation{})
-	db.AutoMigrate(&chat.Conversation{})
 	defer db.Close()
+	migrator := migrations.NewMigrator(db)
 
-	return nil
+	switch request.Command {
+	case "", "up":
+		migrated, err := migrator.Up()
+		for _, migration := range migrated {
+			log.Printf("Applied %d %s", migration.Version, migration.Name)
+		}
+		return err
+	case "down":
+		steps := request.Steps
+		if steps < 1 {
+			steps = 1
+		}
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			log.Printf("Rolled back %d %s", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			log.Printf("%d %s %s", status.Migration.Version, status.Migration.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown command %s, expected up, down or status", request.Command)
+	}
 }
 
 func main() {
-	lambda.Start(handler)
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(migrate)
+		return
+	}
+
+	// Run locally with DATABASE_URL or RDS_* set, like "migrate down 2"
+	request := MigrateRequest{}
+	if len(os.Args) > 1 {
+		request.Command = os.Args[1]
+	}
+	if len(os.Args) > 2 {
+		request.Steps, _ = strconv.Atoi(os.Args[2])
+	}
+	if err := migrate(request); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+)
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := strings.TrimSuffix(request.PathParameters["id"], ".vcf")
+	query := url.Values{}
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+
+	// Only serve resources from URLs signed when sending results
+	if !directory.CheckVCardSignature(id, query, os.Getenv("VCARD_SIGNING_KEY")) {
+		return events.APIGatewayProxyResponse{StatusCode: 403}, nil
+	}
+
+	db, err := directory.OpenResourceDB()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+	store, err := directory.NewResourceStore(db)
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	set, err := store.ResourceSet()
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	resource, ok := directory.FindResource(set.Resources, id)
+	if !ok {
+		return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+	}
+
+	lang := query.Get("lang")
+	if lang == "" {
+		lang = "en"
+	}
+	return events.APIGatewayProxyResponse{
+		Body: resource.AsVCard(lang),
+		Headers: map[string]string{
+			"content-type":        directory.VCardContentType,
+			"content-disposition": fmt.Sprintf(`attachment; filename="%s.vcf"`, id),
+		},
+		StatusCode: 200,
+	}, nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func handler(payload json.RawMessage) error {
+	busEvents, err := svc.LambdaEvents(payload)
+	if err != nil {
+		return err
+	}
+	bus, err := svc.NewBus()
+	if err != nil {
+		return err
+	}
+	sender := svc.NewSender(bus, svc.NewS3DeliveryStore())
+
+	// The Send API responds quickly, so send everything in order in one invocation
+	for _, event := range busEvents {
+		if err := sender.HandleEvent(event); err != nil {
+			sentry.CaptureException(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
@@ -2,82 +2,33 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
-	"os"
-	"time"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/getsentry/sentry-go"
-	"github.com/sfreiberg/gotwilio"
 
-	"github.com/City-Bureau/chicovidchat/pkg/chat"
 	"github.com/City-Bureau/chicovidchat/pkg/svc"
 )
 
-func SendMessage(message chat.Message, twilioChat *svc.TwilioChat, snsClient *svc.SNSClient) error {
-	twilioRes, twilioErr, sendErr := twilioChat.SendSMS(message.Body)
-	if sendErr != nil {
-		sentry.CaptureException(sendErr)
-		return sendErr
-	}
-	if twilioErr != nil {
-		sentry.CaptureException(twilioErr)
-		return fmt.Errorf("Twilio returned error code: %s", *twilioErr)
-	}
-
-	createdAt := time.Now()
-	twilioMessage := chat.Message{
-		ID:        twilioRes.Sid,
-		Sender:    message.Sender,
-		Recipient: message.Recipient,
-		Body:      message.Body,
-		CreatedAt: &createdAt,
-	}
-	twilioMessageJSON, _ := json.Marshal(twilioMessage)
-	return snsClient.Publish(string(twilioMessageJSON), os.Getenv("SNS_TOPIC_ARN"), svc.SentMessageFeed)
-}
-
-func handler(request events.SNSEvent) error {
-	if len(request.Records) <= 0 {
-		return nil
-	}
-	message := request.Records[0].SNS.Message
-
-	var messages []chat.Message
-	err := json.Unmarshal([]byte(message), &messages)
+func handler(payload json.RawMessage) error {
+	busEvents, err := svc.LambdaEvents(payload)
 	if err != nil {
 		return err
 	}
-
-	if len(messages) == 0 {
-		return nil
+	bus, err := svc.NewBus()
+	if err != nil {
+		return err
 	}
-
-	client := gotwilio.NewTwilioClient(
-		os.Getenv("TWILIO_ACCOUNT_SID"),
-		os.Getenv("TWILIO_AUTH_TOKEN"),
-	)
-	twilioChat := svc.NewTwilioChat(
-		client,
-		messages[0].Sender,
-		messages[0].Recipient,
-	)
-	snsClient := svc.NewSNSClient()
-
-	if len(messages) == 1 {
-		return SendMessage(messages[0], twilioChat, snsClient)
-	} else {
-		msgErr := SendMessage(messages[0], twilioChat, snsClient)
-		if msgErr != nil {
-			return msgErr
+	// Batches are sent in order with a pause between messages. If one fails the error
+	// is returned so the event is retried, resuming from the message that failed
+	sender := svc.NewSender(bus, svc.NewS3DeliveryStore())
+
+	for _, event := range busEvents {
+		if err := sender.HandleEvent(event); err != nil {
+			sentry.CaptureException(err)
+			return err
 		}
-		// To make sure messages are sent in order, only send the top and
-		// all other messages are chained
-		messages = messages[1:]
-		messagesJSON, _ := json.Marshal(messages)
-		return snsClient.Publish(string(messagesJSON), os.Getenv("SNS_TOPIC_ARN"), svc.SendSMSFeed)
 	}
+	return nil
 }
 
 func main() {
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+	"github.com/City-Bureau/chicovidchat/pkg/migrations"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// Server hosts webhook endpoints and runs the message handlers in one process
+type Server struct {
+	Endpoint  string // Public base URL, used to verify webhook signatures
+	Verify    bool   // Whether to verify webhook signatures
+	Send      bool   // Whether to send replies through providers or only log them
+	Store     chat.ConversationStore
+	Resources directory.ResourceStore
+	Ledger    chat.MessageLedger
+	Limiter   chat.RateLimiter
+	Bus       *svc.MemoryBus
+}
+
+// Subscribe registers the handlers that run as separate functions when deployed
+func (s *Server) Subscribe() {
+	messageHandler := &directory.MessageHandler{
+		Store:     s.Store,
+		Bus:       s.Bus,
+		Resources: s.Resources,
+		Ledger:    s.Ledger,
+		Limiter:   s.Limiter,
+	}
+	s.Bus.Subscribe(svc.ReceivedMessageFeed, messageHandler.HandleEvent)
+	s.Bus.Subscribe(svc.SentMessageFeed, messageHandler.HandleEvent)
+	s.Bus.Subscribe(svc.DeliveryStatusFeed, messageHandler.HandleEvent)
+	sendMessages := svc.NewSender(s.Bus, svc.NewMemoryDeliveryStore()).HandleEvent
+	if !s.Send {
+		sendMessages = s.logMessages
+	}
+	s.Bus.Subscribe(svc.SendSMSFeed, sendMessages)
+	s.Bus.Subscribe(svc.SendMessengerFeed, sendMessages)
+}
+
+// Logs messages instead of sending them, recording them as sent so the transcript
+// matches what would have been sent
+func (s *Server) logMessages(event svc.Event) error {
+	for _, message := range event.Messages {
+		log.Printf("Sending to %s:\n%s", message.Recipient, message.Body)
+		createdAt := time.Now()
+		message.ID = fmt.Sprintf("local_%d", createdAt.UnixNano())
+		message.CreatedAt = &createdAt
+		if err := s.Bus.Publish(svc.SentEvent(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a handler for webhooks from the provider selected for each request
+func (s *Server) webhookHandler(providerForRequest func(*http.Request) (chat.Provider, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, err := providerForRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		request, err := svc.NewHTTPWebhookRequest(r, s.Endpoint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var messages []chat.Message
+		if s.Verify {
+			messages, err = svc.ReceiveWebhook(provider, request)
+		} else {
+			messages, err = provider.ParseWebhook(request)
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, message := range messages {
+			log.Printf("Received from %s:\n%s", message.Sender, message.Body)
+		}
+		if err := svc.PublishReceivedMessages(s.Bus, s.Ledger, messages); err != nil {
+			log.Println(err)
+		}
+
+		body, contentType := provider.WebhookResponse()
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+// Handles delivery status callbacks from the SMS provider in the path
+func (s *Server) statusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, err := svc.NewSMSProvider(strings.TrimPrefix(r.URL.Path, "/api/status/"), "", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		request, err := svc.NewHTTPWebhookRequest(r, s.Endpoint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var statuses []chat.DeliveryStatus
+		if s.Verify {
+			statuses, err = svc.ReceiveStatusCallback(provider, request)
+		} else {
+			statuses, err = provider.ParseStatusCallback(request)
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, status := range statuses {
+			if err := s.Bus.Publish(svc.DeliveryStatusEvent(status)); err != nil {
+				log.Println(err)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Handles the Messenger verification handshake before passing webhooks through
+func (s *Server) messengerHandler() http.HandlerFunc {
+	webhook := s.webhookHandler(func(r *http.Request) (chat.Provider, error) {
+		return svc.NewChannelProvider(svc.MessengerChannel, "", "")
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			provider, _ := svc.NewChannelProvider(svc.MessengerChannel, "", "")
+			challenge, ok := provider.(*svc.MessengerChat).VerifySubscription(r.URL.Query())
+			if !ok {
+				http.Error(w, "Verification failed", http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(challenge))
+			return
+		}
+		webhook(w, r)
+	}
+}
+
+// Routes returns the webhook endpoints at the same paths as API Gateway
+func (s *Server) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/twilio", s.webhookHandler(func(r *http.Request) (chat.Provider, error) {
+		return svc.NewSMSProvider(svc.TwilioProvider, os.Getenv("TWILIO_FROM"), "")
+	}))
+	mux.HandleFunc("/api/sms/", s.webhookHandler(func(r *http.Request) (chat.Provider, error) {
+		return svc.NewSMSProvider(strings.TrimPrefix(r.URL.Path, "/api/sms/"), "", "")
+	}))
+	mux.HandleFunc("/api/status/", s.statusHandler())
+	mux.HandleFunc("/api/messenger", s.messengerHandler())
+	return mux
+}
+
+func openStore(databaseURL, storePath string, ledger *chat.MemoryLedger, limiter *chat.MemoryRateLimiter) (chat.ConversationStore, error) {
+	if databaseURL == "" {
+		store, err := chat.NewMemoryStore(storePath)
+		if err != nil {
+			return nil, err
+		}
+		store.Ledger = ledger
+		store.Limiter = limiter
+		return store, nil
+	}
+	db, err := gorm.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrations.NewMigrator(db).Up(); err != nil {
+		return nil, err
+	}
+	return chat.NewGormStore(db), nil
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	endpoint := flag.String("endpoint", "", "Public base URL for verifying signatures, defaults to http://localhost with the port")
+	resourcesFile := flag.String("resources", "resources.json", "Local JSON file of resources in the format saved to S3")
+	databaseURL := flag.String("db", os.Getenv("DATABASE_URL"), "Postgres connection string, conversations are stored in -store if not set")
+	storePath := flag.String("store", "conversations.json", "File for storing conversations without Postgres, or empty to keep them in memory")
+	verify := flag.Bool("verify", true, "Verify webhook signatures")
+	send := flag.Bool("send", true, "Send replies through providers instead of only logging them")
+	flag.Parse()
+
+	// Providers can only send delivery status callbacks to a public endpoint
+	if *endpoint != "" && os.Getenv("GW_ENDPOINT") == "" {
+		os.Setenv("GW_ENDPOINT", *endpoint)
+	}
+	if *endpoint == "" {
+		*endpoint = fmt.Sprintf("http://localhost%s", *addr)
+	}
+	ledger := chat.NewMemoryLedger()
+	limiter := chat.NewMemoryRateLimiter(chat.NewRateLimitPolicy())
+	store, err := openStore(*databaseURL, *storePath, ledger, limiter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &Server{
+		Endpoint:  *endpoint,
+		Verify:    *verify,
+		Send:      *send,
+		Store:     store,
+		Resources: directory.NewFileResourceStore(*resourcesFile),
+		Ledger:    ledger,
+		Limiter:   limiter,
+		Bus:       svc.NewMemoryBus(),
+	}
+	server.Subscribe()
+	go server.Bus.Run()
+
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.Routes()))
+}
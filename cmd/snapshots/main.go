@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+)
+
+// SnapshotsRequest is the Lambda payload, which defaults to listing snapshots
+type SnapshotsRequest struct {
+	Command string `json:"command"`
+	ID      string `json:"id"`
+	// Snapshot to compare with ID, the latest by default
+	To string `json:"to"`
+}
+
+// SnapshotsResponse has snapshot IDs and the held snapshot for list, or the changes
+// between snapshots for diff
+type SnapshotsResponse struct {
+	Snapshots []string                `json:"snapshots,omitempty"`
+	Held      string                  `json:"held,omitempty"`
+	Diff      *directory.ResourceDiff `json:"diff,omitempty"`
+}
+
+func snapshots(request SnapshotsRequest) (*SnapshotsResponse, error) {
+	db, err := directory.OpenResourceDB()
+	if err != nil {
+		return nil, err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+	store, err := directory.NewResourceStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.Command {
+	case "", "list":
+		ids, err := store.Snapshots()
+		if err != nil {
+			return nil, err
+		}
+		held, err := store.HeldSnapshot()
+		return &SnapshotsResponse{Snapshots: ids, Held: held}, err
+	case "diff":
+		return diff(store, request.ID, request.To)
+	case "rollback":
+		if request.ID == "" {
+			return nil, fmt.Errorf("A snapshot ID is required to roll back")
+		}
+		log.Printf("Rolling back to snapshot %s", request.ID)
+		return &SnapshotsResponse{}, directory.RollbackResources(store, request.ID)
+	case "release":
+		log.Printf("Releasing held snapshot so imports are published")
+		return &SnapshotsResponse{}, store.ReleaseSnapshot()
+	default:
+		return nil, fmt.Errorf("Unknown command %s, expected list, diff, rollback or release", request.Command)
+	}
+}
+
+// Compares the resources in snapshot from with snapshot to, or the latest snapshot
+func diff(store directory.ResourceStore, from, to string) (*SnapshotsResponse, error) {
+	if to == "" {
+		latest, err := store.LatestSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		if latest == "" {
+			return nil, fmt.Errorf("No snapshots to compare with")
+		}
+		to = latest
+	}
+	previous, err := store.LoadSnapshot(from)
+	if err != nil {
+		return nil, err
+	}
+	current, err := store.LoadSnapshot(to)
+	if err != nil {
+		return nil, err
+	}
+	resourceDiff := directory.DiffResources(previous, current)
+	resourceDiff.Previous = from
+	return &SnapshotsResponse{Diff: resourceDiff}, nil
+}
+
+func main() {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(snapshots)
+		return
+	}
+
+	// Run locally with the same RESOURCES_STORE settings, like "snapshots rollback 20200501T120000Z"
+	request := SnapshotsRequest{}
+	if len(os.Args) > 1 {
+		request.Command = os.Args[1]
+	}
+	if len(os.Args) > 2 {
+		request.ID = os.Args[2]
+	}
+	if len(os.Args) > 3 {
+		request.To = os.Args[3]
+	}
+	response, err := snapshots(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, id := range response.Snapshots {
+		if id == response.Held {
+			fmt.Println(id, "(held)")
+		} else {
+			fmt.Println(id)
+		}
+	}
+	if response.Diff != nil {
+		diffJSON, _ := json.MarshalIndent(response.Diff, "", "  ")
+		fmt.Println(string(diffJSON))
+	}
+}
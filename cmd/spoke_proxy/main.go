@@ -8,13 +8,10 @@ import (
 	"net/url"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/gorilla/schema"
 	"github.com/jinzhu/gorm"
-	"github.com/sfreiberg/gotwilio"
 
 	"github.com/City-Bureau/chicovidchat/pkg/chat"
 	"github.com/City-Bureau/chicovidchat/pkg/svc"
@@ -22,20 +19,15 @@ import (
 
 const optInStr string = "covid"
 
-func handleChatSMS(smsWebhook gotwilio.SMSWebhook) error {
-	snsClient := svc.NewSNSClient()
-	createdAt := time.Now()
-	message := chat.Message{
-		ID:        smsWebhook.MessageSid,
-		Sender:    smsWebhook.From,
-		Recipient: smsWebhook.To,
-		Body:      smsWebhook.Body,
-		CreatedAt: &createdAt,
+func handleChatSMS(message chat.Message) error {
+	bus, err := svc.NewBus()
+	if err != nil {
+		return err
 	}
 	messageJSON, _ := json.Marshal(message)
 	log.Println(string(messageJSON))
 
-	return snsClient.Publish(string(messageJSON), os.Getenv("SNS_TOPIC_ARN"), svc.ReceivedMessageFeed)
+	return bus.Publish(svc.ReceivedEvent(message))
 }
 
 func proxyTwilioRequest(request events.APIGatewayProxyRequest, values url.Values) error {
@@ -51,9 +43,16 @@ func proxyTwilioRequest(request events.APIGatewayProxyRequest, values url.Values
 	}
 
 	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 	log.Println(res.StatusCode)
-
-	return err
+	// Errors are returned so the message is forgotten and Twilio's retry proxies it again
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Spoke responded with status %d", res.StatusCode)
+	}
+	return nil
 }
 
 func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -63,38 +62,18 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	client := gotwilio.NewTwilioClient(
-		os.Getenv("TWILIO_ACCOUNT_SID"),
-		os.Getenv("TWILIO_AUTH_TOKEN"),
-	)
-	twilioChat := svc.NewTwilioChat(client, os.Getenv("TWILIO_FROM"), "")
-	isValid, signatureErr := twilioChat.CheckSignature(
-		fmt.Sprintf("%s%s", os.Getenv("GW_ENDPOINT"), request.Path),
-		request.Headers["X-Twilio-Signature"],
-		values,
-	)
-	if signatureErr != nil {
-		log.Println(signatureErr)
-		return events.APIGatewayProxyResponse{}, signatureErr
-	}
-	if !isValid {
-		log.Println("Twilio signature is not valid")
-		return events.APIGatewayProxyResponse{}, fmt.Errorf("Twilio signature is not valid")
-	}
-
-	var smsWebhook gotwilio.SMSWebhook
-
-	// Create custom decoder ignoring keys not in webhook struct
-	formDecoder := schema.NewDecoder()
-	formDecoder.IgnoreUnknownKeys(true)
-	formDecoder.SetAliasTag("form")
-	err = formDecoder.Decode(&smsWebhook, values)
-
+	provider, err := svc.NewSMSProvider(svc.TwilioProvider, os.Getenv("TWILIO_FROM"), "")
 	if err != nil {
+		log.Println(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	messages, err := svc.ReceiveWebhook(provider, svc.NewWebhookRequest(request, os.Getenv("GW_ENDPOINT")))
+	if err != nil || len(messages) == 0 {
 		log.Println("Decoded info not valid")
 		log.Println(err)
 		return events.APIGatewayProxyResponse{}, err
 	}
+	message := messages[0]
 
 	// Can access DB because if Spoke enabled an NAT must be set up
 	db, dbErr := gorm.Open("postgres", fmt.Sprintf(
@@ -110,34 +89,52 @@ func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 	}
 	defer db.Close()
 
+	body, contentType := provider.WebhookResponse()
+	response := events.APIGatewayProxyResponse{
+		Body:       body,
+		Headers:    map[string]string{"content-type": contentType},
+		StatusCode: 200,
+	}
+
+	// Twilio retries webhooks that time out, so skip messages that were already
+	// proxied and handled
+	ledger := chat.NewGormLedger(db)
+	isNew, err := ledger.ReceiveMessage(message)
+	if err != nil {
+		log.Println(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if !isNew {
+		log.Printf("Skipping duplicate message %s", message.ID)
+		return response, nil
+	}
+
 	var activeCount int64
-	db.Model(&chat.Conversation{}).Where("data ->> 'id' = ? AND active IS TRUE", smsWebhook.From).Count(&activeCount)
+	db.Model(&chat.Conversation{}).Where("contact = ? AND active IS TRUE", message.Sender).Count(&activeCount)
 	isInactive := activeCount < 1
-	isOptIn := strings.ToLower(strings.TrimSpace(smsWebhook.Body)) == optInStr
+	isOptIn := strings.ToLower(strings.TrimSpace(message.Body)) == optInStr
 
 	// Proxy all responses to Spoke-managed numbers to Spoke
 	// even if someone is replying to the bot
 	err = proxyTwilioRequest(request, values)
 	if err != nil {
 		log.Println(err)
+		_ = ledger.ForgetMessage(message)
 		return events.APIGatewayProxyResponse{}, err
 	}
 
 	// Send message to the bot if someone is in an active conversation with
-	// it or if they're opting into one
+	// it or if they're opting into one. The message stays recorded if this fails,
+	// since a retry would proxy it to Spoke again
 	if (isInactive && isOptIn) || !isInactive {
-		err = handleChatSMS(smsWebhook)
+		err = handleChatSMS(message)
 		if err != nil {
 			log.Println(err)
 			return events.APIGatewayProxyResponse{}, err
 		}
 	}
 
-	return events.APIGatewayProxyResponse{
-		Body:       `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`,
-		Headers:    map[string]string{"content-type": "text/html"},
-		StatusCode: 200,
-	}, nil
+	return response, nil
 }
 
 func main() {
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/getsentry/sentry-go"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/directory"
+)
+
+type messageRequest struct {
+	Body string `json:"body"`
+}
+
+func jsonResponse(statusCode int, body interface{}) (events.APIGatewayProxyResponse, error) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	return events.APIGatewayProxyResponse{
+		Body:       string(bodyJSON),
+		Headers:    corsHeaders(map[string]string{"content-type": "application/json"}),
+		StatusCode: statusCode,
+	}, nil
+}
+
+func errorResponse(statusCode int, message string) (events.APIGatewayProxyResponse, error) {
+	return jsonResponse(statusCode, map[string]string{"error": message})
+}
+
+// Allow the widget to be embedded on the configured origin
+func corsHeaders(headers map[string]string) map[string]string {
+	headers["access-control-allow-origin"] = os.Getenv("WEB_CHAT_ORIGIN")
+	headers["access-control-allow-headers"] = "authorization, content-type"
+	headers["access-control-allow-methods"] = "GET, POST, OPTIONS"
+	return headers
+}
+
+func bearerToken(request events.APIGatewayProxyRequest) string {
+	auth := request.Headers["Authorization"]
+	if auth == "" {
+		auth = request.Headers["authorization"]
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{Headers: corsHeaders(map[string]string{}), StatusCode: 204}, nil
+	}
+
+	db, err := gorm.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s password=%s",
+		os.Getenv("RDS_HOST"),
+		os.Getenv("RDS_PORT"),
+		os.Getenv("RDS_USERNAME"),
+		os.Getenv("RDS_DB_NAME"),
+		os.Getenv("RDS_PASSWORD"),
+	))
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+	defer db.Close()
+	resources, err := directory.NewResourceStore(db)
+	if err != nil {
+		sentry.CaptureException(err)
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	var session *directory.WebSession
+	switch {
+	case request.HTTPMethod == "POST" && strings.HasSuffix(request.Path, "/sessions"):
+		session, err = directory.CreateWebSession(db)
+	case request.HTTPMethod == "POST" && strings.HasSuffix(request.Path, "/messages"):
+		var messageReq messageRequest
+		if jsonErr := json.Unmarshal([]byte(request.Body), &messageReq); jsonErr != nil {
+			return errorResponse(400, "Invalid message")
+		}
+		session, err = directory.HandleWebMessage(bearerToken(request), messageReq.Body, db, resources)
+	case request.HTTPMethod == "GET" && strings.HasSuffix(request.Path, "/messages"):
+		cursor, _ := strconv.Atoi(request.QueryStringParameters["cursor"])
+		session, err = directory.PollWebSession(bearerToken(request), cursor, db)
+	default:
+		return errorResponse(404, "Not found")
+	}
+
+	if err == directory.ErrWebSessionNotFound {
+		return errorResponse(404, err.Error())
+	} else if err != nil {
+		sentry.CaptureException(err)
+		return errorResponse(500, "Unable to handle message")
+	}
+	return jsonResponse(200, session)
+}
+
+func main() {
+	_ = sentry.Init(sentry.ClientOptions{
+		Dsn: os.Getenv("SENTRY_DSN"),
+		Transport: &sentry.HTTPSyncTransport{
+			Timeout: 5 * time.Second,
+		},
+	})
+
+	lambda.Start(handler)
+}
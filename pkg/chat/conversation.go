@@ -7,15 +7,30 @@ import (
 	"github.com/jinzhu/gorm/dialects/postgres"
 )
 
-// Conversation is the struct for managing database access to Chats
+// Conversation is the struct for managing database access to Chats. Fields used to
+// look up conversations are stored in columns as well as in Data
 type Conversation struct {
 	gorm.Model
-	Active bool           `gorm:"default:true" json:"active"`
-	Data   postgres.Jsonb `json:"data"`
+	Active  bool   `gorm:"default:true" json:"active"`
+	Channel string `gorm:"default:'sms'" json:"channel"`
+	Contact string `gorm:"index" json:"contact"`
+	// The address the contact messaged, for deployments with more than one number
+	Tenant   string         `gorm:"index" json:"tenant"`
+	State    string         `gorm:"index" json:"state"`
+	Language string         `json:"language"`
+	Data     postgres.Jsonb `json:"data"`
+	// Set when the contact's address and messages were removed by the retention policy
+	PseudonymizedAt *time.Time `json:"pseudonymized_at"`
+	// Incremented on every update, so saving a conversation that changed since it was
+	// loaded fails instead of overwriting the other change
+	Version int `gorm:"default:1" json:"version"`
 }
 
 func CleanupInactiveConversations(db *gorm.DB) {
 	// Mark any conversations as inactive that haven't been updated in 6 hours
 	sixHoursAgo := time.Now().Add(time.Hour * -6)
-	db.Model(&Conversation{}).Where("active = ? AND updated_at < ?", true, sixHoursAgo).Update("active", false)
+	db.Model(&Conversation{}).Where("active = ? AND updated_at < ?", true, sixHoursAgo).Updates(map[string]interface{}{
+		"active":  false,
+		"version": gorm.Expr("version + 1"),
+	})
 }
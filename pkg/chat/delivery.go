@@ -0,0 +1,26 @@
+package chat
+
+import "time"
+
+// UnreachableContact is a contact that messages can't be delivered to, like a landline,
+// based on the error code a provider reported
+type UnreachableContact struct {
+	Contact   string    `gorm:"primary_key" json:"contact"`
+	ErrorCode string    `json:"error_code"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Order of delivery statuses, since callbacks for a message can arrive out of order
+var statusOrder = map[string]int{
+	StatusQueued:      1,
+	StatusSent:        2,
+	StatusDelivered:   3,
+	StatusUndelivered: 3,
+	StatusFailed:      3,
+	StatusRead:        4,
+}
+
+// IsLaterStatus returns whether a status should replace the current status of a message
+func IsLaterStatus(current, status string) bool {
+	return statusOrder[status] >= statusOrder[current]
+}
@@ -0,0 +1,260 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// InboundMessage is an entry in the ledger of received messages, keyed on the
+// provider's message ID like Twilio's MessageSid
+type InboundMessage struct {
+	MessageID   string `gorm:"primary_key"`
+	Sender      string
+	CreatedAt   time.Time
+	ProcessedAt *time.Time
+	// Replies to the message that haven't been published, stored as jsonb in Postgres
+	Replies []Message `gorm:"-"`
+}
+
+// MessageLedger records received messages so retried webhooks and events are only handled
+// once. Messages without an ID aren't recorded and are always handled
+type MessageLedger interface {
+	// ReceiveMessage records a message from a webhook, returning false if it was already received
+	ReceiveMessage(Message) (bool, error)
+	// ForgetMessage removes a message so a retried webhook is received again
+	ForgetMessage(Message) error
+	// ProcessMessage marks a message as processed, returning false if it already was
+	ProcessMessage(Message) (bool, error)
+	// ReleaseMessage clears a message's processed mark so a retried event is processed again
+	ReleaseMessage(Message) error
+	// SaveReplies keeps the replies to a processed message until they're published
+	SaveReplies(Message, []Message) error
+	// PendingReplies returns the replies saved for a message that haven't been published
+	PendingReplies(Message) ([]Message, error)
+	// ClearReplies removes a message's replies once they're published
+	ClearReplies(Message) error
+	// ExpireMessages removes messages received before a time, returning the number removed
+	ExpireMessages(before time.Time) (int64, error)
+}
+
+// GormLedger implements MessageLedger in Postgres
+type GormLedger struct {
+	DB *gorm.DB
+}
+
+// NewGormLedger is a constructor for GormLedger structs
+func NewGormLedger(db *gorm.DB) *GormLedger {
+	return &GormLedger{DB: db}
+}
+
+// ReceiveMessage inserts a message, ignoring it if it already exists
+func (l *GormLedger) ReceiveMessage(message Message) (bool, error) {
+	if message.ID == "" {
+		return true, nil
+	}
+	result := l.DB.Exec(
+		"INSERT INTO inbound_messages (message_id, sender, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		message.ID,
+		message.Sender,
+		time.Now(),
+	)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ForgetMessage deletes a message
+func (l *GormLedger) ForgetMessage(message Message) error {
+	if message.ID == "" {
+		return nil
+	}
+	return l.DB.Where("message_id = ?", message.ID).Delete(&InboundMessage{}).Error
+}
+
+// ProcessMessage sets when a message was processed if it hasn't been already, adding it
+// for messages from providers that aren't received through the ledger
+func (l *GormLedger) ProcessMessage(message Message) (bool, error) {
+	if message.ID == "" {
+		return true, nil
+	}
+	now := time.Now()
+	result := l.DB.Exec(
+		`INSERT INTO inbound_messages (message_id, sender, created_at, processed_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE SET processed_at = EXCLUDED.processed_at
+		WHERE inbound_messages.processed_at IS NULL`,
+		message.ID,
+		message.Sender,
+		now,
+		now,
+	)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseMessage clears when a message was processed
+func (l *GormLedger) ReleaseMessage(message Message) error {
+	if message.ID == "" {
+		return nil
+	}
+	return l.DB.Model(&InboundMessage{}).Where("message_id = ?", message.ID).Update("processed_at", nil).Error
+}
+
+// SaveReplies sets the replies column for a message
+func (l *GormLedger) SaveReplies(message Message, replies []Message) error {
+	if message.ID == "" {
+		return nil
+	}
+	repliesJSON, err := json.Marshal(replies)
+	if err != nil {
+		return err
+	}
+	return l.DB.Exec(
+		"UPDATE inbound_messages SET replies = ? WHERE message_id = ?",
+		postgres.Jsonb{RawMessage: repliesJSON},
+		message.ID,
+	).Error
+}
+
+// PendingReplies reads the replies column for a message
+func (l *GormLedger) PendingReplies(message Message) ([]Message, error) {
+	if message.ID == "" {
+		return nil, nil
+	}
+	var repliesJSON []byte
+	err := l.DB.Raw("SELECT replies FROM inbound_messages WHERE message_id = ?", message.ID).Row().Scan(&repliesJSON)
+	if err == sql.ErrNoRows || (err == nil && repliesJSON == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var replies []Message
+	err = json.Unmarshal(repliesJSON, &replies)
+	return replies, err
+}
+
+// ClearReplies sets the replies column for a message to null
+func (l *GormLedger) ClearReplies(message Message) error {
+	if message.ID == "" {
+		return nil
+	}
+	return l.DB.Exec("UPDATE inbound_messages SET replies = NULL WHERE message_id = ?", message.ID).Error
+}
+
+// ExpireMessages deletes messages received before a time
+func (l *GormLedger) ExpireMessages(before time.Time) (int64, error) {
+	result := l.DB.Where("created_at < ?", before).Delete(&InboundMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// MemoryLedger implements MessageLedger in memory
+type MemoryLedger struct {
+	messages map[string]InboundMessage
+	mutex    sync.Mutex
+}
+
+// NewMemoryLedger is a constructor for MemoryLedger structs
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{messages: map[string]InboundMessage{}}
+}
+
+// ReceiveMessage adds a message if it doesn't exist
+func (l *MemoryLedger) ReceiveMessage(message Message) (bool, error) {
+	if message.ID == "" {
+		return true, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.messages[message.ID]; ok {
+		return false, nil
+	}
+	l.messages[message.ID] = InboundMessage{MessageID: message.ID, Sender: message.Sender, CreatedAt: time.Now()}
+	return true, nil
+}
+
+// ForgetMessage removes a message
+func (l *MemoryLedger) ForgetMessage(message Message) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.messages, message.ID)
+	return nil
+}
+
+// ProcessMessage sets when a message was processed if it hasn't been already
+func (l *MemoryLedger) ProcessMessage(message Message) (bool, error) {
+	if message.ID == "" {
+		return true, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	entry, ok := l.messages[message.ID]
+	if !ok {
+		entry = InboundMessage{MessageID: message.ID, Sender: message.Sender, CreatedAt: now}
+	} else if entry.ProcessedAt != nil {
+		return false, nil
+	}
+	entry.ProcessedAt = &now
+	l.messages[message.ID] = entry
+	return true, nil
+}
+
+// ReleaseMessage clears when a message was processed
+func (l *MemoryLedger) ReleaseMessage(message Message) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if entry, ok := l.messages[message.ID]; ok {
+		entry.ProcessedAt = nil
+		l.messages[message.ID] = entry
+	}
+	return nil
+}
+
+// SaveReplies keeps the replies with a message
+func (l *MemoryLedger) SaveReplies(message Message, replies []Message) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if entry, ok := l.messages[message.ID]; ok {
+		entry.Replies = replies
+		l.messages[message.ID] = entry
+	}
+	return nil
+}
+
+// PendingReplies returns the replies kept with a message
+func (l *MemoryLedger) PendingReplies(message Message) ([]Message, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.messages[message.ID].Replies, nil
+}
+
+// ClearReplies removes the replies kept with a message
+func (l *MemoryLedger) ClearReplies(message Message) error {
+	return l.SaveReplies(message, nil)
+}
+
+// Removes all messages from a sender
+func (l *MemoryLedger) forgetSender(sender string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for id, entry := range l.messages {
+		if entry.Sender == sender {
+			delete(l.messages, id)
+		}
+	}
+}
+
+// ExpireMessages removes messages received before a time
+func (l *MemoryLedger) ExpireMessages(before time.Time) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var count int64
+	for id, entry := range l.messages {
+		if entry.CreatedAt.Before(before) {
+			delete(l.messages, id)
+			count++
+		}
+	}
+	return count, nil
+}
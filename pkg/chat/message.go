@@ -8,5 +8,53 @@ type Message struct {
 	Sender    string     `json:"sender"`
 	Recipient string     `json:"recipient"`
 	Body      string     `json:"body"`
+	Media     []Media    `json:"media,omitempty"`
+	Menu      *Menu      `json:"menu,omitempty"`
+	Template  *Template  `json:"template,omitempty"`
 	CreatedAt *time.Time `json:"created_at"`
+	// When the contact last messaged, used by channels that limit replies to a session
+	SessionStart *time.Time `json:"session_start,omitempty"`
+}
+
+// Media is an attachment sent or received along with a Message
+type Media struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+// Menu is a structured version of options included in a message body, used
+// for channels that can display options as lists or buttons
+type Menu struct {
+	Prompt  string   `json:"prompt"`
+	Button  string   `json:"button"`
+	Options []Option `json:"options"`
+	// Language of the prompt and labels, like "es"
+	Language string `json:"language,omitempty"`
+}
+
+// Option is a single choice in a Menu. Value is the reply that selects it
+type Option struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// Template is a pre-approved message for channels that restrict messages
+// sent outside of a session
+type Template struct {
+	ID        string            `json:"id"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// HasMedia returns whether any attachments are included in the message
+func (m *Message) HasMedia() bool {
+	return len(m.Media) > 0
+}
+
+// MediaURLs returns the URLs of all attachments in a message
+func (m *Message) MediaURLs() []string {
+	urls := []string{}
+	for _, media := range m.Media {
+		urls = append(urls, media.URL)
+	}
+	return urls
 }
@@ -0,0 +1,21 @@
+package chat
+
+import "time"
+
+// ContactData summarizes what's stored for a contact
+type ContactData struct {
+	Conversations int
+	Messages      int
+	FirstSeen     *time.Time
+	LastSeen      *time.Time
+}
+
+// DeletionAudit records that a contact's data was deleted at their request. It
+// doesn't include the contact or anything else that could identify them
+type DeletionAudit struct {
+	ID            uint `gorm:"primary_key"`
+	Channel       string
+	Conversations int
+	Messages      int
+	CreatedAt     time.Time
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Delivery statuses reported by providers
+const (
+	StatusQueued      = "queued"
+	StatusSent        = "sent"
+	StatusDelivered   = "delivered"
+	StatusUndelivered = "undelivered"
+	StatusFailed      = "failed"
+	StatusRead        = "read"
+)
+
+// Provider is an interface for a messaging channel that can receive messages
+// through webhooks and send replies
+type Provider interface {
+	// Capabilities describes the channel and what messages it can send
+	Capabilities() Capabilities
+	// VerifyWebhook checks that a webhook request was sent by the provider
+	VerifyWebhook(WebhookRequest) (bool, error)
+	// ParseWebhook converts an inbound webhook request into messages
+	ParseWebhook(WebhookRequest) ([]Message, error)
+	// WebhookResponse is the response body and content type to acknowledge a webhook
+	WebhookResponse() (string, string)
+	// SendMessage sends a message and returns the ID assigned by the provider
+	SendMessage(Message) (string, error)
+	// ParseStatusCallback converts a delivery status webhook request into statuses
+	ParseStatusCallback(WebhookRequest) ([]DeliveryStatus, error)
+}
+
+// Capabilities describes what a Provider's channel supports
+type Capabilities struct {
+	Channel   string
+	MaxLength int
+	Media     bool
+	Menus     bool
+	// How long after a contact's last message replies can be sent, if limited
+	SessionWindow time.Duration
+}
+
+// WebhookRequest is a provider-agnostic HTTP request received as a webhook
+type WebhookRequest struct {
+	// Full URL the request was sent to, including the query string
+	URL     string
+	Headers map[string]string
+	Query   url.Values
+	Body    string
+}
+
+// Header returns a header value ignoring the case of the name
+func (r *WebhookRequest) Header(name string) string {
+	if value, ok := r.Headers[name]; ok {
+		return value
+	}
+	for key, value := range r.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// DeliveryStatus is an update on whether a sent message reached its recipient. Providers set
+// Unreachable when their error code means the recipient can't receive messages
+type DeliveryStatus struct {
+	MessageID   string     `json:"message_id"`
+	Recipient   string     `json:"recipient"`
+	Status      string     `json:"status"`
+	ErrorCode   string     `json:"error_code,omitempty"`
+	Unreachable bool       `json:"unreachable,omitempty"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// SendError is returned by a Provider when it rejects a message
+type SendError struct {
+	Code        string
+	Message     string
+	Unreachable bool
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("Provider returned error code %s: %s", e.Code, e.Message)
+}
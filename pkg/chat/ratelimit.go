@@ -0,0 +1,312 @@
+package chat
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RateLimit is the result of taking a token for a contact's message
+type RateLimit int
+
+const (
+	// RateAllowed means the message can be handled
+	RateAllowed RateLimit = iota
+	// RateLimited means the contact just ran out of tokens and should be asked to slow down
+	RateLimited
+	// RateWarned means the contact is out of tokens and was already asked to slow down
+	RateWarned
+)
+
+// RateBucket is a contact's token bucket. Tokens are refilled over time up to the
+// policy's burst, and one is taken for each message received
+type RateBucket struct {
+	Contact   string `gorm:"primary_key"`
+	Tokens    float64
+	Warned    bool
+	UpdatedAt time.Time
+}
+
+// BlockedContact is a contact staff have blocked, whose messages are ignored
+type BlockedContact struct {
+	Contact   string    `gorm:"primary_key" json:"contact"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboundUsage counts the message segments sent in an hour
+type OutboundUsage struct {
+	Hour     time.Time `gorm:"primary_key"`
+	Segments int
+}
+
+// TableName sets the table for outbound usage
+func (OutboundUsage) TableName() string {
+	return "outbound_usage"
+}
+
+// RateLimitPolicy sets how many messages contacts can send and how many segments can
+// be sent in total each hour
+type RateLimitPolicy struct {
+	// Messages a contact can send at once before being limited
+	Burst int
+	// How often a contact gets another token
+	Refill time.Duration
+	// Segments that can be sent each hour across all contacts, or 0 for no limit
+	OutboundPerHour int
+}
+
+// NewRateLimitPolicy creates a RateLimitPolicy from RATE_LIMIT_BURST (10 by default),
+// RATE_LIMIT_REFILL (6s by default) and OUTBOUND_SEGMENTS_PER_HOUR (no limit by default)
+func NewRateLimitPolicy() RateLimitPolicy {
+	policy := RateLimitPolicy{Burst: 10, Refill: 6 * time.Second}
+	if burst, err := strconv.Atoi(os.Getenv("RATE_LIMIT_BURST")); err == nil {
+		policy.Burst = burst
+	}
+	if refill, err := time.ParseDuration(os.Getenv("RATE_LIMIT_REFILL")); err == nil {
+		policy.Refill = refill
+	}
+	policy.OutboundPerHour, _ = strconv.Atoi(os.Getenv("OUTBOUND_SEGMENTS_PER_HOUR"))
+	return policy
+}
+
+// take refills a bucket for the time since it was updated and takes a token if one is available
+func (p RateLimitPolicy) take(bucket *RateBucket, now time.Time) RateLimit {
+	if p.Refill > 0 && now.After(bucket.UpdatedAt) {
+		bucket.Tokens += float64(now.Sub(bucket.UpdatedAt)) / float64(p.Refill)
+	}
+	if bucket.Tokens > float64(p.Burst) {
+		bucket.Tokens = float64(p.Burst)
+	}
+	bucket.UpdatedAt = now
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		bucket.Warned = false
+		return RateAllowed
+	}
+	if bucket.Warned {
+		return RateWarned
+	}
+	bucket.Warned = true
+	return RateLimited
+}
+
+// RateLimiter limits how often contacts can message and how much can be sent, and keeps
+// the list of blocked contacts
+type RateLimiter interface {
+	// TakeToken takes a token from a contact's bucket for a message received at now
+	TakeToken(contact string, now time.Time) (RateLimit, error)
+	// ReserveOutbound adds segments to the total for now's hour, returning false without
+	// adding them if the total would be over the policy's limit
+	ReserveOutbound(segments int, now time.Time) (bool, error)
+	// ExpireBuckets removes buckets that haven't been updated since a time, returning the number removed
+	ExpireBuckets(before time.Time) (int64, error)
+	IsBlocked(contact string) (bool, error)
+	Block(contact, reason string) error
+	Unblock(contact string) error
+	BlockedContacts() ([]BlockedContact, error)
+}
+
+// GormRateLimiter implements RateLimiter in Postgres, so limits apply across functions
+type GormRateLimiter struct {
+	DB     *gorm.DB
+	Policy RateLimitPolicy
+}
+
+// NewGormRateLimiter is a constructor for GormRateLimiter structs
+func NewGormRateLimiter(db *gorm.DB, policy RateLimitPolicy) *GormRateLimiter {
+	return &GormRateLimiter{DB: db, Policy: policy}
+}
+
+// TakeToken locks a contact's bucket while taking a token, creating a full bucket for new contacts
+func (l *GormRateLimiter) TakeToken(contact string, now time.Time) (RateLimit, error) {
+	limit := RateAllowed
+	err := l.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"INSERT INTO rate_buckets (contact, tokens, warned, updated_at) VALUES (?, ?, FALSE, ?) ON CONFLICT DO NOTHING",
+			contact,
+			l.Policy.Burst,
+			now,
+		).Error
+		if err != nil {
+			return err
+		}
+		var bucket RateBucket
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("contact = ?", contact).First(&bucket).Error; err != nil {
+			return err
+		}
+		limit = l.Policy.take(&bucket, now)
+		return tx.Save(&bucket).Error
+	})
+	return limit, err
+}
+
+// ReserveOutbound adds segments to the hour's total if it stays under the limit
+func (l *GormRateLimiter) ReserveOutbound(segments int, now time.Time) (bool, error) {
+	if l.Policy.OutboundPerHour <= 0 {
+		return true, nil
+	}
+	hour := now.Truncate(time.Hour)
+	err := l.DB.Exec(
+		"INSERT INTO outbound_usage (hour, segments) VALUES (?, 0) ON CONFLICT DO NOTHING",
+		hour,
+	).Error
+	if err != nil {
+		return false, err
+	}
+	result := l.DB.Exec(
+		"UPDATE outbound_usage SET segments = segments + ? WHERE hour = ? AND segments + ? <= ?",
+		segments,
+		hour,
+		segments,
+		l.Policy.OutboundPerHour,
+	)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ExpireBuckets deletes buckets and outbound usage from before a time
+func (l *GormRateLimiter) ExpireBuckets(before time.Time) (int64, error) {
+	result := l.DB.Where("updated_at < ?", before).Delete(&RateBucket{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := l.DB.Where("hour < ?", before).Delete(&OutboundUsage{}).Error; err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+// IsBlocked returns whether a contact is on the block list
+func (l *GormRateLimiter) IsBlocked(contact string) (bool, error) {
+	var count int
+	err := l.DB.Model(&BlockedContact{}).Where("contact = ?", contact).Count(&count).Error
+	return count > 0, err
+}
+
+// Block adds a contact to the block list or updates the reason they're blocked
+func (l *GormRateLimiter) Block(contact, reason string) error {
+	return l.DB.Save(&BlockedContact{Contact: contact, Reason: reason, CreatedAt: time.Now()}).Error
+}
+
+// Unblock removes a contact from the block list
+func (l *GormRateLimiter) Unblock(contact string) error {
+	return l.DB.Where("contact = ?", contact).Delete(&BlockedContact{}).Error
+}
+
+// BlockedContacts returns the block list, most recently blocked first
+func (l *GormRateLimiter) BlockedContacts() ([]BlockedContact, error) {
+	var blocked []BlockedContact
+	err := l.DB.Order("created_at DESC").Find(&blocked).Error
+	return blocked, err
+}
+
+// MemoryRateLimiter implements RateLimiter in memory
+type MemoryRateLimiter struct {
+	Policy   RateLimitPolicy
+	buckets  map[string]RateBucket
+	blocked  map[string]BlockedContact
+	outbound map[time.Time]int
+	mutex    sync.Mutex
+}
+
+// NewMemoryRateLimiter is a constructor for MemoryRateLimiter structs
+func NewMemoryRateLimiter(policy RateLimitPolicy) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		Policy:   policy,
+		buckets:  map[string]RateBucket{},
+		blocked:  map[string]BlockedContact{},
+		outbound: map[time.Time]int{},
+	}
+}
+
+// TakeToken takes a token from a contact's bucket, creating a full bucket for new contacts
+func (l *MemoryRateLimiter) TakeToken(contact string, now time.Time) (RateLimit, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bucket, ok := l.buckets[contact]
+	if !ok {
+		bucket = RateBucket{Contact: contact, Tokens: float64(l.Policy.Burst), UpdatedAt: now}
+	}
+	limit := l.Policy.take(&bucket, now)
+	l.buckets[contact] = bucket
+	return limit, nil
+}
+
+// ReserveOutbound adds segments to the hour's total if it stays under the limit
+func (l *MemoryRateLimiter) ReserveOutbound(segments int, now time.Time) (bool, error) {
+	if l.Policy.OutboundPerHour <= 0 {
+		return true, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	hour := now.Truncate(time.Hour)
+	if l.outbound[hour]+segments > l.Policy.OutboundPerHour {
+		return false, nil
+	}
+	l.outbound[hour] += segments
+	return true, nil
+}
+
+// ExpireBuckets removes buckets and outbound usage from before a time
+func (l *MemoryRateLimiter) ExpireBuckets(before time.Time) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var count int64
+	for contact, bucket := range l.buckets {
+		if bucket.UpdatedAt.Before(before) {
+			delete(l.buckets, contact)
+			count++
+		}
+	}
+	for hour := range l.outbound {
+		if hour.Before(before) {
+			delete(l.outbound, hour)
+		}
+	}
+	return count, nil
+}
+
+// Removes a contact's bucket
+func (l *MemoryRateLimiter) forgetContact(contact string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.buckets, contact)
+}
+
+// IsBlocked returns whether a contact is on the block list
+func (l *MemoryRateLimiter) IsBlocked(contact string) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, ok := l.blocked[contact]
+	return ok, nil
+}
+
+// Block adds a contact to the block list
+func (l *MemoryRateLimiter) Block(contact, reason string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.blocked[contact] = BlockedContact{Contact: contact, Reason: reason, CreatedAt: time.Now()}
+	return nil
+}
+
+// Unblock removes a contact from the block list
+func (l *MemoryRateLimiter) Unblock(contact string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.blocked, contact)
+	return nil
+}
+
+// BlockedContacts returns copies of the blocked contacts
+func (l *MemoryRateLimiter) BlockedContacts() ([]BlockedContact, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	blocked := []BlockedContact{}
+	for _, contact := range l.blocked {
+		blocked = append(blocked, contact)
+	}
+	return blocked, nil
+}
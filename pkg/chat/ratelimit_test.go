@@ -0,0 +1,56 @@
+package chat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+func TestMemoryRateLimiterTakeToken(t *testing.T) {
+	limiter := chat.NewMemoryRateLimiter(chat.RateLimitPolicy{Burst: 2, Refill: time.Minute})
+	now := time.Now()
+
+	limits := []chat.RateLimit{}
+	for i := 0; i < 4; i++ {
+		limit, _ := limiter.TakeToken("+15555555555", now)
+		limits = append(limits, limit)
+	}
+	expected := []chat.RateLimit{chat.RateAllowed, chat.RateAllowed, chat.RateLimited, chat.RateWarned}
+	for idx := range expected {
+		if limits[idx] != expected[idx] {
+			t.Fatalf("Expected limits %v, got %v", expected, limits)
+		}
+	}
+	if limit, _ := limiter.TakeToken("+15555555556", now); limit != chat.RateAllowed {
+		t.Errorf("Other contact limited")
+	}
+
+	// Tokens refill over time, and contacts are warned again after running out again
+	if limit, _ := limiter.TakeToken("+15555555555", now.Add(time.Minute)); limit != chat.RateAllowed {
+		t.Errorf("Bucket not refilled")
+	}
+	if limit, _ := limiter.TakeToken("+15555555555", now.Add(time.Minute)); limit != chat.RateLimited {
+		t.Errorf("Contact not warned after running out again")
+	}
+	if limit, _ := limiter.TakeToken("+15555555555", now.Add(time.Hour)); limit != chat.RateAllowed {
+		t.Errorf("Bucket not refilled after an hour")
+	}
+}
+
+func TestMemoryRateLimiterReserveOutbound(t *testing.T) {
+	limiter := chat.NewMemoryRateLimiter(chat.RateLimitPolicy{OutboundPerHour: 5})
+	now := time.Date(2020, 4, 1, 12, 30, 0, 0, time.UTC)
+	if reserved, _ := limiter.ReserveOutbound(4, now); !reserved {
+		t.Errorf("Segments under limit not reserved")
+	}
+	if reserved, _ := limiter.ReserveOutbound(2, now); reserved {
+		t.Errorf("Segments over limit reserved")
+	}
+	if reserved, _ := limiter.ReserveOutbound(1, now); !reserved {
+		t.Errorf("Segments up to limit not reserved")
+	}
+	if reserved, _ := limiter.ReserveOutbound(2, now.Add(time.Hour)); !reserved {
+		t.Errorf("Limit not reset in the next hour")
+	}
+}
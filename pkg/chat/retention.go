@@ -0,0 +1,193 @@
+package chat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// PseudonymPrefix starts addresses that have been replaced with keyed hashes
+const PseudonymPrefix = "anon:"
+
+// Conversations are pseudonymized in batches so each transaction stays small
+const retentionBatchSize = 100
+
+// ErrMissingRetentionKey is returned when pseudonymization is enabled without a key
+var ErrMissingRetentionKey = errors.New("RETENTION_HASH_KEY is required to pseudonymize conversations")
+
+// RetentionPolicy removes personal data from inactive conversations. After PseudonymizeAfter,
+// contact addresses are replaced with keyed hashes and message bodies are removed, keeping
+// fields like state, language and delivery status for aggregate reporting. After DeleteAfter,
+// conversations and their messages are deleted. Either step is skipped if its duration is 0
+type RetentionPolicy struct {
+	PseudonymizeAfter time.Duration
+	DeleteAfter       time.Duration
+	Key               []byte
+}
+
+// RetentionResult counts the conversations changed by applying a policy
+type RetentionResult struct {
+	Pseudonymized int
+	Deleted       int64
+	// Unreachable contacts removed
+	Unreachable int64
+}
+
+// NewRetentionPolicy creates a RetentionPolicy from RETENTION_PSEUDONYMIZE_DAYS (30 by default),
+// RETENTION_DELETE_DAYS (365 by default) and RETENTION_HASH_KEY
+func NewRetentionPolicy() (*RetentionPolicy, error) {
+	policy := &RetentionPolicy{
+		PseudonymizeAfter: envDays("RETENTION_PSEUDONYMIZE_DAYS", 30),
+		DeleteAfter:       envDays("RETENTION_DELETE_DAYS", 365),
+		Key:               []byte(os.Getenv("RETENTION_HASH_KEY")),
+	}
+	if policy.PseudonymizeAfter > 0 && len(policy.Key) == 0 {
+		return nil, ErrMissingRetentionKey
+	}
+	return policy, nil
+}
+
+// PseudonymizeDays returns RETENTION_PSEUDONYMIZE_DAYS (30 by default), so the window can be
+// described to contacts without loading the rest of the policy
+func PseudonymizeDays() int {
+	return int(envDays("RETENTION_PSEUDONYMIZE_DAYS", 30) / (24 * time.Hour))
+}
+
+func envDays(name string, defaultDays int) time.Duration {
+	days, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		days = defaultDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Pseudonymize returns a keyed hash of an address. The same address always has the same
+// hash, so pseudonymized conversations from one contact can still be counted together
+func (p *RetentionPolicy) Pseudonymize(address string) string {
+	if address == "" || IsPseudonym(address) {
+		return address
+	}
+	mac := hmac.New(sha256.New, p.Key)
+	_, _ = mac.Write([]byte(address))
+	return PseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// IsPseudonym returns whether an address has already been replaced with a hash
+func IsPseudonym(address string) bool {
+	return len(address) > len(PseudonymPrefix) && address[:len(PseudonymPrefix)] == PseudonymPrefix
+}
+
+// PseudonymizeData replaces the contact ID in chat data and removes any stored messages
+func PseudonymizeData(data json.RawMessage, pseudonym string) (json.RawMessage, error) {
+	fields := map[string]interface{}{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+	fields["id"] = pseudonym
+	delete(fields, "messages")
+	return json.Marshal(fields)
+}
+
+// Apply pseudonymizes and deletes inactive conversations past the policy's windows
+func (p *RetentionPolicy) Apply(db *gorm.DB, now time.Time) (*RetentionResult, error) {
+	result := &RetentionResult{}
+	for p.PseudonymizeAfter > 0 {
+		var conversations []Conversation
+		err := db.Where(
+			"active IS FALSE AND pseudonymized_at IS NULL AND updated_at < ?",
+			now.Add(-p.PseudonymizeAfter),
+		).Limit(retentionBatchSize).Find(&conversations).Error
+		if err != nil {
+			return result, err
+		}
+		for idx := range conversations {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return p.pseudonymizeConversation(tx, &conversations[idx], now)
+			})
+			if err != nil {
+				return result, err
+			}
+			result.Pseudonymized++
+		}
+		if len(conversations) < retentionBatchSize {
+			break
+		}
+	}
+
+	// Unreachable contacts are kept by their address, so they're removed once addresses would
+	// be removed from conversations. A contact that's still unreachable is marked again
+	// the next time a message to them fails
+	if window := p.unreachableWindow(); window > 0 {
+		expired := db.Where("created_at < ?", now.Add(-window)).Delete(&UnreachableContact{})
+		if expired.Error != nil {
+			return result, expired.Error
+		}
+		result.Unreachable = expired.RowsAffected
+	}
+
+	if p.DeleteAfter > 0 {
+		// Messages are deleted along with conversations by the foreign key
+		deleted := db.Unscoped().Where(
+			"active IS FALSE AND updated_at < ?",
+			now.Add(-p.DeleteAfter),
+		).Delete(&Conversation{})
+		if deleted.Error != nil {
+			return result, deleted.Error
+		}
+		result.Deleted = deleted.RowsAffected
+	}
+	return result, nil
+}
+
+// Returns how long unreachable contacts are kept, the shortest window that's set
+func (p *RetentionPolicy) unreachableWindow() time.Duration {
+	if p.PseudonymizeAfter > 0 {
+		return p.PseudonymizeAfter
+	}
+	return p.DeleteAfter
+}
+
+// Replaces a conversation's contact address and removes message bodies. Columns are updated
+// without changing updated_at, so deletion is still based on when the contact was last active
+func (p *RetentionPolicy) pseudonymizeConversation(tx *gorm.DB, conversation *Conversation, now time.Time) error {
+	// Updating columns also sets them on the struct, so the original address is kept here
+	contact := conversation.Contact
+	pseudonym := p.Pseudonymize(contact)
+	data, err := PseudonymizeData(conversation.Data.RawMessage, pseudonym)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(conversation).UpdateColumns(map[string]interface{}{
+		"contact":          pseudonym,
+		"data":             postgres.Jsonb{RawMessage: data},
+		"pseudonymized_at": now,
+		"version":          gorm.Expr("version + 1"),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	messages := tx.Model(&MessageRecord{}).Where("conversation_id = ?", conversation.ID)
+	if contact != "" {
+		if err := messages.Where("sender = ?", contact).UpdateColumn("sender", pseudonym).Error; err != nil {
+			return err
+		}
+		if err := messages.Where("recipient = ?", contact).UpdateColumn("recipient", pseudonym).Error; err != nil {
+			return err
+		}
+	}
+	return messages.UpdateColumns(map[string]interface{}{
+		"body":  "",
+		"media": postgres.Jsonb{RawMessage: json.RawMessage("[]")},
+	}).Error
+}
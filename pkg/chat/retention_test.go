@@ -0,0 +1,105 @@
+package chat_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+func TestPseudonymize(t *testing.T) {
+	policy := &chat.RetentionPolicy{Key: []byte("key")}
+	pseudonym := policy.Pseudonymize("+15555555555")
+	if !chat.IsPseudonym(pseudonym) || strings.Contains(pseudonym, "5555555555") {
+		t.Errorf("Address not replaced with a hash: %s", pseudonym)
+	}
+	if policy.Pseudonymize("+15555555555") != pseudonym || policy.Pseudonymize(pseudonym) != pseudonym {
+		t.Errorf("Pseudonyms not stable for the same address")
+	}
+	otherKey := &chat.RetentionPolicy{Key: []byte("other")}
+	if otherKey.Pseudonymize("+15555555555") == pseudonym {
+		t.Errorf("Pseudonym not keyed")
+	}
+}
+
+func TestPseudonymizeData(t *testing.T) {
+	data, err := chat.PseudonymizeData(
+		json.RawMessage(`{"id":"+15555555555","language":"es","state":"results","messages":[{"body":"60601"}]}`),
+		"anon:abc",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+	if fields["id"] != "anon:abc" || fields["messages"] != nil {
+		t.Errorf("Contact and messages not removed: %s", data)
+	}
+	if fields["language"] != "es" || fields["state"] != "results" {
+		t.Errorf("Aggregate fields not kept: %s", data)
+	}
+}
+
+func TestNewRetentionPolicy(t *testing.T) {
+	os.Setenv("RETENTION_PSEUDONYMIZE_DAYS", "7")
+	os.Setenv("RETENTION_HASH_KEY", "")
+	defer os.Unsetenv("RETENTION_PSEUDONYMIZE_DAYS")
+	if _, err := chat.NewRetentionPolicy(); err != chat.ErrMissingRetentionKey {
+		t.Errorf("Expected error without a hash key, got %v", err)
+	}
+
+	os.Setenv("RETENTION_HASH_KEY", "key")
+	defer os.Unsetenv("RETENTION_HASH_KEY")
+	policy, err := chat.NewRetentionPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.PseudonymizeAfter != 7*24*time.Hour || policy.DeleteAfter != 365*24*time.Hour {
+		t.Errorf("Retention windows not set from environment: %v", policy)
+	}
+}
+
+func TestRetentionPolicyApply(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	gormDB, _ := gorm.Open("postgres", db)
+	policy := &chat.RetentionPolicy{PseudonymizeAfter: time.Hour, DeleteAfter: 2 * time.Hour, Key: []byte("key")}
+	pseudonym := policy.Pseudonymize("+15555555555")
+
+	dbMock.ExpectQuery(`SELECT (.+) FROM "conversations" WHERE (.+)pseudonymized_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "data"}).
+			AddRow(1, "+15555555555", []byte(`{"id":"+15555555555","state":"results"}`)))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "conversations" SET (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(`UPDATE "messages" SET "sender" (.+)`).
+		WithArgs(pseudonym, 1, "+15555555555").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(`UPDATE "messages" SET "recipient" (.+)`).
+		WithArgs(pseudonym, 1, "+15555555555").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(`UPDATE "messages" SET "body" (.+)`).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "unreachable_contacts" WHERE (.+)created_at <`).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`DELETE FROM "conversations" WHERE (.+)`).WillReturnResult(sqlmock.NewResult(0, 3))
+	dbMock.ExpectCommit()
+
+	result, err := policy.Apply(gormDB, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pseudonymized != 1 || result.Deleted != 3 || result.Unreachable != 2 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,475 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrConversationConflict is returned when saving a conversation that was updated or
+// deleted after it was loaded
+var ErrConversationConflict = errors.New("Conversation was updated after it was loaded")
+
+// ConversationStore loads and saves conversations and their transcripts
+type ConversationStore interface {
+	// ActiveConversation returns the latest active conversation for a contact, or nil if there isn't one
+	ActiveConversation(contact string) (*Conversation, error)
+	// SaveConversation creates a conversation or updates it if its version hasn't changed,
+	// returning ErrConversationConflict if it has
+	SaveConversation(*Conversation) error
+	// SaveMessage adds a message to a conversation's transcript, ignoring messages with
+	// a provider ID that's already been saved in the same direction
+	SaveMessage(*MessageRecord) error
+	// ConversationMessages returns a conversation's transcript in the order messages were saved
+	ConversationMessages(conversationID uint) ([]MessageRecord, error)
+	// ContactData summarizes all conversations and messages stored for a contact
+	ContactData(contact string) (*ContactData, error)
+	// DeleteContactData deletes all conversations and messages for a contact, including
+	// inactive ones, along with their ledger entries, rate limit bucket and unreachable
+	// status, and records a deletion audit. It returns what was deleted
+	DeleteContactData(contact, channel string) (*ContactData, error)
+	// UpdateMessageStatus sets the delivery status of an outbound message by its provider ID,
+	// unless the message already has a later status
+	UpdateMessageStatus(DeliveryStatus) error
+	// MarkUnreachable records that messages can't be delivered to a contact
+	MarkUnreachable(contact, errorCode string) error
+	// ClearUnreachable removes a contact from the unreachable contacts
+	ClearUnreachable(contact string) error
+	IsUnreachable(contact string) (bool, error)
+}
+
+// GormStore implements ConversationStore in Postgres
+type GormStore struct {
+	DB *gorm.DB
+}
+
+// NewGormStore is a constructor for GormStore structs
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{DB: db}
+}
+
+// ActiveConversation returns the latest active conversation for a contact, or nil if there isn't one
+func (s *GormStore) ActiveConversation(contact string) (*Conversation, error) {
+	var conversation Conversation
+	err := s.DB.Model(&Conversation{}).Where("contact = ? AND active IS TRUE", contact).Last(&conversation).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// SaveConversation creates a conversation or updates it where the version matches
+func (s *GormStore) SaveConversation(conversation *Conversation) error {
+	if conversation.ID == 0 {
+		conversation.Version = 1
+		return s.DB.Create(conversation).Error
+	}
+	version := conversation.Version
+	result := s.DB.Model(conversation).Where("version = ?", version).Updates(map[string]interface{}{
+		"active":   conversation.Active,
+		"channel":  conversation.Channel,
+		"contact":  conversation.Contact,
+		"tenant":   conversation.Tenant,
+		"state":    conversation.State,
+		"language": conversation.Language,
+		"data":     conversation.Data,
+		"version":  version + 1,
+	})
+	if result.Error == nil && result.RowsAffected == 0 {
+		conversation.Version = version
+		return ErrConversationConflict
+	}
+	return result.Error
+}
+
+// SaveMessage creates a message record if it doesn't already exist
+func (s *GormStore) SaveMessage(record *MessageRecord) error {
+	if record.ProviderID != "" {
+		var existing MessageRecord
+		err := s.DB.Where(
+			"conversation_id = ? AND direction = ? AND provider_id = ?",
+			record.ConversationID,
+			record.Direction,
+			record.ProviderID,
+		).First(&existing).Error
+		if err == nil {
+			record.ID = existing.ID
+			return nil
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+	}
+	return s.DB.Create(record).Error
+}
+
+// ConversationMessages returns the message records for a conversation
+func (s *GormStore) ConversationMessages(conversationID uint) ([]MessageRecord, error) {
+	var records []MessageRecord
+	err := s.DB.Where("conversation_id = ?", conversationID).Order("id").Find(&records).Error
+	return records, err
+}
+
+// ContactData counts the conversations and messages for a contact, including soft deleted ones
+func (s *GormStore) ContactData(contact string) (*ContactData, error) {
+	var data struct {
+		Conversations int
+		FirstSeen     *time.Time
+		LastSeen      *time.Time
+	}
+	err := s.DB.Unscoped().Model(&Conversation{}).
+		Select("COUNT(*) AS conversations, MIN(created_at) AS first_seen, MAX(updated_at) AS last_seen").
+		Where("contact = ?", contact).
+		Scan(&data).Error
+	if err != nil {
+		return nil, err
+	}
+	var messages int
+	err = s.DB.Model(&MessageRecord{}).
+		Where("conversation_id IN ?", s.DB.Unscoped().Model(&Conversation{}).Select("id").Where("contact = ?", contact).SubQuery()).
+		Count(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ContactData{
+		Conversations: data.Conversations,
+		Messages:      messages,
+		FirstSeen:     data.FirstSeen,
+		LastSeen:      data.LastSeen,
+	}, nil
+}
+
+// DeleteContactData permanently deletes a contact's conversations, messages, inbound
+// message ledger entries, unreachable status and rate limit bucket in one transaction
+func (s *GormStore) DeleteContactData(contact, channel string) (*ContactData, error) {
+	data, err := s.ContactData(contact)
+	if err != nil {
+		return nil, err
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		conversationIDs := tx.Unscoped().Model(&Conversation{}).Select("id").Where("contact = ?", contact).SubQuery()
+		if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(&MessageRecord{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("contact = ?", contact).Delete(&Conversation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sender = ?", contact).Delete(&InboundMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact = ?", contact).Delete(&UnreachableContact{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact = ?", contact).Delete(&RateBucket{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DeletionAudit{
+			Channel:       channel,
+			Conversations: data.Conversations,
+			Messages:      data.Messages,
+		}).Error
+	})
+	return data, err
+}
+
+// UpdateMessageStatus updates the status and error code of an outbound message record
+func (s *GormStore) UpdateMessageStatus(status DeliveryStatus) error {
+	var record MessageRecord
+	err := s.DB.Where(
+		"direction = ? AND provider_id = ?",
+		DirectionOutbound,
+		status.MessageID,
+	).Last(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !IsLaterStatus(record.Status, status.Status) {
+		return nil
+	}
+	return s.DB.Model(&record).Updates(map[string]interface{}{
+		"status":     status.Status,
+		"error_code": status.ErrorCode,
+	}).Error
+}
+
+// MarkUnreachable creates or updates an unreachable contact
+func (s *GormStore) MarkUnreachable(contact, errorCode string) error {
+	return s.DB.Save(&UnreachableContact{Contact: contact, ErrorCode: errorCode, CreatedAt: time.Now()}).Error
+}
+
+// ClearUnreachable deletes an unreachable contact if it exists
+func (s *GormStore) ClearUnreachable(contact string) error {
+	return s.DB.Where("contact = ?", contact).Delete(&UnreachableContact{}).Error
+}
+
+// IsUnreachable returns whether a contact has been marked unreachable
+func (s *GormStore) IsUnreachable(contact string) (bool, error) {
+	var count int
+	err := s.DB.Model(&UnreachableContact{}).Where("contact = ?", contact).Count(&count).Error
+	return count > 0, err
+}
+
+// MemoryStore implements ConversationStore in memory for running without a database.
+// If Path is set, conversations are saved to a JSON file so they persist between restarts.
+// Ledger and Limiter are the in-memory ledger and rate limiter used alongside the store, so
+// a contact's entries in them are deleted with the rest of their data
+type MemoryStore struct {
+	Path          string
+	Ledger        *MemoryLedger
+	Limiter       *MemoryRateLimiter
+	conversations []Conversation
+	messages      []MessageRecord
+	deletions     []DeletionAudit
+	unreachable   map[string]UnreachableContact
+	mutex         sync.Mutex
+}
+
+// Format of the file conversations are saved in
+type memoryStoreFile struct {
+	Conversations []Conversation       `json:"conversations"`
+	Messages      []MessageRecord      `json:"messages"`
+	Unreachable   []UnreachableContact `json:"unreachable,omitempty"`
+}
+
+// NewMemoryStore is a constructor for MemoryStore structs, loading conversations from path if it exists
+func NewMemoryStore(path string) (*MemoryStore, error) {
+	store := &MemoryStore{Path: path, unreachable: map[string]UnreachableContact{}}
+	if path == "" {
+		return store, nil
+	}
+	storeJSON, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var storeFile memoryStoreFile
+	if err := json.Unmarshal(storeJSON, &storeFile); err != nil {
+		return nil, err
+	}
+	store.conversations = storeFile.Conversations
+	store.messages = storeFile.Messages
+	for _, unreachable := range storeFile.Unreachable {
+		store.unreachable[unreachable.Contact] = unreachable
+	}
+	return store, nil
+}
+
+// ActiveConversation returns a copy of the latest active conversation for a contact
+func (s *MemoryStore) ActiveConversation(contact string) (*Conversation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for idx := len(s.conversations) - 1; idx >= 0; idx-- {
+		conversation := s.conversations[idx]
+		if conversation.Active && conversation.Contact == contact {
+			return &conversation, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveConversation creates a conversation, assigning it an ID, or updates it if the version matches
+func (s *MemoryStore) SaveConversation(conversation *Conversation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if conversation.ID == 0 {
+		// Conversations are created active by the database default
+		conversation.ID = uint(len(s.conversations) + 1)
+		conversation.CreatedAt = now
+		conversation.UpdatedAt = now
+		conversation.Active = true
+		conversation.Version = 1
+		if conversation.Channel == "" {
+			conversation.Channel = "sms"
+		}
+		s.conversations = append(s.conversations, *conversation)
+	} else if int(conversation.ID) <= len(s.conversations) {
+		if s.conversations[conversation.ID-1].Version != conversation.Version {
+			return ErrConversationConflict
+		}
+		conversation.UpdatedAt = now
+		conversation.Version++
+		s.conversations[conversation.ID-1] = *conversation
+	}
+	return s.save()
+}
+
+// SaveMessage adds a message record if it doesn't already exist, assigning it an ID
+func (s *MemoryStore) SaveMessage(record *MessageRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, existing := range s.messages {
+		if record.ProviderID != "" &&
+			existing.ConversationID == record.ConversationID &&
+			existing.Direction == record.Direction &&
+			existing.ProviderID == record.ProviderID {
+			record.ID = existing.ID
+			return nil
+		}
+	}
+	now := time.Now()
+	record.ID = 1
+	if count := len(s.messages); count > 0 {
+		record.ID = s.messages[count-1].ID + 1
+	}
+	record.UpdatedAt = now
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	s.messages = append(s.messages, *record)
+	return s.save()
+}
+
+// ConversationMessages returns copies of the message records for a conversation
+func (s *MemoryStore) ConversationMessages(conversationID uint) ([]MessageRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	records := []MessageRecord{}
+	for _, record := range s.messages {
+		if record.ConversationID == conversationID {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// ContactData counts the conversations and messages for a contact
+func (s *MemoryStore) ContactData(contact string) (*ContactData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.contactData(contact), nil
+}
+
+func (s *MemoryStore) contactData(contact string) *ContactData {
+	data := &ContactData{}
+	conversationIDs := map[uint]bool{}
+	for idx := range s.conversations {
+		conversation := s.conversations[idx]
+		if conversation.Contact != contact {
+			continue
+		}
+		conversationIDs[conversation.ID] = true
+		data.Conversations++
+		if data.FirstSeen == nil || conversation.CreatedAt.Before(*data.FirstSeen) {
+			data.FirstSeen = &conversation.CreatedAt
+		}
+		if data.LastSeen == nil || conversation.UpdatedAt.After(*data.LastSeen) {
+			data.LastSeen = &conversation.UpdatedAt
+		}
+	}
+	for _, record := range s.messages {
+		if conversationIDs[record.ConversationID] {
+			data.Messages++
+		}
+	}
+	return data
+}
+
+// DeleteContactData removes a contact's conversations, messages, unreachable status, and
+// ledger entries and rate limit bucket if Ledger and Limiter are set. Conversations are
+// replaced with empty inactive ones, since IDs are positions in the list
+func (s *MemoryStore) DeleteContactData(contact, channel string) (*ContactData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data := s.contactData(contact)
+	conversationIDs := map[uint]bool{}
+	for idx, conversation := range s.conversations {
+		if conversation.Contact == contact {
+			conversationIDs[conversation.ID] = true
+			s.conversations[idx] = Conversation{}
+			s.conversations[idx].ID = conversation.ID
+		}
+	}
+	messages := []MessageRecord{}
+	for _, record := range s.messages {
+		if !conversationIDs[record.ConversationID] {
+			messages = append(messages, record)
+		}
+	}
+	s.messages = messages
+	delete(s.unreachable, contact)
+	if s.Ledger != nil {
+		s.Ledger.forgetSender(contact)
+	}
+	if s.Limiter != nil {
+		s.Limiter.forgetContact(contact)
+	}
+	s.deletions = append(s.deletions, DeletionAudit{
+		ID:            uint(len(s.deletions) + 1),
+		Channel:       channel,
+		Conversations: data.Conversations,
+		Messages:      data.Messages,
+		CreatedAt:     time.Now(),
+	})
+	return data, s.save()
+}
+
+// UpdateMessageStatus updates the status and error code of the latest outbound message record
+// with the status's message ID
+func (s *MemoryStore) UpdateMessageStatus(status DeliveryStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for idx := len(s.messages) - 1; idx >= 0; idx-- {
+		record := &s.messages[idx]
+		if record.Direction != DirectionOutbound || record.ProviderID != status.MessageID {
+			continue
+		}
+		if !IsLaterStatus(record.Status, status.Status) {
+			return nil
+		}
+		record.Status = status.Status
+		record.ErrorCode = status.ErrorCode
+		record.UpdatedAt = time.Now()
+		return s.save()
+	}
+	return nil
+}
+
+// MarkUnreachable adds or updates an unreachable contact
+func (s *MemoryStore) MarkUnreachable(contact, errorCode string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unreachable[contact] = UnreachableContact{Contact: contact, ErrorCode: errorCode, CreatedAt: time.Now()}
+	return s.save()
+}
+
+// ClearUnreachable removes an unreachable contact
+func (s *MemoryStore) ClearUnreachable(contact string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.unreachable, contact)
+	return s.save()
+}
+
+// IsUnreachable returns whether a contact has been marked unreachable
+func (s *MemoryStore) IsUnreachable(contact string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.unreachable[contact]
+	return ok, nil
+}
+
+// Writes all conversations, messages and unreachable contacts to the store's file if it has one
+func (s *MemoryStore) save() error {
+	if s.Path == "" {
+		return nil
+	}
+	storeFile := memoryStoreFile{Conversations: s.conversations, Messages: s.messages}
+	for _, unreachable := range s.unreachable {
+		storeFile.Unreachable = append(storeFile.Unreachable, unreachable)
+	}
+	storeJSON, err := json.Marshal(storeFile)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, storeJSON, 0600)
+}
@@ -0,0 +1,240 @@
+package chat_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+func conversationFor(contact string) *chat.Conversation {
+	data, _ := json.Marshal(chat.Chat{ContactID: contact})
+	return &chat.Conversation{Contact: contact, Data: postgres.Jsonb{RawMessage: json.RawMessage(data)}}
+}
+
+func TestMemoryStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "store")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conversations.json")
+
+	store, _ := chat.NewMemoryStore(path)
+	if conversation, _ := store.ActiveConversation("+15555555555"); conversation != nil {
+		t.Errorf("Conversation returned for new contact")
+	}
+	conversation := conversationFor("+15555555555")
+	_ = store.SaveConversation(conversation)
+	_ = store.SaveConversation(conversationFor("+15555555556"))
+	if conversation.ID != 1 || !conversation.Active {
+		t.Errorf("New conversation not assigned an ID and set active")
+	}
+
+	// Conversations are reloaded from the file
+	store, _ = chat.NewMemoryStore(path)
+	active, err := store.ActiveConversation("+15555555555")
+	if err != nil || active == nil || active.ID != 1 {
+		t.Fatalf("Saved conversation not loaded from file")
+	}
+	active.Active = false
+	_ = store.SaveConversation(active)
+	if conversation, _ := store.ActiveConversation("+15555555555"); conversation != nil {
+		t.Errorf("Inactive conversation returned")
+	}
+}
+
+func TestMemoryLedger(t *testing.T) {
+	ledger := chat.NewMemoryLedger()
+	message := chat.Message{ID: "SM123", Sender: "+15555555555", Body: "1"}
+
+	if isNew, _ := ledger.ReceiveMessage(message); !isNew {
+		t.Errorf("New message not received")
+	}
+	if isNew, _ := ledger.ReceiveMessage(message); isNew {
+		t.Errorf("Retried webhook received again")
+	}
+	if isNew, _ := ledger.ProcessMessage(message); !isNew {
+		t.Errorf("Received message not processed")
+	}
+	if isNew, _ := ledger.ProcessMessage(message); isNew {
+		t.Errorf("Duplicate event processed again")
+	}
+	_ = ledger.ReleaseMessage(message)
+	if isNew, _ := ledger.ProcessMessage(message); !isNew {
+		t.Errorf("Released message not processed")
+	}
+	if isNew, _ := ledger.ProcessMessage(chat.Message{}); !isNew {
+		t.Errorf("Message without an ID not processed")
+	}
+
+	_ = ledger.SaveReplies(message, []chat.Message{{Body: "reply"}})
+	if replies, _ := ledger.PendingReplies(message); len(replies) != 1 {
+		t.Errorf("Saved replies not pending")
+	}
+	_ = ledger.ClearReplies(message)
+	if replies, _ := ledger.PendingReplies(message); len(replies) != 0 {
+		t.Errorf("Cleared replies still pending")
+	}
+
+	if expired, _ := ledger.ExpireMessages(time.Now().Add(time.Minute)); expired != 1 {
+		t.Errorf("Expected 1 message expired, got %d", expired)
+	}
+	if isNew, _ := ledger.ReceiveMessage(message); !isNew {
+		t.Errorf("Expired message not received")
+	}
+}
+
+func TestMemoryStoreMessages(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	conversation := conversationFor("+15555555555")
+	_ = store.SaveConversation(conversation)
+
+	message := chat.Message{ID: "SM1", Sender: "+15555555555", Body: "hi"}
+	_ = store.SaveMessage(chat.NewMessageRecord(conversation.ID, chat.DirectionInbound, message))
+	_ = store.SaveMessage(chat.NewMessageRecord(conversation.ID, chat.DirectionInbound, message))
+	_ = store.SaveMessage(chat.NewMessageRecord(conversation.ID, chat.DirectionOutbound, chat.Message{Body: "reply"}))
+	_ = store.SaveMessage(chat.NewMessageRecord(conversation.ID+1, chat.DirectionInbound, message))
+
+	records, _ := store.ConversationMessages(conversation.ID)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 messages in transcript, got %d", len(records))
+	}
+	if records[0].Message().Body != "hi" || records[1].Direction != chat.DirectionOutbound {
+		t.Errorf("Transcript not returned in order: %v", records)
+	}
+}
+
+func TestMemoryStoreUnreachable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "store")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conversations.json")
+
+	store, _ := chat.NewMemoryStore(path)
+	_ = store.MarkUnreachable("+15555555555", "30006")
+	store, _ = chat.NewMemoryStore(path)
+	if unreachable, _ := store.IsUnreachable("+15555555555"); !unreachable {
+		t.Errorf("Unreachable contact not reloaded from file")
+	}
+	if unreachable, _ := store.IsUnreachable("+15555555556"); unreachable {
+		t.Errorf("Other contact marked unreachable")
+	}
+	_ = store.ClearUnreachable("+15555555555")
+	if unreachable, _ := store.IsUnreachable("+15555555555"); unreachable {
+		t.Errorf("Unreachable contact not cleared")
+	}
+}
+
+func TestMemoryStoreDeleteContactData(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	store.Ledger = chat.NewMemoryLedger()
+	store.Limiter = chat.NewMemoryRateLimiter(chat.RateLimitPolicy{Burst: 1, Refill: time.Hour})
+	conversation := conversationFor("+15555555555")
+	_ = store.SaveConversation(conversation)
+	message := chat.Message{ID: "SM1", Sender: "+15555555555", Body: "hi"}
+	_ = store.SaveMessage(chat.NewMessageRecord(conversation.ID, chat.DirectionInbound, message))
+	_ = store.MarkUnreachable("+15555555555", "30006")
+	_, _ = store.Ledger.ReceiveMessage(message)
+	_, _ = store.Ledger.ReceiveMessage(chat.Message{ID: "SM2", Sender: "+15555555556"})
+	now := time.Now()
+	_, _ = store.Limiter.TakeToken("+15555555555", now)
+
+	data, err := store.DeleteContactData("+15555555555", "sms")
+	if err != nil || data.Conversations != 1 || data.Messages != 1 {
+		t.Fatalf("Deleted data not returned: %v %v", data, err)
+	}
+	if unreachable, _ := store.IsUnreachable("+15555555555"); unreachable {
+		t.Errorf("Unreachable status not deleted")
+	}
+	if isNew, _ := store.Ledger.ReceiveMessage(message); !isNew {
+		t.Errorf("Ledger entry not deleted")
+	}
+	if isNew, _ := store.Ledger.ReceiveMessage(chat.Message{ID: "SM2", Sender: "+15555555556"}); isNew {
+		t.Errorf("Other contact's ledger entry deleted")
+	}
+	if limit, _ := store.Limiter.TakeToken("+15555555555", now); limit != chat.RateAllowed {
+		t.Errorf("Rate limit bucket not deleted")
+	}
+}
+
+func TestIsLaterStatus(t *testing.T) {
+	if !chat.IsLaterStatus("", chat.StatusSent) || !chat.IsLaterStatus(chat.StatusSent, chat.StatusDelivered) {
+		t.Errorf("Later status not applied")
+	}
+	if chat.IsLaterStatus(chat.StatusUndelivered, chat.StatusSent) || chat.IsLaterStatus(chat.StatusRead, chat.StatusDelivered) {
+		t.Errorf("Earlier status replaced later one")
+	}
+}
+
+func TestMemoryStoreConversationConflict(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	_ = store.SaveConversation(conversationFor("+15555555555"))
+
+	first, _ := store.ActiveConversation("+15555555555")
+	second, _ := store.ActiveConversation("+15555555555")
+	first.State = "results"
+	if err := store.SaveConversation(first); err != nil || first.Version != 2 {
+		t.Fatalf("Conversation not saved with next version: %v", err)
+	}
+	second.State = "zip"
+	if err := store.SaveConversation(second); err != chat.ErrConversationConflict {
+		t.Errorf("Expected conflict saving stale conversation, got %v", err)
+	}
+	if active, _ := store.ActiveConversation("+15555555555"); active.State != "results" {
+		t.Errorf("Stale conversation overwrote update")
+	}
+}
+
+func TestGormStoreConversationConflict(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	gormDB, _ := gorm.Open("postgres", db)
+	store := chat.NewGormStore(gormDB)
+	conversation := conversationFor("+15555555555")
+	conversation.ID = 1
+	conversation.Version = 3
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "conversations" SET (.+) WHERE (.+)version = \$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+	if err := store.SaveConversation(conversation); err != chat.ErrConversationConflict || conversation.Version != 3 {
+		t.Errorf("Expected conflict when no rows updated, got %v", err)
+	}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`UPDATE "conversations" SET (.+) WHERE (.+)version = \$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	if err := store.SaveConversation(conversation); err != nil || conversation.Version != 4 {
+		t.Errorf("Conversation not updated to next version: %v", err)
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGormStoreReadErrors(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	gormDB, _ := gorm.Open("postgres", db)
+	store := chat.NewGormStore(gormDB)
+
+	dbMock.ExpectQuery(`SELECT (.+) FROM "conversations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if conversation, err := store.ActiveConversation("+15555555555"); conversation != nil || err != nil {
+		t.Errorf("Missing conversation not returned as nil: %v", err)
+	}
+	dbMock.ExpectQuery(`SELECT (.+) FROM "conversations"`).WillReturnError(errors.New("connection reset"))
+	if conversation, err := store.ActiveConversation("+15555555555"); conversation != nil || err == nil {
+		t.Errorf("Database error not returned loading conversation")
+	}
+	dbMock.ExpectQuery(`SELECT (.+) FROM "messages"`).WillReturnError(errors.New("connection reset"))
+	if err := store.UpdateMessageStatus(chat.DeliveryStatus{MessageID: "SM1", Status: "delivered"}); err == nil {
+		t.Errorf("Database error not returned updating status")
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
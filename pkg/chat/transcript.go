@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// DirectionInbound is the direction of messages received from a contact
+const DirectionInbound = "inbound"
+
+// DirectionOutbound is the direction of messages sent to a contact
+const DirectionOutbound = "outbound"
+
+// MessageRecord is a message in a conversation's transcript
+type MessageRecord struct {
+	ID             uint   `gorm:"primary_key" json:"id"`
+	ConversationID uint   `gorm:"index" json:"conversation_id"`
+	Direction      string `json:"direction"`
+	// The message ID assigned by the provider, like Twilio's MessageSid
+	ProviderID string         `gorm:"index" json:"provider_id"`
+	Sender     string         `json:"sender"`
+	Recipient  string         `json:"recipient"`
+	Body       string         `json:"body"`
+	Media      postgres.Jsonb `json:"media"`
+	// The state of the chat when the message was received or sent
+	State     string    `json:"state"`
+	Segments  int       `json:"segments"`
+	Status    string    `json:"status"`
+	ErrorCode string    `json:"error_code"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName sets the table for message records
+func (MessageRecord) TableName() string {
+	return "messages"
+}
+
+// NewMessageRecord is a constructor for MessageRecord structs
+func NewMessageRecord(conversationID uint, direction string, message Message) *MessageRecord {
+	media := message.Media
+	if media == nil {
+		media = []Media{}
+	}
+	mediaJSON, _ := json.Marshal(media)
+	record := &MessageRecord{
+		ConversationID: conversationID,
+		Direction:      direction,
+		ProviderID:     message.ID,
+		Sender:         message.Sender,
+		Recipient:      message.Recipient,
+		Body:           message.Body,
+		Media:          postgres.Jsonb{RawMessage: json.RawMessage(mediaJSON)},
+	}
+	if message.CreatedAt != nil {
+		record.CreatedAt = *message.CreatedAt
+	}
+	return record
+}
+
+// Message returns the message a record was created from
+func (r *MessageRecord) Message() Message {
+	var media []Media
+	_ = json.Unmarshal(r.Media.RawMessage, &media)
+	createdAt := r.CreatedAt
+	return Message{
+		ID:        r.ProviderID,
+		Sender:    r.Sender,
+		Recipient: r.Recipient,
+		Body:      r.Body,
+		Media:     media,
+		CreatedAt: &createdAt,
+	}
+}
@@ -0,0 +1,95 @@
+package directory
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ResourceVersion identifies the resources loaded from a source, like the ETag of an S3 object
+type ResourceVersion struct {
+	Source       string
+	ETag         string
+	LastModified time.Time
+}
+
+// ResourceSet is a list of resources and the index for searching them
+type ResourceSet struct {
+	Resources []Resource
+	Index     *ResourceIndex
+	// Hash of the JSON the resources were loaded from, if they were published with an index
+	Hash string
+}
+
+// Loads resources and their version from a source. If since is set and the resources
+// haven't changed, it returns a nil set and the same version. The index is optional
+type resourceLoader func(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error)
+
+// ResourceCache keeps resources in memory so they're reused across warm Lambda invocations,
+// checking whether they changed at most once every Interval
+type ResourceCache struct {
+	Interval  time.Duration
+	set       *ResourceSet
+	version   *ResourceVersion
+	checkedAt time.Time
+	mutex     sync.Mutex
+}
+
+// NewResourceCache is a constructor for ResourceCache structs
+func NewResourceCache(interval time.Duration) *ResourceCache {
+	return &ResourceCache{Interval: interval}
+}
+
+// Resources returns the cached resources for a source, loading them if they haven't been
+// loaded or the interval has passed. The slice is shared and shouldn't be modified
+func (c *ResourceCache) Resources(source string, load resourceLoader) ([]Resource, error) {
+	set, err := c.ResourceSet(source, load)
+	if err != nil {
+		return nil, err
+	}
+	return set.Resources, nil
+}
+
+// ResourceSet returns the cached resources and index for a source, loading them if they
+// haven't been loaded or the interval has passed. If checking for changes fails, the
+// cached resources are returned. Indexes are built for loaded resources without one
+func (c *ResourceCache) ResourceSet(source string, load resourceLoader) (*ResourceSet, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	since := c.version
+	if since != nil && since.Source != source {
+		since = nil
+	}
+	if since != nil && time.Since(c.checkedAt) < c.Interval {
+		return c.set, nil
+	}
+
+	set, version, err := load(since)
+	if err != nil {
+		if since != nil {
+			log.Printf("Using cached resources from %s: %v", since.Source, err)
+			return c.set, nil
+		}
+		return nil, err
+	}
+	c.checkedAt = time.Now()
+	if since == nil || set != nil {
+		if set.Index == nil || !set.Index.Matches(set) {
+			set.Index = BuildResourceIndex(set.Resources)
+			set.Index.Hash = set.Hash
+		}
+		c.set = set
+		c.version = version
+	}
+	return c.set, nil
+}
+
+// Returns a duration from an environment variable like "30s", or a default if it isn't set
+func envDuration(name string, defaultDuration time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return defaultDuration
+	}
+	return duration
+}
@@ -0,0 +1,88 @@
+package directory
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResourceCacheRevalidates(t *testing.T) {
+	cache := NewResourceCache(time.Hour)
+	loads := 0
+	var loadErr error
+	load := func(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error) {
+		loads++
+		if loadErr != nil {
+			return nil, nil, loadErr
+		}
+		if since != nil {
+			return nil, since, nil
+		}
+		return &ResourceSet{Resources: []Resource{{ID: "1"}}}, &ResourceVersion{Source: "test", ETag: "a"}, nil
+	}
+
+	_, _ = cache.Resources("test", load)
+	resources, _ := cache.Resources("test", load)
+	if loads != 1 || len(resources) != 1 {
+		t.Errorf("Resources loaded again within interval")
+	}
+
+	// Unchanged resources are kept after revalidating, and also if revalidating fails
+	cache.Interval = 0
+	resources, _ = cache.Resources("test", load)
+	if loads != 2 || len(resources) != 1 {
+		t.Errorf("Unchanged resources not kept after revalidating")
+	}
+	loadErr = errors.New("Unavailable")
+	if resources, err := cache.Resources("test", load); err != nil || len(resources) != 1 {
+		t.Errorf("Cached resources not returned when revalidating fails")
+	}
+	if _, err := cache.Resources("other", load); err == nil {
+		t.Errorf("Resources from another source returned")
+	}
+}
+
+func TestResourceCacheRebuildsStaleIndex(t *testing.T) {
+	resources := []Resource{{ID: "1", Category: []string{"Food"}}}
+	stale := BuildResourceIndex([]Resource{{ID: "1", Category: []string{"Housing"}}})
+	stale.Hash = "previous"
+	load := func(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error) {
+		return &ResourceSet{Resources: resources, Index: stale, Hash: "latest"}, &ResourceVersion{Source: "test"}, nil
+	}
+	set, err := NewResourceCache(time.Hour).ResourceSet("test", load)
+	if err != nil || set.Index == stale || set.Index.Hash != "latest" || len(set.Index.Categories["Food"]) != 1 {
+		t.Errorf("Index published for other resources with the same IDs not rebuilt")
+	}
+}
+
+func TestFileResourceLoader(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "resources")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "resources.json")
+	_ = ioutil.WriteFile(path, []byte(`[{"Record ID": "1"}]`), 0600)
+
+	load := fileResourceLoader(path)
+	set, version, err := load(nil)
+	if err != nil || len(set.Resources) != 1 {
+		t.Fatalf("Resources not loaded from file: %v", err)
+	}
+	if set, _, _ := load(version); set != nil {
+		t.Errorf("Unchanged file loaded again")
+	}
+
+	_ = ioutil.WriteFile(path, []byte(`[{"Record ID": "1"}, {"Record ID": "2"}]`), 0600)
+	modified := version.LastModified.Add(time.Second)
+	_ = os.Chtimes(path, modified, modified)
+	if set, _, _ := load(version); set == nil || len(set.Resources) != 2 {
+		t.Errorf("Changed file not loaded again")
+	}
+}
+
+func TestZIPDataParsed(t *testing.T) {
+	if len(ChiZIPCodes()) == 0 || len(ZIPCodeMap()) == 0 {
+		t.Errorf("ZIP data not parsed")
+	}
+}
@@ -2,17 +2,18 @@ package directory
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/jinzhu/gorm"
 	"github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 
 	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
 )
 
 type chatState string
@@ -26,6 +27,9 @@ const (
 	results     chatState = "results"
 )
 
+// ErrNoResourceStore is returned when results are requested from a chat without a resource store
+var ErrNoResourceStore = errors.New("No resource store set for the chat")
+
 // Used to force Unicode in SMS so that ñ renders consistently
 const punctuationSpace string = " "
 const pageSize int = 3
@@ -34,10 +38,21 @@ const maxSmsLen int = 1600
 // DirectoryChat manages chat conversations for directory filtering
 type DirectoryChat struct {
 	chat.Chat
-	State     chatState     `json:"state"`
-	Params    *FilterParams `json:"params"`
-	Page      int           `json:"page"`
+	State  chatState     `json:"state"`
+	Params *FilterParams `json:"params"`
+	Page   int           `json:"page"`
+	// Whether the last reply asked to confirm deleting the contact's data
+	PrivacyConfirm bool `json:"privacy_confirm,omitempty"`
+	// Store results are loaded from, which isn't saved with the conversation
+	Resources ResourceStore `json:"-"`
 	localizer *i18n.Localizer
+	// Attachments and options to include with the last reply of the message being handled
+	media []chat.Media
+	menu  *chat.Menu
+	// Resources included in the last page of results sent
+	pageResults []Resource
+	// Privacy command from the message being handled that needs stored data
+	privacyRequest privacyRequest
 }
 
 // NewDirectoryChat is a constructor for DirectoryChat structs
@@ -54,31 +69,70 @@ func NewDirectoryChat(id string) *DirectoryChat {
 	}
 }
 
-func GetOrCreateConversationFromMessage(contact string, message chat.Message, db *gorm.DB) (*chat.Conversation, bool) {
-	var conversation chat.Conversation
-	if db.Model(&chat.Conversation{}).Where("data ->> 'id' = ? AND active IS TRUE", contact).Last(&conversation).RecordNotFound() {
-		directoryChat := NewDirectoryChat(message.Sender)
-		directoryChat.Messages = []chat.Message{message}
-		_ = UpdateDirectoryChatConversation(directoryChat, &conversation, db)
-		return &conversation, true
+// GetOrCreateConversationFromMessage returns the active conversation for a contact,
+// creating one for a new directory chat if there isn't one. It returns an error if the
+// conversation can't be loaded or a new one can't be saved
+func GetOrCreateConversationFromMessage(
+	contact string,
+	message chat.Message,
+	store chat.ConversationStore,
+) (*chat.Conversation, bool, error) {
+	conversation, err := store.ActiveConversation(contact)
+	if err != nil {
+		return nil, false, err
 	}
-	return &conversation, false
+	if conversation == nil {
+		// The tenant is the address the contact messaged or was sent a message from
+		tenant := message.Recipient
+		if contact == message.Recipient {
+			tenant = message.Sender
+		}
+		conversation = &chat.Conversation{Channel: svc.ChannelForAddress(contact), Tenant: tenant}
+		directoryChat := NewDirectoryChat(contact)
+		if err := UpdateDirectoryChatConversation(directoryChat, conversation, store); err != nil {
+			// Another message may have created the contact's active conversation first
+			if existing, _ := store.ActiveConversation(contact); existing != nil {
+				return existing, false, nil
+			}
+			return nil, false, err
+		}
+		return conversation, true, nil
+	}
+	return conversation, false, nil
 }
 
-func UpdateDirectoryChatConversation(directoryChat *DirectoryChat, conversation *chat.Conversation, db *gorm.DB) error {
+// UpdateDirectoryChatConversation saves the chat state to its conversation
+func UpdateDirectoryChatConversation(directoryChat *DirectoryChat, conversation *chat.Conversation, store chat.ConversationStore) error {
 	chatJSON, _ := json.Marshal(directoryChat)
+	conversation.Contact = directoryChat.ContactID
+	conversation.State = string(directoryChat.State)
+	conversation.Language = directoryChat.Language
 	conversation.Data = postgres.Jsonb{
 		RawMessage: json.RawMessage(chatJSON),
 	}
-
-	db.Save(conversation)
-	return nil
+	return store.SaveConversation(conversation)
 }
 
 func languageOptions() []string {
 	return []string{"en", "es", "zh", "ar", "pl", "ur", "tl", "vi", "yo", "fr", "bs", "ko"}
 }
 
+// Language names as they're displayed in menus, in the language itself
+var languageNames = map[string]string{
+	"en": "English",
+	"es": "Español",
+	"zh": "中文",
+	"ar": "العربية",
+	"pl": "Polski",
+	"ur": "اردو",
+	"tl": "Tagalog",
+	"vi": "Tiếng Việt",
+	"yo": "Èdè Yoruba",
+	"fr": "Français",
+	"bs": "Bosanski",
+	"ko": "한국어",
+}
+
 // Values should be IDs for i18n messages
 func whatOptions() []string {
 	return []string{"All", "Money", "Food", "Housing", "Health", "Mental Health", "Utilities", "Legal Help"}
@@ -88,15 +142,36 @@ func whoOptions() []string {
 	return []string{"All", "Families", "Immigrants", "LGBTQI", "Business Owners", "Students", "None"}
 }
 
+// PageResults returns the resources included in replies to the last message handled
+func (c *DirectoryChat) PageResults() []Resource {
+	return c.pageResults
+}
+
 // HandleMessage updates chat state based on message
 func (c *DirectoryChat) HandleMessage(message chat.Message) ([]chat.Message, error) {
-	var replies []chat.Message
 	var bodies []string
 	var err error
 
 	if c.localizer == nil {
 		c.localizer = LoadLocalizer(c.Language)
 	}
+	c.media = nil
+	c.menu = nil
+	c.pageResults = nil
+	c.privacyRequest = ""
+
+	// Privacy commands are handled the same way in every state
+	if bodies, ok := c.handlePrivacyCommand(message.Body); ok {
+		return c.buildReplies(message, bodies), nil
+	}
+
+	// Photos and other media without text can't be used to answer a prompt
+	if message.HasMedia() && strings.TrimSpace(message.Body) == "" && c.State != started {
+		bodies = []string{c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "media-not-supported",
+		})}
+		return c.buildReplies(message, bodies), nil
+	}
 
 	switch c.State {
 	case started:
@@ -112,24 +187,47 @@ func (c *DirectoryChat) HandleMessage(message chat.Message) ([]chat.Message, err
 	case results:
 		bodies, err = c.handleResults(message.Body)
 	}
-	if len(bodies) > 0 {
-		for _, body := range bodies {
-			replies = append(replies, chat.Message{
-				Sender:    message.Recipient,
-				Recipient: message.Sender,
-				Body:      body,
-			})
-		}
+	return c.buildReplies(message, bodies), err
+}
+
+// Creates replies to a message from bodies, attaching any media to the last one
+func (c *DirectoryChat) buildReplies(message chat.Message, bodies []string) []chat.Message {
+	var replies []chat.Message
+	for _, body := range bodies {
+		replies = append(replies, chat.Message{
+			Sender:    message.Recipient,
+			Recipient: message.Sender,
+			Body:      body,
+		})
+	}
+	if len(replies) > 0 {
+		replies[len(replies)-1].Media = c.media
+		replies[len(replies)-1].Menu = c.menu
 	}
-	return replies, err
+	return replies
 }
 
 func (c *DirectoryChat) handleStarted(body string) ([]string, error) {
 	c.State = setLanguage
-	return c.buildLanguageMessage(), nil
+	return c.buildLanguageMessage(0), nil
 }
 
-func (c *DirectoryChat) buildLanguageMessage() []string {
+// Value of the language menu option that replies with the rest of the languages, for
+// channels that can't display all of them at once
+const moreLanguagesValue = "MORE"
+
+// Returns the index of the first language left out of the menu, or 0 if all fit
+func (c *DirectoryChat) languageMenuBreak() int {
+	limit := svc.MaxMenuOptions(svc.ChannelForAddress(c.ContactID))
+	if limit == 0 || len(languageOptions()) <= limit {
+		return 0
+	}
+	return limit - 1
+}
+
+// Builds the language prompt listing the languages from start. The menu includes
+// an option for the rest of the languages if the channel can't display them all
+func (c *DirectoryChat) buildLanguageMessage(start int) []string {
 	bodyStr := fmt.Sprintf(
 		"%s\n%s\n\n%s%s\n",
 		c.localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -141,16 +239,56 @@ func (c *DirectoryChat) buildLanguageMessage() []string {
 		}),
 		punctuationSpace,
 	)
-	for idx, val := range languageOptions() {
+	menuOptions := []chat.Option{}
+	langOptions := languageOptions()
+	for idx := start; idx < len(langOptions); idx++ {
+		val := langOptions[idx]
 		bodyStr += fmt.Sprintf("\n%s", c.localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID:    fmt.Sprintf("option-%s", val),
 			TemplateData: map[string]string{"Number": strconv.Itoa(idx)},
 		}))
+		menuOptions = append(menuOptions, chat.Option{Value: strconv.Itoa(idx), Label: languageNames[val]})
+	}
+	if menuBreak := c.languageMenuBreak(); start < menuBreak {
+		menuOptions = append(menuOptions[:menuBreak-start], chat.Option{
+			Value: moreLanguagesValue,
+			Label: c.localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "more-languages-option"}),
+		})
 	}
+	c.setMenu("language-prompt", menuOptions)
 	return []string{bodyStr}
 }
 
+// Sets the structured menu for channels that display options interactively
+func (c *DirectoryChat) setMenu(promptID string, options []chat.Option) {
+	c.menu = &chat.Menu{
+		Prompt: c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: promptID,
+		}),
+		Button: c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "menu-button-label",
+		}),
+		Options:  options,
+		Language: c.Language,
+	}
+}
+
+// Returns the short label for an option, overriding labels that need context
+func (c *DirectoryChat) optionLabel(val string, labelID string) string {
+	if labelID != "" {
+		return c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: labelID,
+		})
+	}
+	return c.localizer.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: val, Other: val},
+	})
+}
+
 func (c *DirectoryChat) handleSetLanguage(body string) ([]string, error) {
+	if normalizeCommand(body) == moreLanguagesValue && c.languageMenuBreak() > 0 {
+		return c.buildLanguageMessage(c.languageMenuBreak()), nil
+	}
 	langOptions := languageOptions()
 	// Iterate through languages in reverse order, return once found
 	// This way we can return once a value is found without potentially
@@ -180,6 +318,7 @@ func (c *DirectoryChat) buildWhatMessage() []string {
 		}),
 		c.unicodeIfNeeded(),
 	)
+	menuOptions := []chat.Option{}
 	for idx, val := range whatOptions() {
 		bodyStr += fmt.Sprintf("\n%s", c.localizer.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
@@ -188,7 +327,13 @@ func (c *DirectoryChat) buildWhatMessage() []string {
 			},
 			TemplateData: map[string]string{"Number": strconv.Itoa(idx)},
 		}))
+		labelID := ""
+		if idx == 0 {
+			labelID = "all-option-label"
+		}
+		menuOptions = append(menuOptions, chat.Option{Value: strconv.Itoa(idx), Label: c.optionLabel(val, labelID)})
 	}
+	c.setMenu("what-prompt", menuOptions)
 	return []string{bodyStr}
 }
 
@@ -226,11 +371,17 @@ func (c *DirectoryChat) buildWhoMessage() []string {
 		}),
 		c.unicodeIfNeeded(),
 	)
-	for idx, val := range whoOptions() {
+	whoOpts := whoOptions()
+	menuOptions := []chat.Option{}
+	for idx, val := range whoOpts {
 		optionKey := "option"
+		labelID := ""
 		// Override display of "All" translation
 		if idx == 0 {
 			optionKey = "who-option"
+			labelID = "who-all-option-label"
+		} else if idx == len(whoOpts)-1 {
+			labelID = "none-option-label"
 		}
 		bodyStr += fmt.Sprintf("\n%s", c.localizer.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
@@ -239,7 +390,9 @@ func (c *DirectoryChat) buildWhoMessage() []string {
 			},
 			TemplateData: map[string]string{"Number": strconv.Itoa(idx)},
 		}))
+		menuOptions = append(menuOptions, chat.Option{Value: strconv.Itoa(idx), Label: c.optionLabel(val, labelID)})
 	}
+	c.setMenu("who-prompt", menuOptions)
 	return []string{bodyStr}
 }
 
@@ -281,10 +434,7 @@ func (c *DirectoryChat) buildZIPMessage() []string {
 }
 
 func (c *DirectoryChat) handleSetZIP(body string) ([]string, error) {
-	cleanZIPRe := regexp.MustCompile(`\D`)
-	cleanZIPStr := cleanZIPRe.ReplaceAllString(body, ``)
-	zipRe := regexp.MustCompile(`\d{5}`)
-	zipStr := zipRe.FindString(cleanZIPStr)
+	zipStr := parseZIP(body)
 	if zipStr == "" {
 		invalidPrompt := c.localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID: "please-enter-valid-zip",
@@ -296,9 +446,33 @@ func (c *DirectoryChat) handleSetZIP(body string) ([]string, error) {
 	return c.handleResults("")
 }
 
-func (c *DirectoryChat) handleResults(body string) ([]string, error) {
-	var results []Resource
+// Returns the first 5 digits in a string, ignoring other characters
+func parseZIP(body string) string {
+	cleanZIPRe := regexp.MustCompile(`\D`)
+	cleanZIPStr := cleanZIPRe.ReplaceAllString(body, ``)
+	zipRe := regexp.MustCompile(`\d{5}`)
+	return zipRe.FindString(cleanZIPStr)
+}
 
+// Loads resources matching the chat's filters
+func (c *DirectoryChat) loadResults() ([]Resource, error) {
+	zipMap := ZIPCodeMap()
+	chiZips := ChiZIPCodes()
+	if c.Resources == nil {
+		return []Resource{}, ErrNoResourceStore
+	}
+	set, err := c.Resources.ResourceSet()
+	if err != nil {
+		return []Resource{}, err
+	}
+
+	filterJSON, _ := json.Marshal(c.Params)
+	log.Println(string(filterJSON))
+
+	return set.Index.Search(set.Resources, c.Params, &zipMap, &chiZips), nil
+}
+
+func (c *DirectoryChat) handleResults(body string) ([]string, error) {
 	if strings.Contains(body, "2") {
 		return c.handleRestart()
 	} else if !strings.Contains(body, "1") && !strings.Contains(body, "3") && c.Page != 0 {
@@ -306,22 +480,11 @@ func (c *DirectoryChat) handleResults(body string) ([]string, error) {
 		return []string{}, nil
 	}
 
-	zipMap := ZIPCodeMap()
-	chiZips := ChiZIPCodes()
-	resources, err := LoadResources()
+	results, err := c.loadResults()
 	if err != nil {
 		return []string{}, err
 	}
 
-	filterJSON, _ := json.Marshal(c.Params)
-	log.Println(string(filterJSON))
-
-	for _, resource := range resources {
-		if c.Params.MatchesFilters(resource, &zipMap, &chiZips) {
-			results = append(results, resource)
-		}
-	}
-
 	seeMorePrompt := c.localizer.MustLocalize(&i18n.LocalizeConfig{
 		MessageID:    "see-more-prompt",
 		TemplateData: map[string]string{"Number": "1"},
@@ -379,6 +542,9 @@ func (c *DirectoryChat) handleResults(body string) ([]string, error) {
 	for _, result := range sendResults {
 		bodyStr += fmt.Sprintf("\n\n\n%s", result.AsText(c.Language, c.localizer))
 	}
+	// Attach contact cards for results when sending them over MMS is enabled
+	c.media = vcardMedia(sendResults, c.Language)
+	c.pageResults = sendResults
 
 	// Show a prompt for paginating if more results available
 	if hasRemaining {
@@ -1,11 +1,13 @@
 package directory
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -34,9 +36,27 @@ func TestGetOrCreateConversationFromMessage(t *testing.T) {
 	dbMock.ExpectQuery("SELECT (.+) FROM (.+) WHERE (.+) LIMIT 1").
 		WithArgs("+1234567890").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-	_, created := GetOrCreateConversationFromMessage("+1234567890", message, gormDB)
-	if created {
-		t.Errorf("Created record instead of pulling latest")
+	_, created, err := GetOrCreateConversationFromMessage("+1234567890", message, chat.NewGormStore(gormDB))
+	if created || err != nil {
+		t.Errorf("Created record instead of pulling latest: %v", err)
+	}
+
+	// Errors saving a new conversation are returned unless another message created one
+	dbMock.ExpectQuery("SELECT (.+) FROM (.+) WHERE (.+) LIMIT 1").
+		WithArgs("+1234567890").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(`INSERT INTO "conversations"`).WillReturnError(errors.New("connection reset"))
+	dbMock.ExpectRollback()
+	dbMock.ExpectQuery("SELECT (.+) FROM (.+) WHERE (.+) LIMIT 1").
+		WithArgs("+1234567890").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	conversation, _, err := GetOrCreateConversationFromMessage("+1234567890", message, chat.NewGormStore(gormDB))
+	if conversation != nil || err == nil {
+		t.Errorf("Unsaved conversation returned")
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
 	}
 }
 
@@ -66,6 +86,32 @@ func TestHandleSetLanguage(t *testing.T) {
 	}
 }
 
+func TestLanguageMenuPaged(t *testing.T) {
+	dirChat := NewDirectoryChat("whatsapp:+15555555555")
+	replies, _ := dirChat.HandleMessage(chat.Message{Body: "hi"})
+	menu := replies[0].Menu
+	if len(menu.Options) != 10 || menu.Options[9].Value != moreLanguagesValue || menu.Language != "en" {
+		t.Fatalf("Language menu not paged for WhatsApp: %v", menu)
+	}
+	// The body still lists every language, so any of them can be picked by number
+	if !strings.Contains(replies[0].Body, "11") {
+		t.Errorf("Language body not listing every language")
+	}
+	replies, _ = dirChat.HandleMessage(chat.Message{Body: moreLanguagesValue})
+	if dirChat.State != setLanguage || len(replies[0].Menu.Options) != 3 || replies[0].Menu.Options[0].Value != "9" {
+		t.Errorf("Rest of the languages not sent: %v", replies)
+	}
+	_, _ = dirChat.HandleMessage(chat.Message{Body: "11"})
+	if dirChat.Language != "ko" {
+		t.Errorf("Language on the second page not set")
+	}
+
+	dirChat = NewDirectoryChat("+15555555555")
+	if replies, _ := dirChat.HandleMessage(chat.Message{Body: "hi"}); len(replies[0].Menu.Options) != len(languageOptions()) {
+		t.Errorf("Language menu paged for SMS")
+	}
+}
+
 func TestHandleMessageSetMultiple(t *testing.T) {
 	dirChat := NewDirectoryChat("test")
 	dirChat.State = setWhat
@@ -97,6 +143,24 @@ func TestHandleMessageInvalid(t *testing.T) {
 	}
 }
 
+func TestHandleMessageMedia(t *testing.T) {
+	dirChat := NewDirectoryChat("test")
+	dirChat.State = setWhat
+	replies, _ := dirChat.HandleMessage(chat.Message{
+		Media: []chat.Media{chat.Media{URL: "https://example.com/photo.jpg", ContentType: "image/jpeg"}},
+	})
+	if dirChat.State != setWhat || len(replies) != 1 {
+		t.Errorf("Media without text should reply without changing state")
+	}
+	_, _ = dirChat.HandleMessage(chat.Message{
+		Body:  "1",
+		Media: []chat.Media{chat.Media{URL: "https://example.com/photo.jpg", ContentType: "image/jpeg"}},
+	})
+	if dirChat.State != setWho {
+		t.Errorf("Media with text not handled as text")
+	}
+}
+
 func TestHandleSetZIP(t *testing.T) {
 	dirChat := NewDirectoryChat("test")
 	dirChat.localizer = LoadLocalizer("en")
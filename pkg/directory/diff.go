@@ -0,0 +1,134 @@
+package directory
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldChange is a field with a different value in the current resources
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Previous interface{} `json:"previous"`
+	Current  interface{} `json:"current"`
+}
+
+// ResourceChange lists the fields that changed for a resource
+type ResourceChange struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// ResourceDiff compares resources with a previous snapshot by ID
+type ResourceDiff struct {
+	// ID of the snapshot the resources were compared with
+	Previous string           `json:"previous"`
+	Added    []string         `json:"added"`
+	Removed  []string         `json:"removed"`
+	Changed  []ResourceChange `json:"changed"`
+	// Resources that were approved in the snapshot and are now removed or not approved,
+	// so contacts no longer see them
+	Unapproved       []string `json:"unapproved"`
+	PreviousApproved int      `json:"previous_approved"`
+	// Whether resources in both lists are in a different order, which changes how
+	// results are listed to contacts
+	Reordered bool `json:"reordered"`
+}
+
+// DiffResources returns the resources added, removed and changed since previous
+func DiffResources(previous, current []Resource) *ResourceDiff {
+	diff := &ResourceDiff{
+		Added:      []string{},
+		Removed:    []string{},
+		Changed:    []ResourceChange{},
+		Unapproved: []string{},
+	}
+	currentByID := map[string]Resource{}
+	for _, resource := range current {
+		currentByID[resource.ID] = resource
+	}
+	previousIDs := map[string]bool{}
+	for _, resource := range previous {
+		previousIDs[resource.ID] = true
+		currentResource, ok := currentByID[resource.ID]
+		if resource.Status == "Approved" {
+			diff.PreviousApproved++
+			if !ok || currentResource.Status != "Approved" {
+				diff.Unapproved = append(diff.Unapproved, resource.ID)
+			}
+		}
+		if !ok {
+			diff.Removed = append(diff.Removed, resource.ID)
+		} else if fields := diffFields(resource, currentResource); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ResourceChange{ID: resource.ID, Name: currentResource.Name, Fields: fields})
+		}
+	}
+	kept := []string{}
+	for _, resource := range current {
+		if !previousIDs[resource.ID] {
+			diff.Added = append(diff.Added, resource.ID)
+		} else {
+			kept = append(kept, resource.ID)
+		}
+	}
+	for _, resource := range previous {
+		if _, ok := currentByID[resource.ID]; !ok {
+			continue
+		}
+		if len(kept) == 0 || kept[0] != resource.ID {
+			diff.Reordered = true
+			break
+		}
+		kept = kept[1:]
+	}
+	return diff
+}
+
+// Empty returns whether no resources were added, removed, changed or reordered
+func (d *ResourceDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.Reordered
+}
+
+// UnapprovedPercent returns the percent of previously approved resources contacts no longer see
+func (d *ResourceDiff) UnapprovedPercent() float64 {
+	if d.PreviousApproved == 0 {
+		return 0
+	}
+	return float64(len(d.Unapproved)) * 100 / float64(d.PreviousApproved)
+}
+
+// Returns the fields that differ between two versions of a resource, named by their JSON keys
+func diffFields(previous, current Resource) []FieldChange {
+	changes := []FieldChange{}
+	previousVal := reflect.ValueOf(previous)
+	currentVal := reflect.ValueOf(current)
+	resourceType := previousVal.Type()
+	for idx := 0; idx < resourceType.NumField(); idx++ {
+		previousField := previousVal.Field(idx).Interface()
+		currentField := currentVal.Field(idx).Interface()
+		if fieldsEqual(previousField, currentField) {
+			continue
+		}
+		name := strings.Split(resourceType.Field(idx).Tag.Get("json"), ",")[0]
+		changes = append(changes, FieldChange{Field: name, Previous: previousField, Current: currentField})
+	}
+	return changes
+}
+
+// Empty and missing lists are equal, and times are compared regardless of location
+func fieldsEqual(previous, current interface{}) bool {
+	switch previousValue := previous.(type) {
+	case []string:
+		currentValue := current.([]string)
+		if len(previousValue) == 0 && len(currentValue) == 0 {
+			return true
+		}
+	case *time.Time:
+		currentValue := current.(*time.Time)
+		if previousValue != nil && currentValue != nil {
+			return previousValue.Equal(*currentValue)
+		}
+	}
+	return reflect.DeepEqual(previous, current)
+}
@@ -0,0 +1,44 @@
+package directory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffResources(t *testing.T) {
+	updated := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	updatedLocal := updated.In(time.FixedZone("CDT", -5*60*60))
+	previous := []Resource{
+		{ID: "1", Name: "Food pantry", Status: "Approved", LastUpdated: &updated},
+		{ID: "2", Name: "Rent help", Status: "Approved", Who: []string{}},
+		{ID: "3", Name: "Legal aid", Status: "Approved"},
+	}
+	current := []Resource{
+		{ID: "1", Name: "Food pantry", Status: "Approved", Phone: "312-555-0100", LastUpdated: &updatedLocal},
+		{ID: "2", Name: "Rent help", Status: "Pending"},
+		{ID: "4", Name: "Utility help", Status: "Approved"},
+	}
+
+	diff := DiffResources(previous, current)
+	if len(diff.Added) != 1 || diff.Added[0] != "4" || len(diff.Removed) != 1 || diff.Removed[0] != "3" {
+		t.Errorf("Added and removed resources not found: %+v", diff)
+	}
+	if len(diff.Changed) != 2 || len(diff.Changed[0].Fields) != 1 || diff.Changed[0].Fields[0].Field != "Phone" {
+		t.Fatalf("Changed fields not found: %+v", diff.Changed)
+	}
+	if diff.Changed[1].Fields[0].Field != "Status" || diff.Changed[1].Fields[0].Current != "Pending" {
+		t.Errorf("Status change not found: %+v", diff.Changed[1])
+	}
+	if len(diff.Unapproved) != 2 || diff.PreviousApproved != 3 || int(diff.UnapprovedPercent()) != 66 {
+		t.Errorf("Unapproved resources not counted: %+v", diff)
+	}
+	if diff.Reordered {
+		t.Errorf("Resources in the same order marked reordered")
+	}
+
+	// Moving resources is a change, since results are listed in order
+	reordered := DiffResources(current, []Resource{current[1], current[0], current[2]})
+	if !reordered.Reordered || reordered.Empty() {
+		t.Errorf("Reordered resources not found: %+v", reordered)
+	}
+}
@@ -34,7 +34,7 @@ func (f *FilterParams) MatchesFilters(resource Resource, zipMap *map[string][]st
 			zipMatches = stringSlicesOverlap([]string{*f.ZIP}, *cityZips)
 		} else if resource.Level == "Neighborhood" && zipMap != nil {
 			if zipMatchList, ok := (*zipMap)[*f.ZIP]; ok {
-				zipMatches = stringSlicesOverlap([]string{*f.ZIP}, zipMatchList)
+				zipMatches = stringSlicesOverlap([]string{resource.ZIP}, zipMatchList)
 			} else {
 				zipMatches = strings.Contains(resource.ZIP, *f.ZIP)
 			}
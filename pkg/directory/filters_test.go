@@ -29,7 +29,12 @@ func TestMatchesFiltersZIP(t *testing.T) {
 	if !params.MatchesFilters(resource, zipMap, nil) {
 		t.Errorf("Resource not matching in map list")
 	}
+	resource.ZIP = zipThree
+	if params.MatchesFilters(resource, zipMap, nil) {
+		t.Errorf("Resource matching outside neighboring ZIPs")
+	}
 	params.ZIP = &zipTwo
+	resource.ZIP = zipTwo
 	if !params.MatchesFilters(resource, zipMap, nil) {
 		t.Errorf("Resource ZIP not matching on strings")
 	}
@@ -0,0 +1,249 @@
+package directory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Length of the ZIP codes that neighborhood ZIPs are indexed by
+const zipLength = 5
+
+// ResourceIndex is an inverted index of resources by the fields they're filtered on. Postings
+// are positions in the list of resources the index was built from, in ascending order, so
+// results keep the directory's order
+type ResourceIndex struct {
+	// IDs of the indexed resources in order, to check that the index matches a list of resources
+	IDs []string `json:"ids"`
+	// Hash of the published resources JSON the index was built from, if it was published
+	Hash       string           `json:"hash"`
+	Approved   []int            `json:"approved"`
+	Categories map[string][]int `json:"categories"`
+	Who        map[string][]int `json:"who"`
+	// Resources without any who values, which match every who filter
+	NoWho     []int            `json:"no_who"`
+	Languages map[string][]int `json:"languages"`
+	Levels    map[string][]int `json:"levels"`
+	// Neighborhood resources by their ZIP value
+	NeighborhoodZIPs map[string][]int `json:"neighborhood_zips"`
+	// Neighborhood resources by each 5 character substring of their ZIP value
+	NeighborhoodZIPWindows map[string][]int `json:"neighborhood_zip_windows"`
+}
+
+// BuildResourceIndex indexes a list of resources
+func BuildResourceIndex(resources []Resource) *ResourceIndex {
+	index := &ResourceIndex{
+		IDs:                    make([]string, len(resources)),
+		Approved:               []int{},
+		Categories:             map[string][]int{},
+		Who:                    map[string][]int{},
+		NoWho:                  []int{},
+		Languages:              map[string][]int{},
+		Levels:                 map[string][]int{},
+		NeighborhoodZIPs:       map[string][]int{},
+		NeighborhoodZIPWindows: map[string][]int{},
+	}
+	for pos, resource := range resources {
+		index.IDs[pos] = resource.ID
+		if resource.Status == "Approved" {
+			index.Approved = append(index.Approved, pos)
+		}
+		addPostings(index.Categories, resource.Category, pos)
+		addPostings(index.Who, resource.Who, pos)
+		if len(resource.Who) == 0 {
+			index.NoWho = append(index.NoWho, pos)
+		}
+		addPostings(index.Languages, resource.Languages, pos)
+		addPostings(index.Levels, []string{resource.Level}, pos)
+		if resource.Level == "Neighborhood" {
+			addPostings(index.NeighborhoodZIPs, []string{resource.ZIP}, pos)
+			windows := []string{}
+			for start := 0; start+zipLength <= len(resource.ZIP); start++ {
+				windows = append(windows, resource.ZIP[start:start+zipLength])
+			}
+			addPostings(index.NeighborhoodZIPWindows, windows, pos)
+		}
+	}
+	return index
+}
+
+// Adds a position to the postings for each key, once even if a key is repeated
+func addPostings(postings map[string][]int, keys []string, pos int) {
+	for _, key := range keys {
+		list := postings[key]
+		if len(list) == 0 || list[len(list)-1] != pos {
+			postings[key] = append(list, pos)
+		}
+	}
+}
+
+// Matches returns whether the index was built from a set of resources. Sets loaded from
+// published JSON also have to match the hash of the JSON, since IDs don't change when
+// resources are edited
+func (idx *ResourceIndex) Matches(set *ResourceSet) bool {
+	if idx.Hash != set.Hash || len(idx.IDs) != len(set.Resources) {
+		return false
+	}
+	for pos, resource := range set.Resources {
+		if idx.IDs[pos] != resource.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the hash of published resources JSON, which is stored in the index built from it
+func hashResourcesJSON(resourcesJSON []byte) string {
+	sum := sha256.Sum256(resourcesJSON)
+	return hex.EncodeToString(sum[:])
+}
+
+// Search returns the resources the index was built from that match filter parameters,
+// with the same results as checking each one with MatchesFilters
+func (idx *ResourceIndex) Search(
+	resources []Resource,
+	f *FilterParams,
+	zipMap *map[string][]string,
+	cityZips *[]string,
+) []Resource {
+	var results []Resource
+	var positions []int
+	switch {
+	case f.isEmpty():
+		positions = allPositions(len(resources))
+	case f.ZIP == nil:
+		// Resources only match non-empty filters that include a ZIP
+		return results
+	default:
+		lists := [][]int{idx.Approved, idx.zipMatches(resources, *f.ZIP, zipMap, cityZips)}
+		if len(f.What) > 0 {
+			lists = append(lists, unionPostings(idx.Categories, f.What))
+		}
+		if len(f.Languages) > 0 {
+			lists = append(lists, unionPostings(idx.Languages, f.Languages))
+		}
+		if len(f.Who) > 0 {
+			lists = append(lists, idx.whoMatches(f.Who, len(resources)))
+		}
+		positions = intersectAll(lists)
+	}
+	for _, pos := range positions {
+		results = append(results, resources[pos])
+	}
+	return results
+}
+
+// Returns positions of resources that match a ZIP filter based on their level
+func (idx *ResourceIndex) zipMatches(
+	resources []Resource,
+	zip string,
+	zipMap *map[string][]string,
+	cityZips *[]string,
+) []int {
+	neighborhood := idx.Levels["Neighborhood"]
+	city := idx.Levels["City"]
+	lists := [][]int{complement(union(neighborhood, city), len(resources))}
+	if cityZips == nil || stringSlicesOverlap([]string{zip}, *cityZips) {
+		lists = append(lists, city)
+	}
+	if zipMap != nil {
+		if neighbors, ok := (*zipMap)[zip]; ok {
+			return union(append(lists, unionPostings(idx.NeighborhoodZIPs, neighbors))...)
+		}
+	}
+	if len(zip) == zipLength {
+		return union(append(lists, idx.NeighborhoodZIPWindows[zip])...)
+	}
+	// ZIPs that aren't indexed are compared with each neighborhood resource
+	contains := []int{}
+	for _, pos := range neighborhood {
+		if strings.Contains(resources[pos].ZIP, zip) {
+			contains = append(contains, pos)
+		}
+	}
+	return union(append(lists, contains)...)
+}
+
+// Returns positions of resources that match a who filter
+func (idx *ResourceIndex) whoMatches(who []string, count int) []int {
+	if stringSlicesOverlap(who, []string{"None"}) {
+		whoOpts := whoOptions()
+		return union(idx.NoWho, complement(unionPostings(idx.Who, whoOpts[1:len(whoOpts)-1]), count))
+	}
+	return union(idx.NoWho, unionPostings(idx.Who, who))
+}
+
+func allPositions(count int) []int {
+	positions := make([]int, count)
+	for pos := range positions {
+		positions[pos] = pos
+	}
+	return positions
+}
+
+// Returns the union of the postings for each key
+func unionPostings(postings map[string][]int, keys []string) []int {
+	lists := [][]int{}
+	for _, key := range keys {
+		lists = append(lists, postings[key])
+	}
+	return union(lists...)
+}
+
+// Returns the sorted union of sorted lists
+func union(lists ...[]int) []int {
+	merged := []int{}
+	for _, list := range lists {
+		merged = append(merged, list...)
+	}
+	sort.Ints(merged)
+	unique := []int{}
+	for idx, pos := range merged {
+		if idx == 0 || pos != merged[idx-1] {
+			unique = append(unique, pos)
+		}
+	}
+	return unique
+}
+
+// Returns positions up to count that aren't in a sorted list
+func complement(list []int, count int) []int {
+	positions := []int{}
+	next := 0
+	for pos := 0; pos < count; pos++ {
+		if next < len(list) && list[next] == pos {
+			next++
+			continue
+		}
+		positions = append(positions, pos)
+	}
+	return positions
+}
+
+// Returns the intersection of sorted lists, starting with the shortest
+func intersectAll(lists [][]int) []int {
+	sort.Slice(lists, func(a, b int) bool { return len(lists[a]) < len(lists[b]) })
+	result := lists[0]
+	for _, list := range lists[1:] {
+		result = intersect(result, list)
+	}
+	return result
+}
+
+func intersect(a, b []int) []int {
+	result := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Picks a random subset of options, sometimes including values that aren't options
+func randomSubset(random *rand.Rand, options []string) []string {
+	subset := []string{}
+	for _, option := range append(options, "Other") {
+		if random.Intn(4) == 0 {
+			subset = append(subset, option)
+		}
+	}
+	return subset
+}
+
+func randomResources(random *rand.Rand, count int) []Resource {
+	levels := []string{"Neighborhood", "City", "County", "State", "National", ""}
+	statuses := []string{"Approved", "Approved", "Pending"}
+	zips := []string{"60601", "60644", "60402", "60804", "60601, 60602", "606", "", "Chicago 60644"}
+	resources := []Resource{}
+	for idx := 0; idx < count; idx++ {
+		resources = append(resources, Resource{
+			ID:        fmt.Sprintf("rec%d", idx),
+			Category:  randomSubset(random, whatOptions()[1:]),
+			Who:       randomSubset(random, whoOptions()[1:len(whoOptions())-1]),
+			Languages: randomSubset(random, languageOptions()),
+			Level:     levels[random.Intn(len(levels))],
+			Status:    statuses[random.Intn(len(statuses))],
+			ZIP:       zips[random.Intn(len(zips))],
+		})
+	}
+	return resources
+}
+
+func randomParams(random *rand.Rand) *FilterParams {
+	params := &FilterParams{
+		What:      randomSubset(random, whatOptions()[1:]),
+		Who:       randomSubset(random, whoOptions()[1:]),
+		Languages: randomSubset(random, languageOptions()),
+	}
+	zips := []string{"60601", "60644", "60402", "99999", "6060", ""}
+	if pick := random.Intn(len(zips) + 1); pick < len(zips) {
+		params.ZIP = &zips[pick]
+	}
+	return params
+}
+
+func TestResourceIndexMatchesFilters(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	zipMap := ZIPCodeMap()
+	chiZips := ChiZIPCodes()
+	resources := randomResources(random, 300)
+	index := BuildResourceIndex(resources)
+
+	for run := 0; run < 2000; run++ {
+		params := randomParams(random)
+		zipMapArg, chiZipsArg := &zipMap, &chiZips
+		if run%3 == 1 {
+			zipMapArg = nil
+		}
+		if run%5 == 1 {
+			chiZipsArg = nil
+		}
+		var expected []Resource
+		for _, resource := range resources {
+			if params.MatchesFilters(resource, zipMapArg, chiZipsArg) {
+				expected = append(expected, resource)
+			}
+		}
+		results := index.Search(resources, params, zipMapArg, chiZipsArg)
+		if len(results) != len(expected) {
+			paramsJSON, _ := json.Marshal(params)
+			t.Fatalf("Expected %d results for %s, got %d", len(expected), paramsJSON, len(results))
+		}
+		for idx := range results {
+			if results[idx].ID != expected[idx].ID {
+				t.Fatalf("Results not in directory order")
+			}
+		}
+	}
+}
+
+func TestResourceIndexJSON(t *testing.T) {
+	resources := randomResources(rand.New(rand.NewSource(2)), 20)
+	resourcesJSON, _ := json.Marshal(resources)
+	published := BuildResourceIndex(resources)
+	published.Hash = hashResourcesJSON(resourcesJSON)
+	indexJSON, _ := json.Marshal(published)
+	var index ResourceIndex
+	set := &ResourceSet{Resources: resources, Hash: hashResourcesJSON(resourcesJSON)}
+	if err := json.Unmarshal(indexJSON, &index); err != nil || !index.Matches(set) {
+		t.Fatalf("Published index not loaded for resources")
+	}
+	if index.Matches(&ResourceSet{Resources: resources[1:], Hash: set.Hash}) {
+		t.Errorf("Index matching other resources")
+	}
+
+	// A stale index with the same IDs doesn't match resources that were edited
+	resources[0].Category = []string{"Edited"}
+	editedJSON, _ := json.Marshal(resources)
+	if index.Matches(&ResourceSet{Resources: resources, Hash: hashResourcesJSON(editedJSON)}) {
+		t.Errorf("Stale index matching edited resources")
+	}
+	resources[0].Category = nil
+	zip := "60644"
+	params := &FilterParams{ZIP: &zip, What: []string{"Food"}}
+	if len(index.Search(resources, params, nil, nil)) != len(BuildResourceIndex(resources).Search(resources, params, nil, nil)) {
+		t.Errorf("Published index returning different results")
+	}
+}
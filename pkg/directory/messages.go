@@ -0,0 +1,228 @@
+package directory
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// Keywords contacts send to opt back in to messages after opting out
+var optInKeywords = map[string]bool{"START": true, "UNSTOP": true}
+
+// MessageHandler handles received and sent message events and delivery status updates,
+// publishing replies to the bus. If Ledger is set, received messages that were already
+// processed are skipped. If Limiter is set, messages from blocked contacts and contacts
+// sending too quickly are ignored, and replies stop when the outbound limit is reached
+type MessageHandler struct {
+	Store     chat.ConversationStore
+	Bus       svc.Bus
+	Resources ResourceStore
+	Ledger    chat.MessageLedger
+	Limiter   chat.RateLimiter
+}
+
+// HandleEvent updates conversations for received and sent message events
+func (h *MessageHandler) HandleEvent(event svc.Event) error {
+	switch event.Feed {
+	case svc.ReceivedMessageFeed:
+		if h.Ledger != nil {
+			isNew, err := h.Ledger.ProcessMessage(event.Message)
+			if err != nil {
+				return err
+			}
+			if !isNew {
+				return h.publishPendingReplies(event.Message)
+			}
+		}
+		if h.Limiter != nil {
+			limited, err := h.limitMessage(event.Message)
+			if err != nil && h.Ledger != nil {
+				// The message wasn't handled, so a retry can process it
+				_ = h.Ledger.ReleaseMessage(event.Message)
+			}
+			if err != nil || limited {
+				return err
+			}
+		}
+		replies, err := HandleReceivedMessage(event.Message, h.Store, h.Resources)
+		if err != nil && h.Ledger != nil {
+			// Conversations aren't updated if handling fails, so a retry can process it
+			_ = h.Ledger.ReleaseMessage(event.Message)
+		}
+		if err == nil && optInKeywords[strings.ToUpper(strings.TrimSpace(event.Message.Body))] {
+			err = h.Store.ClearUnreachable(event.Message.Sender)
+		}
+		if err != nil {
+			return err
+		}
+		return h.publishReceivedReplies(event.Message, replies)
+	case svc.SentMessageFeed:
+		return HandleSentMessage(event.Message, h.Store)
+	case svc.DeliveryStatusFeed:
+		return HandleDeliveryStatus(event.Status, h.Store)
+	}
+	return nil
+}
+
+// Publishes the replies to a received message. With a ledger, the replies are saved first
+// so that if publishing fails, the retried event publishes them instead of being skipped
+func (h *MessageHandler) publishReceivedReplies(message chat.Message, replies []chat.Message) error {
+	if h.Ledger == nil || len(replies) == 0 {
+		return h.PublishReplies(message.Sender, replies)
+	}
+	if err := h.Ledger.SaveReplies(message, replies); err != nil {
+		log.Printf("Replies to message %s not saved: %v", message.ID, err)
+	}
+	return h.publishSavedReplies(message, replies)
+}
+
+// Publishes replies saved for a message that was already processed, or skips it as a
+// duplicate if they were published
+func (h *MessageHandler) publishPendingReplies(message chat.Message) error {
+	replies, err := h.Ledger.PendingReplies(message)
+	if err != nil {
+		return err
+	}
+	if len(replies) == 0 {
+		log.Printf("Skipping duplicate message %s", message.ID)
+		return nil
+	}
+	log.Printf("Publishing %d saved replies to message %s", len(replies), message.ID)
+	return h.publishSavedReplies(message, replies)
+}
+
+// Publishes replies saved in the ledger and clears them. Failing to clear them is only
+// logged, since returning an error would publish them again on a retry
+func (h *MessageHandler) publishSavedReplies(message chat.Message, replies []chat.Message) error {
+	if err := h.PublishReplies(message.Sender, replies); err != nil {
+		return err
+	}
+	if err := h.Ledger.ClearReplies(message); err != nil {
+		log.Printf("Replies to message %s not cleared: %v", message.ID, err)
+	}
+	return nil
+}
+
+// Handling a message is retried this many times if its conversation is updated concurrently
+const maxConversationAttempts = 5
+
+// Runs handle again with the latest conversation if another message updated the conversation
+// first, so messages for a contact are applied one after another
+func retryConflicts(handle func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := handle()
+		if err != chat.ErrConversationConflict || attempt >= maxConversationAttempts {
+			return err
+		}
+		log.Println("Conversation updated while handling a message, retrying")
+	}
+}
+
+// HandleReceivedMessage updates the sender's conversation with a message and returns the replies.
+// Replies are only returned once the conversation is saved, so a retry doesn't send them twice
+func HandleReceivedMessage(
+	message chat.Message,
+	store chat.ConversationStore,
+	resources ResourceStore,
+) ([]chat.Message, error) {
+	var replies []chat.Message
+	err := retryConflicts(func() error {
+		var err error
+		replies, err = handleReceivedMessage(message, store, resources)
+		return err
+	})
+	return replies, err
+}
+
+func handleReceivedMessage(
+	message chat.Message,
+	store chat.ConversationStore,
+	resources ResourceStore,
+) ([]chat.Message, error) {
+	conversation, _, err := GetOrCreateConversationFromMessage(message.Sender, message, store)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	var directoryChat DirectoryChat
+	if err := json.Unmarshal(conversation.Data.RawMessage, &directoryChat); err != nil {
+		return []chat.Message{}, err
+	}
+	directoryChat.Resources = resources
+	// Messages are recorded with the state they were received in
+	if err := recordMessage(store, conversation, directoryChat.State, chat.DirectionInbound, message, ""); err != nil {
+		return []chat.Message{}, err
+	}
+	replies, replyErr := directoryChat.HandleMessage(message)
+	if replyErr != nil {
+		return []chat.Message{}, replyErr
+	}
+	if directoryChat.privacyRequest != "" {
+		var deleted bool
+		replies, deleted, replyErr = directoryChat.handlePrivacyRequest(message, store)
+		if replyErr != nil || deleted {
+			return replies, replyErr
+		}
+	}
+	updateErr := UpdateDirectoryChatConversation(&directoryChat, conversation, store)
+	if updateErr != nil {
+		return []chat.Message{}, updateErr
+	}
+	// Track when the contact last messaged for channels with session windows
+	for idx := range replies {
+		replies[idx].SessionStart = message.CreatedAt
+	}
+	return replies, nil
+}
+
+// HandleSentMessage adds a message that was sent to the recipient's conversation transcript.
+// Messages sent after a contact's conversations were deleted aren't recorded
+func HandleSentMessage(message chat.Message, store chat.ConversationStore) error {
+	conversation, err := store.ActiveConversation(message.Recipient)
+	if err != nil || conversation == nil {
+		return err
+	}
+	var directoryChat DirectoryChat
+	if err := json.Unmarshal(conversation.Data.RawMessage, &directoryChat); err != nil {
+		return err
+	}
+	return recordMessage(store, conversation, directoryChat.State, chat.DirectionOutbound, message, chat.StatusSent)
+}
+
+// HandleDeliveryStatus updates the status of a sent message, and marks the recipient
+// unreachable if the error code means later messages won't be delivered either
+func HandleDeliveryStatus(status chat.DeliveryStatus, store chat.ConversationStore) error {
+	if status.MessageID != "" {
+		if err := store.UpdateMessageStatus(status); err != nil {
+			return err
+		}
+	}
+	if status.ErrorCode != "" {
+		log.Printf("Message %s %s with error code %s", status.MessageID, status.Status, status.ErrorCode)
+	}
+	if status.Recipient == "" || !status.Unreachable {
+		return nil
+	}
+	return store.MarkUnreachable(status.Recipient, status.ErrorCode)
+}
+
+// Adds a message to a conversation's transcript with the chat's state at the time
+func recordMessage(
+	store chat.ConversationStore,
+	conversation *chat.Conversation,
+	state chatState,
+	direction string,
+	message chat.Message,
+	status string,
+) error {
+	record := chat.NewMessageRecord(conversation.ID, direction, message)
+	record.State = string(state)
+	record.Status = status
+	record.Segments = 1
+	if conversation.Channel == svc.SMSChannel {
+		record.Segments, _ = svc.SMSSegments(message.Body)
+	}
+	return store.SaveMessage(record)
+}
@@ -0,0 +1,325 @@
+package directory
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestMessageHandlerMemoryBus(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := svc.NewMemoryBus()
+	go bus.Run()
+	defer bus.Close()
+
+	provider := &mocks.ProviderMock{}
+	sender := svc.NewSender(bus, svc.NewMemoryDeliveryStore())
+	sender.NewProvider = func(from, to string) (chat.Provider, error) { return provider, nil }
+	messageHandler := &MessageHandler{Store: store, Bus: bus}
+	bus.Subscribe(svc.ReceivedMessageFeed, messageHandler.HandleEvent)
+	bus.Subscribe(svc.SentMessageFeed, messageHandler.HandleEvent)
+	bus.Subscribe(svc.SendSMSFeed, sender.HandleEvent)
+
+	createdAt := time.Now()
+	_ = bus.Publish(svc.ReceivedEvent(chat.Message{
+		ID:        "SM0",
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	}))
+	bus.Wait()
+
+	if len(provider.Sent) == 0 {
+		t.Fatalf("No replies sent")
+	}
+	conversation, _ := store.ActiveConversation("+15555555555")
+	if conversation == nil {
+		t.Fatalf("Conversation not saved")
+	}
+	records, _ := store.ConversationMessages(conversation.ID)
+	if len(records) != 1+len(provider.Sent) {
+		t.Fatalf("Expected received and sent messages in transcript, got %d", len(records))
+	}
+	if records[0].Direction != chat.DirectionInbound || records[0].ProviderID != "SM0" || records[0].State != string(started) {
+		t.Errorf("Received message not recorded with state it was received in: %v", records[0])
+	}
+	sent := records[1]
+	if sent.Direction != chat.DirectionOutbound || sent.ProviderID != "SM1" || sent.Status != chat.StatusSent || sent.Segments < 1 {
+		t.Errorf("Sent message not recorded: %v", sent)
+	}
+
+	// Duplicate sent events aren't recorded again
+	_ = HandleSentMessage(sent.Message(), store)
+	if records, _ := store.ConversationMessages(conversation.ID); len(records) != 1+len(provider.Sent) {
+		t.Errorf("Duplicate sent message recorded")
+	}
+}
+
+func TestMessageHandlerSkipsDuplicates(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	messageHandler := &MessageHandler{Store: store, Bus: bus, Ledger: chat.NewMemoryLedger()}
+
+	createdAt := time.Now()
+	event := svc.ReceivedEvent(chat.Message{
+		ID:        "SM1",
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	})
+	_ = messageHandler.HandleEvent(event)
+	_ = messageHandler.HandleEvent(event)
+	if len(bus.Events) != 1 {
+		t.Errorf("Expected replies to be sent once, got %d", len(bus.Events))
+	}
+}
+
+func TestMessageHandlerRepublishesReplies(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{Err: errors.New("Unavailable")}
+	messageHandler := &MessageHandler{Store: store, Bus: bus, Ledger: chat.NewMemoryLedger()}
+
+	createdAt := time.Now()
+	event := svc.ReceivedEvent(chat.Message{
+		ID:        "SM1",
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	})
+	if err := messageHandler.HandleEvent(event); err == nil {
+		t.Fatalf("Publishing error not returned")
+	}
+	// The conversation was saved, so the retry publishes the saved replies
+	bus.Err = nil
+	if err := messageHandler.HandleEvent(event); err != nil || len(bus.Events) != 1 {
+		t.Errorf("Saved replies not published on retry: %v", err)
+	}
+	conversation, _ := store.ActiveConversation("+15555555555")
+	if records, _ := store.ConversationMessages(conversation.ID); len(records) != 1 {
+		t.Errorf("Message handled again on retry")
+	}
+	if _ = messageHandler.HandleEvent(event); len(bus.Events) != 1 {
+		t.Errorf("Published replies sent again")
+	}
+}
+
+func TestMessageHandlerDeliveryStatus(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	messageHandler := &MessageHandler{Store: store, Bus: bus}
+
+	createdAt := time.Now()
+	received := chat.Message{
+		ID:        "SM1",
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	}
+	_ = messageHandler.HandleEvent(svc.ReceivedEvent(received))
+	_ = messageHandler.HandleEvent(svc.SentEvent(chat.Message{
+		ID:        "SM2",
+		Sender:    "+15551234567",
+		Recipient: "+15555555555",
+		Body:      "Welcome",
+		CreatedAt: &createdAt,
+	}))
+
+	// Statuses arriving out of order don't replace later ones
+	_ = messageHandler.HandleEvent(svc.DeliveryStatusEvent(chat.DeliveryStatus{
+		MessageID:   "SM2",
+		Recipient:   "+15555555555",
+		Status:      chat.StatusUndelivered,
+		ErrorCode:   "30006",
+		Unreachable: true,
+	}))
+	_ = messageHandler.HandleEvent(svc.DeliveryStatusEvent(chat.DeliveryStatus{
+		MessageID: "SM2",
+		Recipient: "+15555555555",
+		Status:    chat.StatusSent,
+	}))
+	conversation, _ := store.ActiveConversation("+15555555555")
+	records, _ := store.ConversationMessages(conversation.ID)
+	if sent := records[len(records)-1]; sent.Status != chat.StatusUndelivered || sent.ErrorCode != "30006" {
+		t.Errorf("Delivery status not recorded: %v", sent)
+	}
+
+	// Replies aren't sent to unreachable contacts until they opt back in
+	if unreachable, _ := store.IsUnreachable("+15555555555"); !unreachable {
+		t.Fatalf("Contact not marked unreachable")
+	}
+	received.ID = "SM3"
+	received.Body = "0"
+	_ = messageHandler.HandleEvent(svc.ReceivedEvent(received))
+	if len(bus.Events) != 1 {
+		t.Errorf("Replies sent to unreachable contact")
+	}
+	received.ID = "SM4"
+	received.Body = "start"
+	_ = messageHandler.HandleEvent(svc.ReceivedEvent(received))
+	if unreachable, _ := store.IsUnreachable("+15555555555"); unreachable || len(bus.Events) != 2 {
+		t.Errorf("Replies not sent after contact opted in")
+	}
+}
+
+func TestMessageHandlerRateLimit(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	limiter := chat.NewMemoryRateLimiter(chat.RateLimitPolicy{Burst: 2, Refill: time.Hour})
+	messageHandler := &MessageHandler{Store: store, Bus: bus, Limiter: limiter}
+
+	createdAt := time.Now()
+	for _, body := range []string{"hi", "1", "2", "3"} {
+		_ = messageHandler.HandleEvent(svc.ReceivedEvent(chat.Message{
+			Sender:    "+15555555555",
+			Recipient: "+15551234567",
+			Body:      body,
+			CreatedAt: &createdAt,
+		}))
+	}
+	if len(bus.Events) != 3 {
+		t.Fatalf("Expected 2 replies and a warning, got %d", len(bus.Events))
+	}
+	warning := bus.Events[2].Messages[0]
+	if warning.Recipient != "+15555555555" || !strings.Contains(warning.Body, "Está enviando") {
+		t.Errorf("Localized warning not sent: %v", warning)
+	}
+	conversation, _ := store.ActiveConversation("+15555555555")
+	if records, _ := store.ConversationMessages(conversation.ID); len(records) != 2 {
+		t.Errorf("Rate limited messages handled, got %d records", len(records))
+	}
+
+	// Messages from blocked contacts are ignored
+	_ = limiter.Block("+15555555556", "spam")
+	_ = messageHandler.HandleEvent(svc.ReceivedEvent(chat.Message{
+		Sender:    "+15555555556",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	}))
+	if len(bus.Events) != 3 {
+		t.Errorf("Replies sent to blocked contact")
+	}
+}
+
+// Fails to take a token the first time, like a dropped database connection
+type failingLimiter struct {
+	*chat.MemoryRateLimiter
+	failed bool
+}
+
+func (l *failingLimiter) TakeToken(contact string, now time.Time) (chat.RateLimit, error) {
+	if !l.failed {
+		l.failed = true
+		return chat.RateAllowed, errors.New("Connection reset")
+	}
+	return l.MemoryRateLimiter.TakeToken(contact, now)
+}
+
+func TestMessageHandlerRateLimitError(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	limiter := &failingLimiter{MemoryRateLimiter: chat.NewMemoryRateLimiter(chat.NewRateLimitPolicy())}
+	messageHandler := &MessageHandler{Store: store, Bus: bus, Ledger: chat.NewMemoryLedger(), Limiter: limiter}
+
+	createdAt := time.Now()
+	event := svc.ReceivedEvent(chat.Message{
+		ID:        "SM1",
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      "hi",
+		CreatedAt: &createdAt,
+	})
+	if err := messageHandler.HandleEvent(event); err == nil {
+		t.Fatalf("Limiter error not returned")
+	}
+	// The retried event is handled instead of skipped as a duplicate
+	if err := messageHandler.HandleEvent(event); err != nil || len(bus.Events) != 1 {
+		t.Errorf("Retried message not handled after limiter error: %v", err)
+	}
+}
+
+func TestMessageHandlerOutboundLimit(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	limiter := chat.NewMemoryRateLimiter(chat.RateLimitPolicy{Burst: 10, Refill: time.Second, OutboundPerHour: 1})
+	messageHandler := &MessageHandler{Store: store, Bus: bus, Limiter: limiter}
+
+	createdAt := time.Now()
+	for _, contact := range []string{"+15555555555", "+15555555556"} {
+		_ = messageHandler.HandleEvent(svc.ReceivedEvent(chat.Message{
+			Sender:    contact,
+			Recipient: "+15551234567",
+			Body:      "hi",
+			CreatedAt: &createdAt,
+		}))
+	}
+	if len(bus.Events) != 0 {
+		t.Errorf("Replies over outbound limit sent")
+	}
+}
+
+// Handles another message for the same contact the first time a conversation is saved,
+// like a concurrent invocation finishing first
+type racingStore struct {
+	*chat.MemoryStore
+	other *chat.Message
+}
+
+func (s *racingStore) SaveConversation(conversation *chat.Conversation) error {
+	if other := s.other; other != nil && conversation.ID != 0 {
+		s.other = nil
+		if _, err := HandleReceivedMessage(*other, s.MemoryStore, nil); err != nil {
+			return err
+		}
+	}
+	return s.MemoryStore.SaveConversation(conversation)
+}
+
+func TestHandleReceivedMessageRetriesConflicts(t *testing.T) {
+	memoryStore, _ := chat.NewMemoryStore("")
+	store := &racingStore{MemoryStore: memoryStore}
+	createdAt := time.Now()
+	message := chat.Message{Sender: "+15555555555", Recipient: "+15551234567", CreatedAt: &createdAt}
+
+	message.ID, message.Body = "SM1", "hi"
+	_, _ = HandleReceivedMessage(message, store, nil)
+	other := message
+	other.ID, other.Body = "SM2", "0"
+	store.other = &other
+
+	// Picks a category after the concurrent message chose a language
+	message.ID, message.Body = "SM3", "1"
+	replies, err := HandleReceivedMessage(message, store, nil)
+	if err != nil || len(replies) == 0 {
+		t.Fatalf("Message not handled after conflict: %v", err)
+	}
+	conversation, _ := store.ActiveConversation("+15555555555")
+	var directoryChat DirectoryChat
+	_ = json.Unmarshal(conversation.Data.RawMessage, &directoryChat)
+	if directoryChat.Language != "en" || directoryChat.State == setLanguage || conversation.Version != 4 {
+		t.Errorf("Concurrent update lost, state %s, language %s", directoryChat.State, directoryChat.Language)
+	}
+}
+
+func TestConversationColumns(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	_, _ = HandleReceivedMessage(chat.Message{Sender: "+15555555555", Recipient: "+15551234567", Body: "hi"}, store, nil)
+
+	conversation, _ := store.ActiveConversation("+15555555555")
+	if conversation == nil {
+		t.Fatalf("Conversation not found by contact")
+	}
+	if conversation.Tenant != "+15551234567" || conversation.State != string(setLanguage) || conversation.Language != "en" {
+		t.Errorf("Conversation columns not set from chat: %v", conversation)
+	}
+}
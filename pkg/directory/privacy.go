@@ -0,0 +1,123 @@
+package directory
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+type privacyRequest string
+
+const (
+	dataSummaryRequest privacyRequest = "summary"
+	deleteDataRequest  privacyRequest = "delete"
+)
+
+const dataSummaryDateFormat = "2006-01-02"
+
+// Normalizes a message body for comparing to command keywords. Accents are removed so
+// that keywords match whether or not they're typed, like "SI" and "SÍ"
+func normalizeCommand(body string) string {
+	folded := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFD.String(body))
+	return strings.Join(strings.Fields(strings.ToUpper(folded)), " ")
+}
+
+// Returns whether a body matches a command keyword in the chat's language or in English
+func (c *DirectoryChat) matchesCommand(body string, commandID string) bool {
+	normalized := normalizeCommand(body)
+	localizers := []*i18n.Localizer{c.localizer}
+	if c.Language != "en" {
+		localizers = append(localizers, LoadLocalizer("en"))
+	}
+	for _, localizer := range localizers {
+		keyword := localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: commandID})
+		if normalized == normalizeCommand(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handles privacy commands, which can be sent at any point in a conversation. Returns
+// false if the message isn't a privacy command. Requests that need stored data are
+// completed by handlePrivacyRequest
+func (c *DirectoryChat) handlePrivacyCommand(body string) ([]string, bool) {
+	if c.PrivacyConfirm {
+		c.PrivacyConfirm = false
+		if c.matchesCommand(body, "command-confirm") {
+			c.privacyRequest = deleteDataRequest
+			return []string{}, true
+		}
+		return []string{c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "delete-data-cancelled",
+		})}, true
+	}
+	if c.matchesCommand(body, "command-delete-data") {
+		c.PrivacyConfirm = true
+		return []string{c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "delete-data-confirm",
+			TemplateData: map[string]string{
+				"Confirm": c.localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "command-confirm"}),
+			},
+		})}, true
+	}
+	if c.matchesCommand(body, "command-my-data") {
+		c.privacyRequest = dataSummaryRequest
+		return []string{}, true
+	}
+	return []string{}, false
+}
+
+// Builds the summary of what's stored for a contact
+func (c *DirectoryChat) buildDataSummary(data *chat.ContactData) []string {
+	firstSeen := ""
+	if data.FirstSeen != nil {
+		firstSeen = data.FirstSeen.Format(dataSummaryDateFormat)
+	}
+	return []string{c.localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "data-summary",
+		TemplateData: map[string]interface{}{
+			"Conversations": strconv.Itoa(data.Conversations),
+			"Messages":      strconv.Itoa(data.Messages),
+			"FirstSeen":     firstSeen,
+			// The sentence about anonymizing data is left out if it's turned off
+			"Days":   chat.PseudonymizeDays(),
+			"Delete": c.localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "command-delete-data"}),
+		},
+	})}
+}
+
+// Completes a privacy request from the last message handled, returning the replies and
+// whether the conversation was deleted and shouldn't be saved again
+func (c *DirectoryChat) handlePrivacyRequest(message chat.Message, store chat.ConversationStore) ([]chat.Message, bool, error) {
+	switch c.privacyRequest {
+	case dataSummaryRequest:
+		data, err := store.ContactData(message.Sender)
+		if err != nil {
+			return []chat.Message{}, false, err
+		}
+		return c.buildReplies(message, c.buildDataSummary(data)), false, nil
+	case deleteDataRequest:
+		data, err := store.DeleteContactData(message.Sender, svc.ChannelForAddress(message.Sender))
+		if err != nil {
+			return []chat.Message{}, false, err
+		}
+		log.Printf("Deleted %d conversations and %d messages on request", data.Conversations, data.Messages)
+		return c.buildReplies(message, []string{c.localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "delete-data-success",
+		})}), true, nil
+	}
+	return []chat.Message{}, false, nil
+}
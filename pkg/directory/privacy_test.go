@@ -0,0 +1,122 @@
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+func receive(t *testing.T, store chat.ConversationStore, body string) []chat.Message {
+	createdAt := time.Now()
+	replies, err := HandleReceivedMessage(chat.Message{
+		ID:        body + createdAt.String(),
+		Sender:    "+15555555555",
+		Recipient: "+15551234567",
+		Body:      body,
+		CreatedAt: &createdAt,
+	}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replies
+}
+
+func TestPrivacyCommands(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	receive(t, store, "hi")
+	receive(t, store, "0")
+
+	os.Setenv("RETENTION_PSEUDONYMIZE_DAYS", "14")
+	defer os.Unsetenv("RETENTION_PSEUDONYMIZE_DAYS")
+	replies := receive(t, store, "  my   data ")
+	if len(replies) != 1 || !strings.Contains(replies[0].Body, "3 messages") || !strings.Contains(replies[0].Body, "14 days") {
+		t.Errorf("Data summary not sent with retention window: %v", replies)
+	}
+	conversation, _ := store.ActiveConversation("+15555555555")
+	if conversation.State != string(setWhat) {
+		t.Errorf("Privacy command changed chat state to %s", conversation.State)
+	}
+
+	receive(t, store, "DELETE MY DATA")
+	replies = receive(t, store, "no")
+	if data, _ := store.ContactData("+15555555555"); data.Conversations != 1 {
+		t.Errorf("Data deleted without confirmation")
+	}
+	if len(replies) != 1 || !strings.Contains(replies[0].Body, "not been deleted") {
+		t.Errorf("Cancellation not sent: %v", replies)
+	}
+
+	receive(t, store, "DELETE MY DATA")
+	replies = receive(t, store, "YES")
+	if len(replies) != 1 || !strings.Contains(replies[0].Body, "erased") {
+		t.Errorf("Deletion confirmation not sent: %v", replies)
+	}
+	if data, _ := store.ContactData("+15555555555"); data.Conversations != 0 || data.Messages != 0 {
+		t.Errorf("Contact data not deleted: %v", data)
+	}
+
+	// The confirmation isn't recorded in a new conversation once it's sent
+	sentAt := time.Now()
+	reply := replies[0]
+	reply.ID = "SM1"
+	reply.CreatedAt = &sentAt
+	_ = HandleSentMessage(reply, store)
+	if data, _ := store.ContactData("+15555555555"); data.Conversations != 0 {
+		t.Errorf("Conversation created for sent confirmation")
+	}
+}
+
+func TestPrivacyCommandsLocalized(t *testing.T) {
+	dirChat := NewDirectoryChat("+15555555555")
+	dirChat.Language = "es"
+	dirChat.State = results
+	replies, _ := dirChat.HandleMessage(chat.Message{Body: "borrar mis datos"})
+	if len(replies) != 1 || !dirChat.PrivacyConfirm || !strings.Contains(replies[0].Body, "SI") {
+		t.Errorf("Localized delete command not handled: %v", replies)
+	}
+	_, _ = dirChat.HandleMessage(chat.Message{Body: "si"})
+	if dirChat.privacyRequest != deleteDataRequest || dirChat.State != results {
+		t.Errorf("Localized confirmation not handled")
+	}
+
+	// English keywords work in any language
+	_, _ = dirChat.HandleMessage(chat.Message{Body: "MY DATA"})
+	if dirChat.privacyRequest != dataSummaryRequest {
+		t.Errorf("English command not handled in Spanish chat")
+	}
+
+	// Accents are ignored when matching keywords
+	dirChat.PrivacyConfirm = true
+	dirChat.privacyRequest = ""
+	_, _ = dirChat.HandleMessage(chat.Message{Body: "Sí"})
+	if dirChat.privacyRequest != deleteDataRequest {
+		t.Errorf("Accented confirmation not handled")
+	}
+}
+
+func TestPrivacyCommandsTranslated(t *testing.T) {
+	paths, _ := filepath.Glob("i18n/*.json")
+	for _, path := range paths {
+		lang := strings.TrimSuffix(filepath.Base(path), ".json")
+		localizer := LoadLocalizer(lang)
+		for _, messageID := range []string{
+			"command-delete-data", "command-my-data", "command-confirm", "delete-data-confirm",
+			"delete-data-cancelled", "delete-data-success", "data-summary",
+		} {
+			_, tag, err := localizer.LocalizeWithTag(&i18n.LocalizeConfig{
+				MessageID:    messageID,
+				TemplateData: map[string]interface{}{"Days": 30},
+			})
+			if err != nil || tag != language.Make(lang) {
+				t.Errorf("Privacy message %s not translated for %s: %v", messageID, lang, err)
+			}
+		}
+	}
+}
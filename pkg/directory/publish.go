@@ -0,0 +1,132 @@
+package directory
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ImportPolicy sets when imported resources are published
+type ImportPolicy struct {
+	// Most errors an import can have and still be published, or -1 for no limit
+	MaxErrors int
+	// Most of the previously approved resources an import can remove or unapprove, as a
+	// percent, or -1 for no limit
+	MaxUnapprovedPercent float64
+	// Number of snapshots kept after publishing, or -1 to keep them all
+	KeepSnapshots int
+}
+
+// NewImportPolicy creates an ImportPolicy from IMPORT_MAX_ERRORS, with no limit by default,
+// IMPORT_MAX_UNAPPROVED_PERCENT, 20 by default, and IMPORT_KEEP_SNAPSHOTS, 100 by default
+func NewImportPolicy() ImportPolicy {
+	policy := ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: 20, KeepSnapshots: 100}
+	if maxErrors, err := strconv.Atoi(os.Getenv("IMPORT_MAX_ERRORS")); err == nil {
+		policy.MaxErrors = maxErrors
+	}
+	if maxPercent, err := strconv.ParseFloat(os.Getenv("IMPORT_MAX_UNAPPROVED_PERCENT"), 64); err == nil {
+		policy.MaxUnapprovedPercent = maxPercent
+	}
+	if keep, err := strconv.Atoi(os.Getenv("IMPORT_KEEP_SNAPSHOTS")); err == nil {
+		policy.KeepSnapshots = keep
+	}
+	return policy
+}
+
+// Snapshot IDs are UTC timestamps, so they sort in the order they were saved
+const snapshotIDFormat = "20060102T150405Z"
+
+var snapshotIDRe = regexp.MustCompile(`^\d{8}T\d{6}Z$`)
+
+// NewSnapshotID returns the ID for a snapshot saved at a time
+func NewSnapshotID(savedAt time.Time) string {
+	return savedAt.UTC().Format(snapshotIDFormat)
+}
+
+// PublishResources validates resources and compares them with the last snapshot, saving
+// the report. Unless nothing changed, a snapshot is held, or the report has more errors or
+// unapproved resources than the policy allows, the resources are published and saved as
+// a new snapshot
+func PublishResources(store ResourceStore, resources []Resource, policy ImportPolicy) (*ValidationReport, error) {
+	report := ValidateResources(resources)
+	latest, err := store.LatestSnapshot()
+	if err != nil {
+		return report, err
+	}
+	if latest != "" {
+		previous, err := store.LoadSnapshot(latest)
+		if err != nil {
+			return report, err
+		}
+		report.Diff = DiffResources(previous, resources)
+		report.Diff.Previous = latest
+	}
+	if err := store.SaveReport(report); err != nil {
+		return report, err
+	}
+	if report.Diff != nil && report.Diff.Empty() {
+		return report, nil
+	}
+	held, err := store.HeldSnapshot()
+	if err != nil {
+		return report, err
+	}
+	if held != "" {
+		return report, fmt.Errorf("Import not published while snapshot %s is held", held)
+	}
+
+	if policy.MaxErrors >= 0 && report.Errors > policy.MaxErrors {
+		return report, fmt.Errorf(
+			"Import not published with %d errors, more than the limit of %d",
+			report.Errors,
+			policy.MaxErrors,
+		)
+	}
+	if policy.MaxUnapprovedPercent >= 0 && report.Diff != nil &&
+		report.Diff.UnapprovedPercent() > policy.MaxUnapprovedPercent {
+		return report, fmt.Errorf(
+			"Import not published with %d of %d approved resources removed, more than the limit of %g%%",
+			len(report.Diff.Unapproved),
+			report.Diff.PreviousApproved,
+			policy.MaxUnapprovedPercent,
+		)
+	}
+	// Published before the snapshot is saved, so if publishing fails the next import
+	// isn't compared with resources contacts never saw
+	if err := store.SaveResources(resources); err != nil {
+		return report, err
+	}
+	if err := store.SaveSnapshot(NewSnapshotID(report.CreatedAt), resources); err != nil {
+		return report, err
+	}
+	if policy.KeepSnapshots > 0 {
+		if _, err := store.PruneSnapshots(policy.KeepSnapshots); err != nil {
+			log.Printf("Snapshots not pruned: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// RollbackResources publishes the resources from an earlier snapshot. They're also saved
+// as a new snapshot, so the next import is compared with the resources contacts see, and
+// that snapshot is held so imports don't publish over it until it's released
+func RollbackResources(store ResourceStore, id string) error {
+	if !snapshotIDRe.MatchString(id) {
+		return fmt.Errorf("Invalid snapshot ID %s", id)
+	}
+	resources, err := store.LoadSnapshot(id)
+	if err != nil {
+		return err
+	}
+	restoredID := NewSnapshotID(time.Now())
+	if err := store.SaveSnapshot(restoredID, resources); err != nil {
+		return err
+	}
+	if err := store.HoldSnapshot(restoredID); err != nil {
+		return err
+	}
+	return store.SaveResources(resources)
+}
@@ -0,0 +1,145 @@
+package directory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishResources(t *testing.T) {
+	store := NewMemoryResourceStore([]Resource{validResource()})
+	invalid := validResource()
+	invalid.Level = ""
+	resources := []Resource{validResource(), invalid, invalid}
+
+	report, err := PublishResources(store, resources, ImportPolicy{MaxErrors: 1, MaxUnapprovedPercent: -1})
+	if err == nil || report.Errors != 2 || store.Report != report {
+		t.Errorf("Import with too many errors published")
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 1 {
+		t.Errorf("Resources replaced by rejected import")
+	}
+
+	if _, err := PublishResources(store, resources, ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 3 {
+		t.Errorf("Resources not published without a limit")
+	}
+	if ids, _ := store.Snapshots(); len(ids) != 1 {
+		t.Errorf("Snapshot not saved for published resources")
+	}
+}
+
+func TestPublishResourcesUnapproved(t *testing.T) {
+	store := NewMemoryResourceStore([]Resource{})
+	policy := ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: 20}
+	resources := []Resource{}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		resource := validResource()
+		resource.ID = id
+		resources = append(resources, resource)
+	}
+	_ = store.SaveSnapshot(NewSnapshotID(time.Now().Add(-time.Hour)), resources)
+
+	// Removing one of five resources is within the limit
+	report, err := PublishResources(store, resources[1:], policy)
+	if err != nil || report.Diff == nil || len(report.Diff.Removed) != 1 {
+		t.Fatalf("Import within the limit not published: %v", err)
+	}
+
+	// Unapproving two of the remaining four is over the limit
+	unapproved := append([]Resource{}, resources[1:]...)
+	unapproved[0].Status = "Pending"
+	unapproved[1].Status = "Pending"
+	report, err = PublishResources(store, unapproved, policy)
+	if err == nil || len(report.Diff.Unapproved) != 2 || store.Report != report {
+		t.Errorf("Import unapproving resources published")
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 4 || set.Resources[0].Status != "Approved" {
+		t.Errorf("Resources replaced by rejected import")
+	}
+}
+
+func TestRollbackResources(t *testing.T) {
+	store := NewMemoryResourceStore([]Resource{})
+	earlier := NewSnapshotID(time.Now().Add(-time.Hour))
+	_ = store.SaveSnapshot(earlier, []Resource{{ID: "1"}, {ID: "2"}})
+	_ = store.SaveSnapshot(NewSnapshotID(time.Now().Add(-time.Minute)), []Resource{{ID: "1"}})
+	_ = store.SaveResources([]Resource{{ID: "1"}})
+
+	if err := RollbackResources(store, "../latest"); err == nil {
+		t.Errorf("Invalid snapshot ID accepted")
+	}
+	if err := RollbackResources(store, earlier); err != nil {
+		t.Fatal(err)
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 2 {
+		t.Errorf("Snapshot resources not published")
+	}
+	// The restored resources are the latest snapshot, so the next import is compared with them
+	ids, _ := store.Snapshots()
+	if latest, _ := store.LoadSnapshot(ids[len(ids)-1]); len(ids) != 3 || len(latest) != 2 {
+		t.Errorf("Rollback not saved as the latest snapshot")
+	}
+
+	// Imports aren't published over the restored resources until they're released
+	policy := ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: -1}
+	if held, _ := store.HeldSnapshot(); held != ids[len(ids)-1] {
+		t.Errorf("Restored snapshot not held")
+	}
+	if _, err := PublishResources(store, []Resource{{ID: "1"}}, policy); err == nil {
+		t.Errorf("Import published while snapshot held")
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 2 {
+		t.Errorf("Restored resources replaced while held")
+	}
+	_ = store.ReleaseSnapshot()
+	if _, err := PublishResources(store, []Resource{{ID: "1"}}, policy); err != nil {
+		t.Errorf("Import not published after release: %v", err)
+	}
+}
+
+func TestPublishResourcesUnchanged(t *testing.T) {
+	store := NewMemoryResourceStore([]Resource{})
+	policy := ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: -1, KeepSnapshots: 2}
+	for _, id := range []string{"20200430T120000Z", "20200501T120000Z"} {
+		_ = store.SaveSnapshot(id, []Resource{validResource()})
+	}
+
+	// Imports without changes aren't published or saved again
+	report, err := PublishResources(store, []Resource{validResource()}, policy)
+	if err != nil || store.Report != report || !report.Diff.Empty() {
+		t.Fatalf("Unchanged import not reported: %v", err)
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 0 {
+		t.Errorf("Unchanged import published")
+	}
+
+	// Only the newest snapshots are kept after publishing
+	changed := validResource()
+	changed.Name = "Changed"
+	if _, err := PublishResources(store, []Resource{changed}, policy); err != nil {
+		t.Fatal(err)
+	}
+	ids, _ := store.Snapshots()
+	if len(ids) != 2 || ids[0] != "20200501T120000Z" {
+		t.Errorf("Oldest snapshots not pruned: %v", ids)
+	}
+}
+
+func TestPublishResourcesReordered(t *testing.T) {
+	store := NewMemoryResourceStore([]Resource{})
+	policy := ImportPolicy{MaxErrors: -1, MaxUnapprovedPercent: -1, KeepSnapshots: 2}
+	other := validResource()
+	other.ID = "other"
+	_ = store.SaveSnapshot("20200501T120000Z", []Resource{validResource(), other})
+
+	// Imports that only reorder resources are published, since results are listed in order
+	report, err := PublishResources(store, []Resource{other, validResource()}, policy)
+	if err != nil || !report.Diff.Reordered {
+		t.Fatalf("Reordered import not reported: %v", err)
+	}
+	if set, _ := store.ResourceSet(); len(set.Resources) != 2 || set.Resources[0].ID != "other" {
+		t.Errorf("Reordered import not published")
+	}
+}
@@ -0,0 +1,85 @@
+package directory
+
+import (
+	"log"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// Returns whether a received message should be ignored because the contact is blocked or
+// sending too quickly. The first message over the limit gets a reply asking them to slow down
+func (h *MessageHandler) limitMessage(message chat.Message) (bool, error) {
+	blocked, err := h.Limiter.IsBlocked(message.Sender)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	limit, err := h.Limiter.TakeToken(message.Sender, time.Now())
+	if err != nil || limit == chat.RateAllowed {
+		return false, err
+	}
+	log.Printf("Rate limited message %s", message.ID)
+	if limit == chat.RateWarned {
+		return true, nil
+	}
+	lang := "en"
+	if conversation, err := h.Store.ActiveConversation(message.Sender); err == nil && conversation != nil && conversation.Language != "" {
+		lang = conversation.Language
+	}
+	reply := chat.Message{
+		Sender:    message.Recipient,
+		Recipient: message.Sender,
+		Body: LoadLocalizer(lang).MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "rate-limited",
+		}),
+		SessionStart: message.CreatedAt,
+	}
+	return true, h.PublishReplies(message.Sender, []chat.Message{reply})
+}
+
+// PublishReplies publishes replies to a contact unless the contact is unreachable or sending
+// them would go over the outbound limit. Every reply sent to contacts should be published
+// with it, so these checks apply however the replies were triggered
+func (h *MessageHandler) PublishReplies(contact string, replies []chat.Message) error {
+	if len(replies) == 0 {
+		return nil
+	}
+	unreachable, err := h.Store.IsUnreachable(contact)
+	if err != nil {
+		return err
+	}
+	if unreachable {
+		log.Printf("Skipping %d replies to unreachable contact", len(replies))
+		return nil
+	}
+	if h.Limiter != nil {
+		reserved, err := h.Limiter.ReserveOutbound(outboundSegments(replies), time.Now())
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			log.Printf("Outbound limit reached, skipping %d replies", len(replies))
+			return nil
+		}
+	}
+	return h.Bus.Publish(svc.SendRequestEvent(replies))
+}
+
+// Returns the number of billed segments for replies. SMS messages are billed by segment
+// and WhatsApp messages individually, while other channels are free
+func outboundSegments(replies []chat.Message) int {
+	segments := 0
+	for _, reply := range replies {
+		switch svc.ChannelForAddress(reply.Recipient) {
+		case svc.SMSChannel:
+			count, _ := svc.SMSSegments(reply.Body)
+			segments += count
+		case svc.WhatsAppChannel:
+			segments++
+		}
+	}
+	return segments
+}
@@ -1,26 +1,21 @@
 package directory
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
 
 // Resource represents one item from the Airtable directory
 type Resource struct {
+	ID             string     `json:"Record ID,omitempty"`
 	Name           string     `json:"Name"`
 	Link           string     `json:"Link"`
 	Phone          string     `json:"Phone"`
@@ -85,6 +80,33 @@ func (r *Resource) AsText(lang string, localizer *i18n.Localizer) string {
 	return resourceStr
 }
 
+// AsSpeech returns a resource as it should be read aloud in a phone call
+func (r *Resource) AsSpeech(lang string, localizer *i18n.Localizer) string {
+	parts := []string{r.Name}
+	langDescription := strings.TrimSpace(r.descriptionForLang(lang))
+	if langDescription != "" {
+		parts = append(parts, langDescription)
+	}
+	if r.Hours != "" {
+		parts = append(parts, fmt.Sprintf("%s: %s", localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "hours-label",
+		}), r.Hours))
+	}
+	if r.Phone != "" {
+		// Separate digits so that phone numbers are read one digit at a time
+		digits := []string{}
+		for _, char := range r.Phone {
+			if char >= '0' && char <= '9' {
+				digits = append(digits, string(char))
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "voice-phone-label",
+		}), strings.Join(digits, " ")))
+	}
+	return strings.Join(parts, ". ")
+}
+
 func (r *Resource) descriptionForLang(lang string) string {
 	switch {
 	case lang == "es" && r.DescriptionES != "":
@@ -104,6 +126,15 @@ func translateSlice(items []string, localizer *i18n.Localizer) string {
 	return strings.Join(translatedItems, ", ")
 }
 
+// Resources are sorted by level from most to least local, with unknown levels last
+var levelOrder = map[string]int{
+	"Neighborhood": 1,
+	"City":         2,
+	"County":       3,
+	"State":        4,
+	"National":     5,
+}
+
 type airtableRecord struct {
 	ID     string   `json:"id"`
 	Fields Resource `json:"fields"`
@@ -132,15 +163,15 @@ func loadAirtableRecords(base, table, key string) ([]airtableRecord, error) {
 		if err != nil {
 			return records, err
 		}
-		defer res.Body.Close()
-
 		body, readErr := ioutil.ReadAll(res.Body)
+		res.Body.Close()
 		if readErr != nil {
 			return records, readErr
 		}
-
-		resMap := airtableResponse{}
-		_ = json.Unmarshal(body, &resMap)
+		// Error responses would otherwise be read as an empty table
+		if res.StatusCode != http.StatusOK {
+			return records, fmt.Errorf("Airtable returned status %d: %s", res.StatusCode, body)
+		}
 
 		airtableRes := airtableResponse{}
 		jsonErr := json.Unmarshal(body, &airtableRes)
@@ -167,16 +198,13 @@ func LoadAirtableResources(base, table, key string) ([]Resource, error) {
 	}
 
 	for _, rec := range records {
+		// Keep the Airtable record ID so resources can be referenced individually
+		if rec.Fields.ID == "" {
+			rec.Fields.ID = rec.ID
+		}
 		resources = append(resources, rec.Fields)
 	}
 
-	levelOrder := map[string]int{
-		"Neighborhood": 1,
-		"City":         2,
-		"County":       3,
-		"State":        4,
-		"National":     5,
-	}
 	sort.SliceStable(resources, func(a, b int) bool {
 		aVal, aOk := levelOrder[resources[a].Level]
 		if !aOk {
@@ -195,30 +223,23 @@ func LoadAirtableResources(base, table, key string) ([]Resource, error) {
 	return resources, nil
 }
 
-// LoadResources pulls the latest resource items from S3
-func LoadResources() ([]Resource, error) {
-	var resources []Resource
-	sess, _ := session.NewSession()
-	svc := s3.New(sess)
-
-	results, err := svc.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(os.Getenv("S3_BUCKET")),
-		Key:    aws.String("latest.json"),
-	})
-	if err != nil {
-		return resources, err
+// FindResource returns the resource with a given ID if present
+func FindResource(resources []Resource, id string) (Resource, bool) {
+	for _, resource := range resources {
+		if resource.ID == id {
+			return resource, true
+		}
 	}
-	defer results.Body.Close()
+	return Resource{}, false
+}
 
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, results.Body); err != nil {
+// LoadResourcesFile reads resources from a local JSON file in the format saved to S3
+func LoadResourcesFile(path string) ([]Resource, error) {
+	var resources []Resource
+	resourcesJSON, err := ioutil.ReadFile(path)
+	if err != nil {
 		return resources, err
 	}
-
-	jsonErr := json.Unmarshal(buf.Bytes(), &resources)
-	if jsonErr != nil {
-		return resources, jsonErr
-	}
-
-	return resources, nil
+	err = json.Unmarshal(resourcesJSON, &resources)
+	return resources, err
 }
@@ -0,0 +1,835 @@
+package directory
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// ResourceStore loads and publishes the resource directory
+type ResourceStore interface {
+	// ResourceSet returns the latest resources and their index. The resources are shared
+	// and shouldn't be modified
+	ResourceSet() (*ResourceSet, error)
+	// SaveResources replaces the resources in the store
+	SaveResources(resources []Resource) error
+	// SaveReport saves the validation report for an import
+	SaveReport(report *ValidationReport) error
+	// SaveSnapshot saves resources as a snapshot that can be restored later
+	SaveSnapshot(id string, resources []Resource) error
+	// Snapshots returns the IDs of saved snapshots, oldest first
+	Snapshots() ([]string, error)
+	// LatestSnapshot returns the ID of the newest snapshot, or "" if none were saved
+	LatestSnapshot() (string, error)
+	// PruneSnapshots deletes all but the newest keep snapshots and returns how many were deleted
+	PruneSnapshots(keep int) (int64, error)
+	// HoldSnapshot keeps imports from publishing over a snapshot until it's released
+	HoldSnapshot(id string) error
+	// HeldSnapshot returns the ID of the held snapshot, or "" if imports can publish
+	HeldSnapshot() (string, error)
+	// ReleaseSnapshot lets imports publish again
+	ReleaseSnapshot() error
+	// LoadSnapshot returns the resources saved in a snapshot
+	LoadSnapshot(id string) ([]Resource, error)
+}
+
+// NewResourceStore returns the store set in RESOURCES_STORE: "s3" (the default) for
+// latest.json in S3_BUCKET, "file" for RESOURCES_FILE or "postgres" for db
+func NewResourceStore(db *gorm.DB) (ResourceStore, error) {
+	switch store := os.Getenv("RESOURCES_STORE"); store {
+	case "", "s3":
+		return NewS3ResourceStore(os.Getenv("S3_BUCKET")), nil
+	case "file":
+		return NewFileResourceStore(os.Getenv("RESOURCES_FILE")), nil
+	case "postgres":
+		if db == nil {
+			return nil, fmt.Errorf("Resource store %s requires a database", store)
+		}
+		return NewGormResourceStore(db), nil
+	default:
+		return nil, fmt.Errorf("Unknown resource store %s", store)
+	}
+}
+
+// OpenResourceDB opens Postgres for NewResourceStore from DATABASE_URL or the RDS_*
+// settings. It returns nil if RESOURCES_STORE isn't "postgres", since functions that
+// only read resources otherwise run outside the VPC
+func OpenResourceDB() (*gorm.DB, error) {
+	if os.Getenv("RESOURCES_STORE") != "postgres" {
+		return nil, nil
+	}
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		return gorm.Open("postgres", databaseURL)
+	}
+	return gorm.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s password=%s",
+		os.Getenv("RDS_HOST"),
+		os.Getenv("RDS_PORT"),
+		os.Getenv("RDS_USERNAME"),
+		os.Getenv("RDS_DB_NAME"),
+		os.Getenv("RDS_PASSWORD"),
+	))
+}
+
+// Stores share one cache so resources are kept across warm invocations that create a
+// new store. Resources are revalidated every RESOURCES_CACHE_INTERVAL, 1 minute by default
+var resourceCache = NewResourceCache(envDuration("RESOURCES_CACHE_INTERVAL", time.Minute))
+
+// S3ResourceStore keeps resources in latest.json in a bucket, along with their index
+// in index.json
+type S3ResourceStore struct {
+	Bucket string
+	cache  *ResourceCache
+}
+
+// NewS3ResourceStore is a constructor for S3ResourceStore structs
+func NewS3ResourceStore(bucket string) *S3ResourceStore {
+	return &S3ResourceStore{Bucket: bucket, cache: resourceCache}
+}
+
+// The S3 client is created once and reused across warm invocations
+var s3Client *s3.S3
+var s3ClientOnce sync.Once
+
+func getS3Client() *s3.S3 {
+	s3ClientOnce.Do(func() {
+		sess, _ := session.NewSession()
+		s3Client = s3.New(sess)
+	})
+	return s3Client
+}
+
+// ResourceSet returns cached resources, checking the ETag of latest.json when the interval has passed
+func (s *S3ResourceStore) ResourceSet() (*ResourceSet, error) {
+	return s.cache.ResourceSet(fmt.Sprintf("s3://%s/latest.json", s.Bucket), s3ResourceLoader(s.Bucket))
+}
+
+// SaveResources publishes latest.json and then index.json
+func (s *S3ResourceStore) SaveResources(resources []Resource) error {
+	resourcesJSON, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	index := BuildResourceIndex(resources)
+	index.Hash = hashResourcesJSON(resourcesJSON)
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := s.putJSON("latest.json", resourcesJSON); err != nil {
+		return err
+	}
+	// Published after the resources, readers rebuild the index if its hash doesn't match them
+	return s.putJSON("index.json", indexJSON)
+}
+
+// SaveReport publishes validation.json
+func (s *S3ResourceStore) SaveReport(report *ValidationReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return s.putJSON("validation.json", reportJSON)
+}
+
+// s3SnapshotPointer is saved to snapshot.json so the latest snapshot can be found
+// without listing every snapshot, and to hold.json while a snapshot is held
+type s3SnapshotPointer struct {
+	ID string `json:"id"`
+}
+
+// SaveSnapshot publishes resources to snapshots/ with the ID as the file name, and then
+// points snapshot.json to it
+func (s *S3ResourceStore) SaveSnapshot(id string, resources []Resource) error {
+	resourcesJSON, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	if err := s.putJSON(fmt.Sprintf("snapshots/%s.json", id), resourcesJSON); err != nil {
+		return err
+	}
+	pointerJSON, err := json.Marshal(s3SnapshotPointer{ID: id})
+	if err != nil {
+		return err
+	}
+	return s.putJSON("snapshot.json", pointerJSON)
+}
+
+// Snapshots lists the files in snapshots/
+func (s *S3ResourceStore) Snapshots() ([]string, error) {
+	ids := []string{}
+	err := getS3Client().ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String("snapshots/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(key, "snapshots/"), ".json"))
+		}
+		return true
+	})
+	sort.Strings(ids)
+	return ids, err
+}
+
+// LatestSnapshot reads the ID in snapshot.json, listing snapshots/ if it hasn't been saved
+func (s *S3ResourceStore) LatestSnapshot() (string, error) {
+	results, err := getS3Client().GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String("snapshot.json"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return latestSnapshot(s.Snapshots())
+	} else if err != nil {
+		return "", err
+	}
+	defer results.Body.Close()
+	var pointer s3SnapshotPointer
+	err = json.NewDecoder(results.Body).Decode(&pointer)
+	return pointer.ID, err
+}
+
+// HoldSnapshot saves the ID to hold.json
+func (s *S3ResourceStore) HoldSnapshot(id string) error {
+	pointerJSON, err := json.Marshal(s3SnapshotPointer{ID: id})
+	if err != nil {
+		return err
+	}
+	return s.putJSON("hold.json", pointerJSON)
+}
+
+// HeldSnapshot reads the ID in hold.json, if it exists
+func (s *S3ResourceStore) HeldSnapshot() (string, error) {
+	results, err := getS3Client().GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String("hold.json"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer results.Body.Close()
+	var pointer s3SnapshotPointer
+	err = json.NewDecoder(results.Body).Decode(&pointer)
+	return pointer.ID, err
+}
+
+// ReleaseSnapshot deletes hold.json
+func (s *S3ResourceStore) ReleaseSnapshot() error {
+	_, err := getS3Client().DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String("hold.json"),
+	})
+	return err
+}
+
+// PruneSnapshots deletes the oldest files in snapshots/
+func (s *S3ResourceStore) PruneSnapshots(keep int) (int64, error) {
+	ids, err := s.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	// DeleteObjects accepts up to 1000 keys per request
+	for _, batch := range batchIDs(pruneIDs(ids, keep), 1000) {
+		objects := []*s3.ObjectIdentifier{}
+		for _, id := range batch {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(fmt.Sprintf("snapshots/%s.json", id))})
+		}
+		_, err := getS3Client().DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(s.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int64(len(batch))
+	}
+	return deleted, nil
+}
+
+// LoadSnapshot reads a file from snapshots/
+func (s *S3ResourceStore) LoadSnapshot(id string) ([]Resource, error) {
+	results, err := getS3Client().GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(fmt.Sprintf("snapshots/%s.json", id)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Body.Close()
+	var resources []Resource
+	err = json.NewDecoder(results.Body).Decode(&resources)
+	return resources, err
+}
+
+func (s *S3ResourceStore) putJSON(key string, body []byte) error {
+	_, err := getS3Client().PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		ACL:         aws.String("private"),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// Returns a loader for latest.json in a bucket that makes a conditional request when
+// resources were already loaded, along with the index published in index.json
+func s3ResourceLoader(bucket string) resourceLoader {
+	return func(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error) {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("latest.json"),
+		}
+		if since != nil && since.ETag != "" {
+			input.IfNoneMatch = aws.String(since.ETag)
+		} else if since != nil {
+			input.IfModifiedSince = aws.Time(since.LastModified)
+		}
+		results, err := getS3Client().GetObject(input)
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotModified {
+			return nil, since, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		defer results.Body.Close()
+
+		buf := bytes.NewBuffer(nil)
+		if _, err := io.Copy(buf, results.Body); err != nil {
+			return nil, nil, err
+		}
+		var resources []Resource
+		if err := json.Unmarshal(buf.Bytes(), &resources); err != nil {
+			return nil, nil, err
+		}
+		// The index is rebuilt from the resources if it can't be loaded
+		index, err := loadS3Index(bucket)
+		if err != nil {
+			log.Printf("Index not loaded: %v", err)
+		}
+		set := &ResourceSet{Resources: resources, Index: index, Hash: hashResourcesJSON(buf.Bytes())}
+		return set, &ResourceVersion{
+			Source:       fmt.Sprintf("s3://%s/latest.json", bucket),
+			ETag:         aws.StringValue(results.ETag),
+			LastModified: aws.TimeValue(results.LastModified),
+		}, nil
+	}
+}
+
+func loadS3Index(bucket string) (*ResourceIndex, error) {
+	results, err := getS3Client().GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("index.json"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Body.Close()
+	var index ResourceIndex
+	if err := json.NewDecoder(results.Body).Decode(&index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// FileResourceStore keeps resources in a local JSON file in the format saved to S3
+type FileResourceStore struct {
+	Path  string
+	cache *ResourceCache
+}
+
+// NewFileResourceStore is a constructor for FileResourceStore structs
+func NewFileResourceStore(path string) *FileResourceStore {
+	return &FileResourceStore{Path: path, cache: resourceCache}
+}
+
+// ResourceSet returns cached resources, reading the file again if it was modified
+func (s *FileResourceStore) ResourceSet() (*ResourceSet, error) {
+	return s.cache.ResourceSet(s.Path, fileResourceLoader(s.Path))
+}
+
+// SaveResources writes resources to the file
+func (s *FileResourceStore) SaveResources(resources []Resource) error {
+	resourcesJSON, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, resourcesJSON)
+}
+
+// SaveReport writes the report next to the resources, like resources.validation.json
+func (s *FileResourceStore) SaveReport(report *ValidationReport) error {
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(strings.TrimSuffix(s.Path, filepath.Ext(s.Path))+".validation.json", reportJSON)
+}
+
+// Snapshots are kept in a snapshots directory next to the resources file
+func (s *FileResourceStore) snapshotPath(id string) string {
+	return filepath.Join(filepath.Dir(s.Path), "snapshots", id+".json")
+}
+
+// SaveSnapshot writes resources to a file in the snapshots directory
+func (s *FileResourceStore) SaveSnapshot(id string, resources []Resource) error {
+	resourcesJSON, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	path := s.snapshotPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, resourcesJSON)
+}
+
+// Snapshots lists the files in the snapshots directory
+func (s *FileResourceStore) Snapshots() ([]string, error) {
+	ids := []string{}
+	files, err := ioutil.ReadDir(filepath.Dir(s.snapshotPath("")))
+	if os.IsNotExist(err) {
+		return ids, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// LatestSnapshot returns the last file in the snapshots directory
+func (s *FileResourceStore) LatestSnapshot() (string, error) {
+	return latestSnapshot(s.Snapshots())
+}
+
+// PruneSnapshots removes the oldest files in the snapshots directory
+func (s *FileResourceStore) PruneSnapshots(keep int) (int64, error) {
+	ids, err := s.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, id := range pruneIDs(ids, keep) {
+		if err := os.Remove(s.snapshotPath(id)); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// LoadSnapshot reads a file from the snapshots directory
+func (s *FileResourceStore) LoadSnapshot(id string) ([]Resource, error) {
+	return LoadResourcesFile(s.snapshotPath(id))
+}
+
+// The held snapshot ID is kept next to the resources, like resources.hold
+func (s *FileResourceStore) holdPath() string {
+	return strings.TrimSuffix(s.Path, filepath.Ext(s.Path)) + ".hold"
+}
+
+// HoldSnapshot writes the ID to the hold file
+func (s *FileResourceStore) HoldSnapshot(id string) error {
+	return writeFileAtomic(s.holdPath(), []byte(id))
+}
+
+// HeldSnapshot reads the ID in the hold file, if it exists
+func (s *FileResourceStore) HeldSnapshot() (string, error) {
+	id, err := ioutil.ReadFile(s.holdPath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(id)), err
+}
+
+// ReleaseSnapshot removes the hold file
+func (s *FileResourceStore) ReleaseSnapshot() error {
+	if err := os.Remove(s.holdPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Returns the last of a list of snapshot IDs sorted oldest first, or "" if it's empty
+func latestSnapshot(ids []string, err error) (string, error) {
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	return ids[len(ids)-1], nil
+}
+
+// Returns the IDs to delete from a list sorted oldest first to keep the newest
+func pruneIDs(ids []string, keep int) []string {
+	if len(ids) <= keep {
+		return []string{}
+	}
+	return ids[:len(ids)-keep]
+}
+
+// Splits IDs into batches of at most size
+func batchIDs(ids []string, size int) [][]string {
+	batches := [][]string{}
+	for len(ids) > size {
+		batches = append(batches, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		batches = append(batches, ids)
+	}
+	return batches
+}
+
+// Writes to a temporary file and moves it into place, so readers never load a partial file
+func writeFileAtomic(path string, body []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(body); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// Returns a loader for a local file that reads it again when its modification time changes
+func fileResourceLoader(path string) resourceLoader {
+	return func(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if since != nil && since.LastModified.Equal(info.ModTime()) {
+			return nil, since, nil
+		}
+		resources, err := LoadResourcesFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &ResourceSet{Resources: resources}, &ResourceVersion{Source: path, LastModified: info.ModTime()}, nil
+	}
+}
+
+// ResourceRecord is a resource stored in Postgres at its position in the directory
+type ResourceRecord struct {
+	Position  int
+	ID        string
+	Data      postgres.Jsonb
+	UpdatedAt time.Time
+}
+
+// TableName sets the table for resource records
+func (ResourceRecord) TableName() string {
+	return "directory_resources"
+}
+
+// GormResourceStore keeps resources in Postgres
+type GormResourceStore struct {
+	DB    *gorm.DB
+	cache *ResourceCache
+}
+
+// NewGormResourceStore is a constructor for GormResourceStore structs
+func NewGormResourceStore(db *gorm.DB) *GormResourceStore {
+	return &GormResourceStore{DB: db, cache: resourceCache}
+}
+
+// ResourceSet returns cached resources, loading them again if the table was updated
+func (s *GormResourceStore) ResourceSet() (*ResourceSet, error) {
+	return s.cache.ResourceSet("postgres:directory_resources", s.load)
+}
+
+// Loads resources if the number of rows or the last time they were updated changed
+func (s *GormResourceStore) load(since *ResourceVersion) (*ResourceSet, *ResourceVersion, error) {
+	var count int
+	var updatedAt *time.Time
+	err := s.DB.Raw("SELECT COUNT(*), MAX(updated_at) FROM directory_resources").Row().Scan(&count, &updatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	version := &ResourceVersion{Source: "postgres:directory_resources", ETag: strconv.Itoa(count)}
+	if updatedAt != nil {
+		version.LastModified = *updatedAt
+	}
+	if since != nil && since.ETag == version.ETag && since.LastModified.Equal(version.LastModified) {
+		return nil, since, nil
+	}
+
+	var records []ResourceRecord
+	if err := s.DB.Order("position").Find(&records).Error; err != nil {
+		return nil, nil, err
+	}
+	resources := []Resource{}
+	for _, record := range records {
+		var resource Resource
+		if err := json.Unmarshal(record.Data.RawMessage, &resource); err != nil {
+			return nil, nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return &ResourceSet{Resources: resources}, version, nil
+}
+
+// SaveResources replaces every row in one transaction, so readers see either the
+// previous resources or the new ones
+func (s *GormResourceStore) SaveResources(resources []Resource) error {
+	updatedAt := time.Now()
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM directory_resources").Error; err != nil {
+			return err
+		}
+		for pos, resource := range resources {
+			resourceJSON, err := json.Marshal(resource)
+			if err != nil {
+				return err
+			}
+			err = tx.Exec(
+				"INSERT INTO directory_resources (position, id, data, updated_at) VALUES (?, ?, ?, ?)",
+				pos,
+				resource.ID,
+				postgres.Jsonb{RawMessage: resourceJSON},
+				updatedAt,
+			).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveReport adds the report to import_reports
+func (s *GormResourceStore) SaveReport(report *ValidationReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return s.DB.Exec(
+		"INSERT INTO import_reports (created_at, resources, errors, warnings, report) VALUES (?, ?, ?, ?, ?)",
+		report.CreatedAt,
+		report.Resources,
+		report.Errors,
+		report.Warnings,
+		postgres.Jsonb{RawMessage: reportJSON},
+	).Error
+}
+
+// SaveSnapshot adds resources to resource_snapshots, replacing a snapshot saved in the same second
+func (s *GormResourceStore) SaveSnapshot(id string, resources []Resource) error {
+	resourcesJSON, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+	return s.DB.Exec(
+		`INSERT INTO resource_snapshots (id, created_at, resources) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET created_at = EXCLUDED.created_at, resources = EXCLUDED.resources`,
+		id,
+		time.Now(),
+		postgres.Jsonb{RawMessage: resourcesJSON},
+	).Error
+}
+
+// Snapshots returns the IDs in resource_snapshots
+func (s *GormResourceStore) Snapshots() ([]string, error) {
+	ids := []string{}
+	err := s.DB.Table("resource_snapshots").Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// LatestSnapshot returns the highest ID in resource_snapshots
+func (s *GormResourceStore) LatestSnapshot() (string, error) {
+	ids := []string{}
+	err := s.DB.Table("resource_snapshots").Order("id DESC").Limit(1).Pluck("id", &ids).Error
+	return latestSnapshot(ids, err)
+}
+
+// PruneSnapshots deletes all but the rows with the highest IDs from resource_snapshots
+func (s *GormResourceStore) PruneSnapshots(keep int) (int64, error) {
+	query := s.DB.Exec(
+		`DELETE FROM resource_snapshots
+		WHERE id NOT IN (SELECT id FROM resource_snapshots ORDER BY id DESC LIMIT ?)`,
+		keep,
+	)
+	return query.RowsAffected, query.Error
+}
+
+// HoldSnapshot marks a row in resource_snapshots as held, releasing any other
+func (s *GormResourceStore) HoldSnapshot(id string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Exec("UPDATE resource_snapshots SET held = true WHERE id = ?", id)
+		if query.Error != nil {
+			return query.Error
+		} else if query.RowsAffected == 0 {
+			return fmt.Errorf("Snapshot %s not found", id)
+		}
+		return tx.Exec("UPDATE resource_snapshots SET held = false WHERE held AND id <> ?", id).Error
+	})
+}
+
+// HeldSnapshot returns the ID of the held row in resource_snapshots
+func (s *GormResourceStore) HeldSnapshot() (string, error) {
+	ids := []string{}
+	err := s.DB.Table("resource_snapshots").Where("held").Limit(1).Pluck("id", &ids).Error
+	return latestSnapshot(ids, err)
+}
+
+// ReleaseSnapshot unmarks the held row in resource_snapshots
+func (s *GormResourceStore) ReleaseSnapshot() error {
+	return s.DB.Exec("UPDATE resource_snapshots SET held = false WHERE held").Error
+}
+
+// LoadSnapshot returns the resources for a row in resource_snapshots
+func (s *GormResourceStore) LoadSnapshot(id string) ([]Resource, error) {
+	var resourcesJSON []byte
+	err := s.DB.Raw("SELECT resources FROM resource_snapshots WHERE id = ?", id).Row().Scan(&resourcesJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Snapshot %s not found", id)
+	} else if err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	err = json.Unmarshal(resourcesJSON, &resources)
+	return resources, err
+}
+
+// MemoryResourceStore keeps resources in memory
+type MemoryResourceStore struct {
+	// Report is the last validation report saved
+	Report    *ValidationReport
+	set       *ResourceSet
+	snapshots map[string][]Resource
+	held      string
+	mutex     sync.Mutex
+}
+
+// NewMemoryResourceStore is a constructor for MemoryResourceStore structs
+func NewMemoryResourceStore(resources []Resource) *MemoryResourceStore {
+	store := &MemoryResourceStore{snapshots: map[string][]Resource{}}
+	_ = store.SaveResources(resources)
+	return store
+}
+
+// ResourceSet returns the resources and their index
+func (s *MemoryResourceStore) ResourceSet() (*ResourceSet, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.set, nil
+}
+
+// SaveResources replaces the resources and indexes them
+func (s *MemoryResourceStore) SaveResources(resources []Resource) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set = &ResourceSet{Resources: resources, Index: BuildResourceIndex(resources)}
+	return nil
+}
+
+// SaveReport keeps the report
+func (s *MemoryResourceStore) SaveReport(report *ValidationReport) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Report = report
+	return nil
+}
+
+// SaveSnapshot keeps resources as a snapshot
+func (s *MemoryResourceStore) SaveSnapshot(id string, resources []Resource) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots[id] = resources
+	return nil
+}
+
+// Snapshots returns the IDs of the snapshots kept
+func (s *MemoryResourceStore) Snapshots() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := []string{}
+	for id := range s.snapshots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// LatestSnapshot returns the highest ID of the snapshots kept
+func (s *MemoryResourceStore) LatestSnapshot() (string, error) {
+	return latestSnapshot(s.Snapshots())
+}
+
+// PruneSnapshots removes all but the newest snapshots kept
+func (s *MemoryResourceStore) PruneSnapshots(keep int) (int64, error) {
+	ids, _ := s.Snapshots()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var deleted int64
+	for _, id := range pruneIDs(ids, keep) {
+		delete(s.snapshots, id)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// HoldSnapshot keeps the ID as the held snapshot
+func (s *MemoryResourceStore) HoldSnapshot(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.held = id
+	return nil
+}
+
+// HeldSnapshot returns the ID of the held snapshot
+func (s *MemoryResourceStore) HeldSnapshot() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.held, nil
+}
+
+// ReleaseSnapshot clears the held snapshot
+func (s *MemoryResourceStore) ReleaseSnapshot() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.held = ""
+	return nil
+}
+
+// LoadSnapshot returns the resources in a snapshot
+func (s *MemoryResourceStore) LoadSnapshot(id string) ([]Resource, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resources, ok := s.snapshots[id]
+	if !ok {
+		return nil, fmt.Errorf("Snapshot %s not found", id)
+	}
+	return resources, nil
+}
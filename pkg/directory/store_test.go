@@ -0,0 +1,223 @@
+package directory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+func TestHandleResultsFromStore(t *testing.T) {
+	zip := "60601"
+	dirChat := NewDirectoryChat("test")
+	dirChat.Resources = NewMemoryResourceStore([]Resource{
+		{ID: "1", Name: "Food pantry", Category: []string{"Food"}, Level: "City", Status: "Approved"},
+		{ID: "2", Name: "Rent help", Category: []string{"Housing"}, Level: "City", Status: "Approved"},
+	})
+	dirChat.localizer = LoadLocalizer("en")
+	dirChat.State = results
+	dirChat.Params = &FilterParams{What: []string{"Food"}, ZIP: &zip}
+
+	bodies, err := dirChat.handleResults("")
+	if err != nil || len(bodies) != 1 {
+		t.Fatalf("Results not loaded from store: %v", err)
+	}
+	if !strings.Contains(bodies[0], "Food pantry") || strings.Contains(bodies[0], "Rent help") {
+		t.Errorf("Results not filtered: %s", bodies[0])
+	}
+
+	dirChat.Resources = nil
+	dirChat.Page = 0
+	if _, err := dirChat.handleResults(""); err != ErrNoResourceStore {
+		t.Errorf("Results loaded without a store")
+	}
+}
+
+func TestFileResourceStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "resources")
+	defer os.RemoveAll(dir)
+	store := NewFileResourceStore(filepath.Join(dir, "resources.json"))
+	store.cache = NewResourceCache(0)
+
+	if err := store.SaveResources([]Resource{{ID: "1"}, {ID: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := store.ResourceSet()
+	if err != nil || len(set.Resources) != 2 || !set.Index.Matches(set) {
+		t.Fatalf("Saved resources not loaded: %v", err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Temporary file left after saving")
+	}
+
+	if ids, err := store.Snapshots(); err != nil || len(ids) != 0 {
+		t.Errorf("Snapshots listed before any were saved: %v", err)
+	}
+	_ = store.SaveSnapshot("20200501T120000Z", []Resource{{ID: "1"}})
+	_ = store.SaveSnapshot("20200430T120000Z", []Resource{{ID: "2"}})
+	ids, _ := store.Snapshots()
+	if len(ids) != 2 || ids[0] != "20200430T120000Z" {
+		t.Errorf("Snapshots not listed in order: %v", ids)
+	}
+	if resources, _ := store.LoadSnapshot(ids[1]); len(resources) != 1 || resources[0].ID != "1" {
+		t.Errorf("Snapshot not loaded")
+	}
+	if latest, err := store.LatestSnapshot(); err != nil || latest != "20200501T120000Z" {
+		t.Errorf("Latest snapshot not returned: %s %v", latest, err)
+	}
+	if deleted, err := store.PruneSnapshots(1); err != nil || deleted != 1 {
+		t.Errorf("Snapshots not pruned: %v", err)
+	}
+	if ids, _ := store.Snapshots(); len(ids) != 1 || ids[0] != "20200501T120000Z" {
+		t.Errorf("Newest snapshot not kept: %v", ids)
+	}
+
+	if held, err := store.HeldSnapshot(); err != nil || held != "" {
+		t.Errorf("Snapshot held before one was held: %v", err)
+	}
+	_ = store.HoldSnapshot("20200501T120000Z")
+	if held, _ := store.HeldSnapshot(); held != "20200501T120000Z" {
+		t.Errorf("Held snapshot not returned: %s", held)
+	}
+	if err := store.ReleaseSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := store.HeldSnapshot(); held != "" {
+		t.Errorf("Snapshot still held after release")
+	}
+}
+
+func TestGormResourceStore(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	gormDB, _ := gorm.Open("postgres", db)
+	store := &GormResourceStore{DB: gormDB, cache: NewResourceCache(0)}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DELETE FROM directory_resources").WillReturnResult(sqlmock.NewResult(0, 3))
+	dbMock.ExpectExec("INSERT INTO directory_resources").
+		WithArgs(0, "1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO directory_resources").
+		WithArgs(1, "2", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	if err := store.SaveResources([]Resource{{ID: "1"}, {ID: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	updatedAt := time.Now()
+	dbMock.ExpectQuery("SELECT COUNT(.+) FROM directory_resources").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(2, updatedAt))
+	dbMock.ExpectQuery(`SELECT (.+) FROM "directory_resources" ORDER BY (.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"position", "id", "data"}).
+			AddRow(0, "1", []byte(`{"Record ID": "1"}`)).
+			AddRow(1, "2", []byte(`{"Record ID": "2"}`)))
+	set, err := store.ResourceSet()
+	if err != nil || len(set.Resources) != 2 || set.Resources[1].ID != "2" {
+		t.Fatalf("Resources not loaded from table: %v", err)
+	}
+
+	// Resources aren't loaded again if the table is unchanged
+	dbMock.ExpectQuery("SELECT COUNT(.+) FROM directory_resources").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(2, updatedAt))
+	if set, _ := store.ResourceSet(); len(set.Resources) != 2 {
+		t.Errorf("Cached resources not returned")
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGormResourceStoreSnapshots(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	gormDB, _ := gorm.Open("postgres", db)
+	store := NewGormResourceStore(gormDB)
+
+	dbMock.ExpectExec("INSERT INTO resource_snapshots (.+) ON CONFLICT").
+		WithArgs("20200501T120000Z", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.SaveSnapshot("20200501T120000Z", []Resource{{ID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	dbMock.ExpectQuery(`SELECT id FROM "resource_snapshots" ORDER BY (.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("20200430T120000Z").AddRow("20200501T120000Z"))
+	if ids, err := store.Snapshots(); err != nil || len(ids) != 2 {
+		t.Errorf("Snapshots not listed: %v", err)
+	}
+	dbMock.ExpectQuery("SELECT resources FROM resource_snapshots WHERE id = (.+)").
+		WithArgs("20200501T120000Z").
+		WillReturnRows(sqlmock.NewRows([]string{"resources"}).AddRow([]byte(`[{"Record ID": "1"}]`)))
+	if resources, err := store.LoadSnapshot("20200501T120000Z"); err != nil || len(resources) != 1 {
+		t.Errorf("Snapshot not loaded: %v", err)
+	}
+	dbMock.ExpectQuery("SELECT resources FROM resource_snapshots WHERE id = (.+)").
+		WithArgs("20200502T120000Z").
+		WillReturnRows(sqlmock.NewRows([]string{"resources"}))
+	if _, err := store.LoadSnapshot("20200502T120000Z"); err == nil {
+		t.Errorf("Missing snapshot loaded")
+	}
+	dbMock.ExpectQuery(`SELECT id FROM "resource_snapshots" ORDER BY id DESC LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("20200501T120000Z"))
+	if latest, err := store.LatestSnapshot(); err != nil || latest != "20200501T120000Z" {
+		t.Errorf("Latest snapshot not returned: %s %v", latest, err)
+	}
+	dbMock.ExpectExec("DELETE FROM resource_snapshots WHERE id NOT IN (.+) LIMIT").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if deleted, err := store.PruneSnapshots(1); err != nil || deleted != 1 {
+		t.Errorf("Snapshots not pruned: %v", err)
+	}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE resource_snapshots SET held = true WHERE id = (.+)").
+		WithArgs("20200501T120000Z").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("UPDATE resource_snapshots SET held = false WHERE held AND id <> (.+)").
+		WithArgs("20200501T120000Z").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	if err := store.HoldSnapshot("20200501T120000Z"); err != nil {
+		t.Errorf("Snapshot not held: %v", err)
+	}
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE resource_snapshots SET held = true WHERE id = (.+)").
+		WithArgs("20200502T120000Z").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+	if err := store.HoldSnapshot("20200502T120000Z"); err == nil {
+		t.Errorf("Missing snapshot held")
+	}
+	dbMock.ExpectQuery(`SELECT id FROM "resource_snapshots" WHERE \(held\) LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("20200501T120000Z"))
+	if held, err := store.HeldSnapshot(); err != nil || held != "20200501T120000Z" {
+		t.Errorf("Held snapshot not returned: %s %v", held, err)
+	}
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewResourceStore(t *testing.T) {
+	defer os.Unsetenv("RESOURCES_STORE")
+	os.Setenv("RESOURCES_STORE", "")
+	if store, _ := NewResourceStore(nil); store == nil {
+		t.Errorf("S3 store not returned by default")
+	} else if _, ok := store.(*S3ResourceStore); !ok {
+		t.Errorf("S3 store not returned by default")
+	}
+	os.Setenv("RESOURCES_STORE", "postgres")
+	if _, err := NewResourceStore(nil); err == nil {
+		t.Errorf("Postgres store returned without a database")
+	}
+	os.Setenv("RESOURCES_STORE", "dynamodb")
+	if _, err := NewResourceStore(nil); err == nil {
+		t.Errorf("Unknown store returned")
+	}
+}
@@ -0,0 +1,155 @@
+package directory
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Severities of validation issues. Issues with approved resources are errors since
+// they reach contacts, and issues with other resources are warnings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue is a problem with one field of a resource
+type ValidationIssue struct {
+	ResourceID string `json:"resource_id"`
+	Name       string `json:"name"`
+	Field      string `json:"field"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Value      string `json:"value,omitempty"`
+}
+
+// ValidationReport summarizes the issues found in an import
+type ValidationReport struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Resources int               `json:"resources"`
+	Approved  int               `json:"approved"`
+	Errors    int               `json:"errors"`
+	Warnings  int               `json:"warnings"`
+	Issues    []ValidationIssue `json:"issues"`
+	// Changes since the last snapshot, if there is one
+	Diff *ResourceDiff `json:"diff,omitempty"`
+}
+
+// Phone numbers with an optional country code and extension, or N11 numbers like 311
+var phoneRe = regexp.MustCompile(`^(\+?1[\s.-]?)?\(?\d{3}\)?[\s.-]?\d{3}[\s.-]?\d{4}(\s*(ext\.?|x|,)\s*\d+)?$|^[2-9]11$`)
+var zipRe = regexp.MustCompile(`^\d{5}$`)
+
+// ValidateResources checks resources against the options contacts can filter by, checks
+// the format of contact info and ZIPs, and checks approved resources have required fields
+func ValidateResources(resources []Resource) *ValidationReport {
+	report := &ValidationReport{CreatedAt: time.Now(), Resources: len(resources), Issues: []ValidationIssue{}}
+	whatOpts := whatOptions()
+	whoOpts := whoOptions()
+	areaZIPs := map[string]bool{}
+	for zip, neighbors := range ZIPCodeMap() {
+		areaZIPs[zip] = true
+		for _, neighbor := range neighbors {
+			areaZIPs[neighbor] = true
+		}
+	}
+
+	for _, resource := range resources {
+		severity := SeverityWarning
+		if resource.Status == "Approved" {
+			severity = SeverityError
+			report.Approved++
+		}
+		add := func(field, message, value string) {
+			report.addIssue(ValidationIssue{
+				ResourceID: resource.ID,
+				Name:       resource.Name,
+				Field:      field,
+				Severity:   severity,
+				Message:    message,
+				Value:      value,
+			})
+		}
+
+		if strings.TrimSpace(resource.Name) == "" {
+			add("Name", "Name is required", "")
+		}
+		if resource.Phone == "" && resource.Link == "" && resource.Email == "" && resource.Address == "" {
+			add("Phone", "Phone, link, email or address is required", "")
+		}
+		if _, ok := levelOrder[resource.Level]; !ok {
+			add("Level", "Level is not a known level", resource.Level)
+		}
+		if len(resource.Category) == 0 {
+			add("Category", "Category is required", "")
+		}
+		for _, value := range unknownValues(resource.Category, whatOpts[1:]) {
+			add("Category", "Category is not a filter option", value)
+		}
+		for _, value := range unknownValues(resource.Who, whoOpts[1:len(whoOpts)-1]) {
+			add("Who", "Who is not a filter option", value)
+		}
+		for _, value := range unknownValues(resource.Languages, languageOptions()) {
+			add("Languages", "Language is not a supported language", value)
+		}
+
+		if resource.Phone != "" && !phoneRe.MatchString(strings.TrimSpace(resource.Phone)) {
+			add("Phone", "Phone is not a valid phone number", resource.Phone)
+		}
+		if resource.Link != "" && !isValidLink(resource.Link) {
+			add("Link", "Link is not a valid URL", resource.Link)
+		}
+		if resource.Email != "" {
+			if address, err := mail.ParseAddress(resource.Email); err != nil || address.Address != strings.TrimSpace(resource.Email) {
+				add("Email", "Email is not a valid email address", resource.Email)
+			}
+		}
+
+		// Neighborhood resources are matched by comparing their ZIP with nearby ZIPs
+		if resource.Level == "Neighborhood" {
+			zip := strings.TrimSpace(resource.ZIP)
+			if !zipRe.MatchString(zip) {
+				add("ZIP", "Neighborhood resources need one 5 digit ZIP", resource.ZIP)
+			} else if !areaZIPs[zip] {
+				add("ZIP", "ZIP is outside the area and won't match nearby ZIPs", resource.ZIP)
+			}
+		}
+	}
+	return report
+}
+
+func (r *ValidationReport) addIssue(issue ValidationIssue) {
+	if issue.Severity == SeverityError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Returns values that aren't options
+func unknownValues(values []string, options []string) []string {
+	unknown := []string{}
+	for _, value := range values {
+		if !stringSlicesOverlap([]string{value}, options) {
+			unknown = append(unknown, value)
+		}
+	}
+	return unknown
+}
+
+// Links are sent as text, so they can leave off the scheme
+func isValidLink(link string) bool {
+	link = strings.TrimSpace(link)
+	if strings.ContainsAny(link, " \t\n") {
+		return false
+	}
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	parsed, err := url.Parse(link)
+	return err == nil &&
+		(parsed.Scheme == "http" || parsed.Scheme == "https") &&
+		strings.Contains(parsed.Hostname(), ".")
+}
@@ -0,0 +1,90 @@
+package directory
+
+import (
+	"testing"
+)
+
+func validResource() Resource {
+	return Resource{
+		ID:        "rec1",
+		Name:      "Food pantry",
+		Phone:     "(312) 555-0100",
+		Link:      "https://example.com/food",
+		Email:     "info@example.com",
+		Category:  []string{"Food"},
+		Who:       []string{"Families"},
+		Languages: []string{"en", "es"},
+		Level:     "Neighborhood",
+		ZIP:       "60601",
+		Status:    "Approved",
+	}
+}
+
+func issueFields(report *ValidationReport) map[string]string {
+	fields := map[string]string{}
+	for _, issue := range report.Issues {
+		fields[issue.Field] = issue.Severity
+	}
+	return fields
+}
+
+func TestValidateResources(t *testing.T) {
+	if report := ValidateResources([]Resource{validResource()}); len(report.Issues) != 0 {
+		t.Errorf("Issues reported for a valid resource: %v", report.Issues)
+	}
+
+	invalid := validResource()
+	invalid.Level = "Citywide"
+	invalid.Category = []string{"Fod"}
+	invalid.Who = []string{"Seniors"}
+	invalid.Languages = []string{"English"}
+	invalid.Phone = "555-0100"
+	invalid.Link = "not a link"
+	invalid.Email = "info at example.com"
+	report := ValidateResources([]Resource{invalid})
+	fields := issueFields(report)
+	for _, field := range []string{"Level", "Category", "Who", "Languages", "Phone", "Link", "Email"} {
+		if fields[field] != SeverityError {
+			t.Errorf("Error not reported for %s", field)
+		}
+	}
+	if report.Errors != len(report.Issues) || report.Warnings != 0 || report.Approved != 1 {
+		t.Errorf("Report counts not updated: %+v", report)
+	}
+
+	// Approved resources need contact info, and issues with other resources are warnings
+	missing := Resource{ID: "rec2", Name: "Rent help", Category: []string{"Housing"}, Level: "City", Status: "Approved"}
+	pending := validResource()
+	pending.Status = "Pending"
+	pending.ZIP = "60601, 60602"
+	report = ValidateResources([]Resource{missing, pending})
+	if report.Errors != 1 || report.Warnings != 1 || report.Issues[0].ResourceID != "rec2" {
+		t.Errorf("Missing contact info and pending resource not reported: %+v", report.Issues)
+	}
+	if issueFields(report)["ZIP"] != SeverityWarning {
+		t.Errorf("Neighborhood resource with multiple ZIPs not reported")
+	}
+}
+
+func TestValidateContactFormats(t *testing.T) {
+	for _, phone := range []string{"312-555-0100", "+1 (312) 555-0100", "312.555.0100 ext. 2", "311"} {
+		if !phoneRe.MatchString(phone) {
+			t.Errorf("Valid phone %s not matched", phone)
+		}
+	}
+	for _, phone := range []string{"555-0100", "call 312-555-0100", "312-555-01000"} {
+		if phoneRe.MatchString(phone) {
+			t.Errorf("Invalid phone %s matched", phone)
+		}
+	}
+	for _, link := range []string{"https://example.com", "www.example.org/path", "example.com"} {
+		if !isValidLink(link) {
+			t.Errorf("Valid link %s not matched", link)
+		}
+	}
+	for _, link := range []string{"example", "ftp://example.com", "https://example .com"} {
+		if isValidLink(link) {
+			t.Errorf("Invalid link %s matched", link)
+		}
+	}
+}
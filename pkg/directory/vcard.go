@@ -0,0 +1,103 @@
+package directory
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// VCardContentType is the MIME type of generated contact cards
+const VCardContentType = "text/vcard"
+
+// How long signed vCard URLs stay valid after a result is sent
+const vcardTTL = time.Hour * 24 * 7
+
+// Twilio allows up to 10 media items in a single MMS
+const maxMMSMedia = 10
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// AsVCard returns the resource as a vCard that can be saved as a contact
+func (r *Resource) AsVCard(lang string) string {
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		fmt.Sprintf("FN:%s", vcardEscaper.Replace(r.Name)),
+		fmt.Sprintf("ORG:%s", vcardEscaper.Replace(r.Name)),
+	}
+	if r.Phone != "" {
+		lines = append(lines, fmt.Sprintf("TEL;TYPE=WORK,VOICE:%s", vcardEscaper.Replace(r.Phone)))
+	}
+	if r.Email != "" {
+		lines = append(lines, fmt.Sprintf("EMAIL;TYPE=WORK:%s", vcardEscaper.Replace(r.Email)))
+	}
+	if r.Link != "" {
+		lines = append(lines, fmt.Sprintf("URL:%s", vcardEscaper.Replace(r.Link)))
+	}
+	if r.Address != "" {
+		lines = append(lines, fmt.Sprintf("ADR;TYPE=WORK:;;%s;;;%s;", vcardEscaper.Replace(r.Address), vcardEscaper.Replace(r.ZIP)))
+	}
+	note := strings.TrimSpace(r.descriptionForLang(lang))
+	if r.Hours != "" {
+		note = strings.TrimSpace(fmt.Sprintf("%s\n\n%s", note, r.Hours))
+	}
+	if note != "" {
+		lines = append(lines, fmt.Sprintf("NOTE:%s", vcardEscaper.Replace(note)))
+	}
+	lines = append(lines, "END:VCARD")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func vcardSignature(id, lang string, expires int64, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(fmt.Sprintf("%s:%s:%d", id, lang, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VCardURL returns a signed URL for downloading a resource's vCard that expires after ttl
+func VCardURL(endpoint, id, lang, key string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("lang", lang)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", vcardSignature(id, lang, expires, key))
+	return fmt.Sprintf("%s/%s.vcf?%s", strings.TrimRight(endpoint, "/"), url.PathEscape(id), query.Encode())
+}
+
+// CheckVCardSignature validates that a vCard request was signed with key and hasn't expired
+func CheckVCardSignature(id string, query url.Values, key string) bool {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := vcardSignature(id, query.Get("lang"), expires, key)
+	return hmac.Equal([]byte(expected), []byte(query.Get("signature")))
+}
+
+// Returns vCard attachments for resources if an endpoint and signing key are configured
+func vcardMedia(resources []Resource, lang string) []chat.Media {
+	var media []chat.Media
+	endpoint := os.Getenv("VCARD_ENDPOINT")
+	key := os.Getenv("VCARD_SIGNING_KEY")
+	if endpoint == "" || key == "" {
+		return media
+	}
+	for _, resource := range resources {
+		if resource.ID == "" || len(media) >= maxMMSMedia {
+			continue
+		}
+		media = append(media, chat.Media{
+			URL:         VCardURL(endpoint, resource.ID, lang, key, vcardTTL),
+			ContentType: VCardContentType,
+		})
+	}
+	return media
+}
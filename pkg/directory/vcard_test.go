@@ -0,0 +1,45 @@
+package directory
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsVCard(t *testing.T) {
+	resource := Resource{Name: "Test, Inc.", Phone: "555-555-5555", Description: "Food;\nhelp"}
+	vcard := resource.AsVCard("en")
+	if !strings.HasPrefix(vcard, "BEGIN:VCARD\r\n") || !strings.HasSuffix(vcard, "END:VCARD\r\n") {
+		t.Errorf("vCard not wrapped in BEGIN and END lines")
+	}
+	if !strings.Contains(vcard, `FN:Test\, Inc.`) || !strings.Contains(vcard, `NOTE:Food\;\nhelp`) {
+		t.Errorf("vCard values not escaped correctly")
+	}
+	if strings.Contains(vcard, "EMAIL") {
+		t.Errorf("vCard including empty fields")
+	}
+}
+
+func TestCheckVCardSignature(t *testing.T) {
+	vcardURL, _ := url.Parse(VCardURL("https://example.com/api/vcard/", "rec123", "es", "key", time.Hour))
+	if vcardURL.Path != "/api/vcard/rec123.vcf" {
+		t.Errorf("vCard URL path not built correctly")
+	}
+	query := vcardURL.Query()
+	if !CheckVCardSignature("rec123", query, "key") {
+		t.Errorf("Valid vCard signature not accepted")
+	}
+	if CheckVCardSignature("rec456", query, "key") || CheckVCardSignature("rec123", query, "other") {
+		t.Errorf("vCard signature accepted for different ID or key")
+	}
+	query.Set("lang", "en")
+	if CheckVCardSignature("rec123", query, "key") {
+		t.Errorf("vCard signature accepted with modified query")
+	}
+
+	expiredURL, _ := url.Parse(VCardURL("https://example.com", "rec123", "en", "key", -time.Minute))
+	if CheckVCardSignature("rec123", expiredURL.Query(), "key") {
+		t.Errorf("Expired vCard signature accepted")
+	}
+}
@@ -0,0 +1,523 @@
+package directory
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+type voiceStep string
+
+const (
+	voiceStarted  voiceStep = ""
+	voiceLanguage voiceStep = "language"
+	voiceWhat     voiceStep = "what"
+	voiceWho      voiceStep = "who"
+	voiceZIP      voiceStep = "zip"
+	voiceResults  voiceStep = "results"
+)
+
+// Seconds to wait for input before repeating a prompt
+const voiceTimeout = 6
+
+// voiceLang is a language with a Twilio text-to-speech voice
+type voiceLang struct {
+	Code     string
+	Voice    string
+	Language string
+}
+
+// Only languages with voices available in Twilio are offered over the phone
+func voiceLanguages() []voiceLang {
+	return []voiceLang{
+		{Code: "en", Voice: "Polly.Joanna", Language: "en-US"},
+		{Code: "es", Voice: "Polly.Lupe", Language: "es-US"},
+		{Code: "zh", Voice: "Polly.Zhiyu", Language: "cmn-CN"},
+		{Code: "ar", Voice: "Polly.Zeina", Language: "arb"},
+		{Code: "pl", Voice: "Polly.Ewa", Language: "pl-PL"},
+		{Code: "fr", Voice: "Polly.Celine", Language: "fr-FR"},
+		{Code: "ko", Voice: "Polly.Seoyeon", Language: "ko-KR"},
+	}
+}
+
+func voiceLanguageFor(code string) voiceLang {
+	for _, lang := range voiceLanguages() {
+		if lang.Code == code {
+			return lang
+		}
+	}
+	return voiceLanguages()[0]
+}
+
+// VoiceCall manages a phone call walking through the same steps as DirectoryChat.
+// State is kept in action URL query parameters, so each request is independent
+type VoiceCall struct {
+	Step     voiceStep
+	Language string
+	What     string
+	Who      string
+	ZIP      string
+	Page     int
+	Caller   string
+	Called   string
+	// URL Twilio should send gathered input to, without query parameters
+	ActionURL string
+	// Store results are loaded from
+	Resources ResourceStore
+}
+
+type twimlResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	Verbs   []interface{}
+}
+
+type twimlSay struct {
+	XMLName  xml.Name `xml:"Say"`
+	Voice    string   `xml:"voice,attr,omitempty"`
+	Language string   `xml:"language,attr,omitempty"`
+	Text     string   `xml:",chardata"`
+}
+
+type twimlGather struct {
+	XMLName     xml.Name   `xml:"Gather"`
+	Input       string     `xml:"input,attr"`
+	Action      string     `xml:"action,attr"`
+	Method      string     `xml:"method,attr"`
+	NumDigits   int        `xml:"numDigits,attr,omitempty"`
+	FinishOnKey string     `xml:"finishOnKey,attr,omitempty"`
+	Timeout     int        `xml:"timeout,attr"`
+	Language    string     `xml:"language,attr,omitempty"`
+	Hints       string     `xml:"hints,attr,omitempty"`
+	Says        []twimlSay `xml:"Say"`
+}
+
+type twimlRedirect struct {
+	XMLName xml.Name `xml:"Redirect"`
+	Method  string   `xml:"method,attr"`
+	URL     string   `xml:",chardata"`
+}
+
+type twimlHangup struct {
+	XMLName xml.Name `xml:"Hangup"`
+}
+
+// NewVoiceCall creates a VoiceCall from the query parameters of an action URL
+func NewVoiceCall(actionURL string, query url.Values) *VoiceCall {
+	page, _ := strconv.Atoi(query.Get("page"))
+	return &VoiceCall{
+		Step:      voiceStep(query.Get("step")),
+		Language:  query.Get("lang"),
+		What:      query.Get("what"),
+		Who:       query.Get("who"),
+		ZIP:       query.Get("zip"),
+		Page:      page,
+		ActionURL: actionURL,
+	}
+}
+
+// Returns the action URL for a step, including current state
+func (v *VoiceCall) stepURL(step voiceStep) string {
+	query := url.Values{}
+	query.Set("step", string(step))
+	if v.Language != "" {
+		query.Set("lang", v.Language)
+	}
+	if v.What != "" {
+		query.Set("what", v.What)
+	}
+	if v.Who != "" {
+		query.Set("who", v.Who)
+	}
+	if v.ZIP != "" {
+		query.Set("zip", v.ZIP)
+	}
+	if v.Page > 0 {
+		query.Set("page", strconv.Itoa(v.Page))
+	}
+	return fmt.Sprintf("%s?%s", v.ActionURL, query.Encode())
+}
+
+// Builds a DirectoryChat with filters set from the call's input, reusing the chat's parsing
+func (v *VoiceCall) directoryChat() *DirectoryChat {
+	directoryChat := NewDirectoryChat(v.Caller)
+	directoryChat.Resources = v.Resources
+	directoryChat.Language = voiceLanguageFor(v.Language).Code
+	directoryChat.localizer = LoadLocalizer(directoryChat.Language)
+	if v.What != "" {
+		_, _ = directoryChat.handleSetWhat(v.What)
+	}
+	if v.Who != "" {
+		_, _ = directoryChat.handleSetWho(v.Who)
+	}
+	if v.ZIP != "" {
+		directoryChat.Params.ZIP = &v.ZIP
+		directoryChat.State = results
+	}
+	directoryChat.Page = v.Page
+	return directoryChat
+}
+
+// HandleInput returns the TwiML response for DTMF digits or speech gathered for the
+// current step. textResults is true if the caller asked for results by text message
+func (v *VoiceCall) HandleInput(digits, speech string) (twiml string, textResults bool, err error) {
+	var verbs []interface{}
+
+	switch v.Step {
+	case voiceStarted:
+		verbs = v.languageMenu()
+	case voiceLanguage:
+		verbs = v.handleLanguage(digits, speech)
+	case voiceWhat:
+		verbs = v.handleWhat(digits, speech)
+	case voiceWho:
+		verbs = v.handleWho(digits, speech)
+	case voiceZIP:
+		verbs, err = v.handleZIP(digits, speech)
+	case voiceResults:
+		verbs, textResults, err = v.handleResultsInput(digits, speech)
+	default:
+		verbs = v.languageMenu()
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	twimlBytes, err := xml.Marshal(twimlResponse{Verbs: verbs})
+	if err != nil {
+		return "", false, err
+	}
+	return xml.Header + string(twimlBytes), textResults, nil
+}
+
+func (v *VoiceCall) say(localizer *i18n.Localizer, config *i18n.LocalizeConfig) twimlSay {
+	return v.sayText(localizer.MustLocalize(config))
+}
+
+func (v *VoiceCall) sayText(text string) twimlSay {
+	lang := voiceLanguageFor(v.Language)
+	return twimlSay{Voice: lang.Voice, Language: lang.Language, Text: text}
+}
+
+func (v *VoiceCall) gather(step voiceStep, says []twimlSay, numDigits int, hints []string) []interface{} {
+	lang := voiceLanguageFor(v.Language)
+	gather := twimlGather{
+		Input:     "dtmf speech",
+		Action:    v.stepURL(step),
+		Method:    "POST",
+		NumDigits: numDigits,
+		Timeout:   voiceTimeout,
+		Language:  lang.Language,
+		Hints:     strings.Join(hints, ","),
+		Says:      says,
+	}
+	if numDigits == 0 {
+		gather.FinishOnKey = "#"
+	}
+	// Repeat the prompt if nothing is entered
+	return []interface{}{gather, twimlRedirect{Method: "POST", URL: v.stepURL(v.Step)}}
+}
+
+func (v *VoiceCall) languageMenu() []interface{} {
+	v.Step = voiceLanguage
+	says := []twimlSay{}
+	hints := []string{}
+	for idx, lang := range voiceLanguages() {
+		localizer := LoadLocalizer(lang.Code)
+		says = append(says, twimlSay{
+			Voice:    lang.Voice,
+			Language: lang.Language,
+			Text: localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID:    "voice-language-option",
+				TemplateData: map[string]string{"Number": strconv.Itoa(idx + 1)},
+			}),
+		})
+		hints = append(hints, languageNames[lang.Code])
+	}
+	// Say the title in English before the language options
+	intro := twimlSay{
+		Voice:    voiceLanguages()[0].Voice,
+		Language: voiceLanguages()[0].Language,
+		Text:     LoadLocalizer("en").MustLocalize(&i18n.LocalizeConfig{MessageID: "site-title"}),
+	}
+	return append([]interface{}{intro}, v.gather(voiceLanguage, says, 1, hints)...)
+}
+
+func (v *VoiceCall) handleLanguage(digits, speech string) []interface{} {
+	langs := voiceLanguages()
+	for idx, lang := range langs {
+		if digits == strconv.Itoa(idx+1) || (digits == "" && speech != "" &&
+			strings.Contains(strings.ToLower(speech), strings.ToLower(languageNames[lang.Code]))) {
+			v.Language = lang.Code
+			return v.optionsMenu(voiceWhat, "what-prompt")
+		}
+	}
+	return v.languageMenu()
+}
+
+// Reads a menu of what or who options, using the same options as text messages
+func (v *VoiceCall) optionsMenu(step voiceStep, promptID string) []interface{} {
+	v.Step = step
+	directoryChat := v.directoryChat()
+	if step == voiceWhat {
+		directoryChat.buildWhatMessage()
+	} else {
+		directoryChat.buildWhoMessage()
+	}
+	localizer := directoryChat.localizer
+
+	says := []twimlSay{
+		v.say(localizer, &i18n.LocalizeConfig{MessageID: promptID}),
+		v.say(localizer, &i18n.LocalizeConfig{MessageID: "voice-enter-numbers"}),
+	}
+	hints := []string{}
+	for _, option := range directoryChat.menu.Options {
+		says = append(says, v.say(localizer, &i18n.LocalizeConfig{
+			MessageID:    "voice-option",
+			TemplateData: map[string]string{"Option": option.Label, "Number": option.Value},
+		}))
+		hints = append(hints, option.Label)
+	}
+	return v.gather(step, says, 0, hints)
+}
+
+// Converts speech to the numbers of options mentioned, keeping any digits recognized
+func speechToOptions(speech string, options []chat.Option) string {
+	values := []string{}
+	lowerSpeech := strings.ToLower(speech)
+	for _, option := range options {
+		if option.Label != "" && strings.Contains(lowerSpeech, strings.ToLower(option.Label)) {
+			values = append(values, option.Value)
+		}
+	}
+	digitRe := regexp.MustCompile(`\d+`)
+	values = append(values, digitRe.FindAllString(speech, -1)...)
+	return strings.Join(values, " ")
+}
+
+func (v *VoiceCall) inputOrSpeech(digits, speech string, menu *chat.Menu) string {
+	if digits != "" {
+		return digits
+	}
+	if menu == nil {
+		return speech
+	}
+	return speechToOptions(speech, menu.Options)
+}
+
+func (v *VoiceCall) invalidOption(promptID string) twimlSay {
+	directoryChat := v.directoryChat()
+	return v.say(directoryChat.localizer, &i18n.LocalizeConfig{MessageID: promptID})
+}
+
+func (v *VoiceCall) handleWhat(digits, speech string) []interface{} {
+	directoryChat := v.directoryChat()
+	directoryChat.State = setWhat
+	directoryChat.buildWhatMessage()
+	input := v.inputOrSpeech(digits, speech, directoryChat.menu)
+	_, _ = directoryChat.handleSetWhat(input)
+	if directoryChat.State != setWho {
+		return append([]interface{}{v.invalidOption("please-enter-valid-option")}, v.optionsMenu(voiceWhat, "what-prompt")...)
+	}
+	v.What = input
+	return v.optionsMenu(voiceWho, "who-prompt")
+}
+
+func (v *VoiceCall) handleWho(digits, speech string) []interface{} {
+	directoryChat := v.directoryChat()
+	directoryChat.State = setWho
+	directoryChat.buildWhoMessage()
+	input := v.inputOrSpeech(digits, speech, directoryChat.menu)
+	_, _ = directoryChat.handleSetWho(input)
+	if directoryChat.State != setZIP {
+		return append([]interface{}{v.invalidOption("please-enter-valid-option")}, v.optionsMenu(voiceWho, "who-prompt")...)
+	}
+	v.Who = input
+	return v.zipMenu()
+}
+
+func (v *VoiceCall) zipMenu() []interface{} {
+	v.Step = voiceZIP
+	localizer := v.directoryChat().localizer
+	says := []twimlSay{v.say(localizer, &i18n.LocalizeConfig{MessageID: "voice-zip-prompt"})}
+	return v.gather(voiceZIP, says, 5, []string{})
+}
+
+func (v *VoiceCall) handleZIP(digits, speech string) ([]interface{}, error) {
+	zipStr := parseZIP(v.inputOrSpeech(digits, speech, nil))
+	if zipStr == "" {
+		return append([]interface{}{v.invalidOption("please-enter-valid-zip")}, v.zipMenu()...), nil
+	}
+	v.ZIP = zipStr
+	v.Page = 0
+	return v.readResults()
+}
+
+// Reads a page of results, then prompts for texting them, hearing more or restarting
+func (v *VoiceCall) readResults() ([]interface{}, error) {
+	v.Step = voiceResults
+	directoryChat := v.directoryChat()
+	localizer := directoryChat.localizer
+	results, err := directoryChat.loadResults()
+	if err != nil {
+		return nil, err
+	}
+
+	says := []twimlSay{}
+	if len(results) == 0 {
+		says = append(says, v.say(localizer, &i18n.LocalizeConfig{MessageID: "no-results"}))
+	} else if v.Page == 0 {
+		says = append(says, v.say(localizer, &i18n.LocalizeConfig{
+			MessageID:   "results-available",
+			PluralCount: len(results),
+		}))
+	}
+	pageResults, _ := PaginateResults(results, v.Page)
+	for _, result := range pageResults {
+		says = append(says, v.sayText(result.AsSpeech(directoryChat.Language, localizer)))
+	}
+	return v.resultsMenu(localizer, results, says), nil
+}
+
+// Returns the options at the results step for the current page. Labels are the words
+// callers can say instead of pressing a number
+func (v *VoiceCall) resultsOptions(localizer *i18n.Localizer, results []Resource) []chat.Option {
+	options := []chat.Option{}
+	if len(results) > 0 {
+		options = append(options, chat.Option{
+			Value: "1",
+			Label: localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "voice-text-results-option"}),
+		})
+	}
+	if _, hasRemaining := PaginateResults(results, v.Page); hasRemaining {
+		options = append(options, chat.Option{
+			Value: "2",
+			Label: localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "voice-more-results-option"}),
+		})
+	}
+	return append(options, chat.Option{
+		Value: "3",
+		Label: localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "voice-restart-option"}),
+	})
+}
+
+// Prompts for each of the options at the results step after says
+func (v *VoiceCall) resultsMenu(localizer *i18n.Localizer, results []Resource, says []twimlSay) []interface{} {
+	promptIDs := map[string]string{
+		"1": "voice-text-results-prompt",
+		"2": "voice-more-results-prompt",
+		"3": "voice-restart-prompt",
+	}
+	hints := []string{}
+	for _, option := range v.resultsOptions(localizer, results) {
+		says = append(says, v.say(localizer, &i18n.LocalizeConfig{
+			MessageID:    promptIDs[option.Value],
+			TemplateData: map[string]string{"Number": option.Value},
+		}))
+		hints = append(hints, option.Label)
+	}
+	return v.gather(voiceResults, says, 1, hints)
+}
+
+// Handles the option chosen after results are read, repeating the prompts if no option
+// was entered or the input doesn't match one
+func (v *VoiceCall) handleResultsInput(digits, speech string) ([]interface{}, bool, error) {
+	directoryChat := v.directoryChat()
+	localizer := directoryChat.localizer
+	results, err := directoryChat.loadResults()
+	if err != nil {
+		return nil, false, err
+	}
+	options := v.resultsOptions(localizer, results)
+	input := ""
+	if fields := strings.Fields(v.inputOrSpeech(digits, speech, &chat.Menu{Options: options})); len(fields) > 0 {
+		input = fields[0]
+	}
+	isOption := false
+	for _, option := range options {
+		isOption = isOption || option.Value == input
+	}
+	if !isOption {
+		says := []twimlSay{}
+		if digits != "" || speech != "" {
+			says = append(says, v.invalidOption("please-enter-valid-option"))
+		}
+		return v.resultsMenu(localizer, results, says), false, nil
+	}
+
+	switch input {
+	case "1":
+		return []interface{}{
+			v.say(localizer, &i18n.LocalizeConfig{MessageID: "voice-text-sent"}),
+			twimlHangup{},
+		}, true, nil
+	case "2":
+		v.Page++
+		verbs, err := v.readResults()
+		return verbs, false, err
+	default:
+		v.What = ""
+		v.Who = ""
+		v.ZIP = ""
+		v.Page = 0
+		return v.optionsMenu(voiceWhat, "what-prompt"), false, nil
+	}
+}
+
+// TextVoiceResults saves a call's filters as the caller's conversation so they can keep
+// paging by text, then publishes the first page of results. If Limiter is set, blocked
+// callers aren't texted and the results count toward the outbound limit
+func (h *MessageHandler) TextVoiceResults(voiceCall *VoiceCall) error {
+	if h.Limiter != nil {
+		blocked, err := h.Limiter.IsBlocked(voiceCall.Caller)
+		if err != nil || blocked {
+			return err
+		}
+	}
+	directoryChat := voiceCall.ResultsChat()
+	replies, err := voiceCall.ResultsReplies(directoryChat)
+	if err != nil {
+		return err
+	}
+	createdAt := time.Now()
+	// Saved with the latest conversation if a text from the caller updates it first
+	err = retryConflicts(func() error {
+		conversation, _, err := GetOrCreateConversationFromMessage(voiceCall.Caller, chat.Message{
+			Sender:    voiceCall.Caller,
+			Recipient: voiceCall.Called,
+			CreatedAt: &createdAt,
+		}, h.Store)
+		if err != nil {
+			return err
+		}
+		return UpdateDirectoryChatConversation(directoryChat, conversation, h.Store)
+	})
+	if err != nil {
+		return err
+	}
+	return h.PublishReplies(voiceCall.Caller, replies)
+}
+
+// ResultsChat returns a DirectoryChat at the results step with the call's filters,
+// so results can be texted to the caller and paginated by replying
+func (v *VoiceCall) ResultsChat() *DirectoryChat {
+	directoryChat := v.directoryChat()
+	directoryChat.Page = 0
+	return directoryChat
+}
+
+// ResultsReplies returns the first page of results as text messages to the caller
+func (v *VoiceCall) ResultsReplies(directoryChat *DirectoryChat) ([]chat.Message, error) {
+	bodies, err := directoryChat.handleResults("")
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	return directoryChat.buildReplies(chat.Message{Sender: v.Caller, Recipient: v.Called}, bodies), nil
+}
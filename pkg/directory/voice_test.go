@@ -0,0 +1,176 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+)
+
+func TestVoiceCallSteps(t *testing.T) {
+	voiceCall := NewVoiceCall("https://example.com/api/voice", url.Values{})
+	twiml, _, _ := voiceCall.HandleInput("", "")
+	if !strings.Contains(twiml, "<Gather") || !strings.Contains(twiml, "step=language") {
+		t.Errorf("Call not starting with language menu")
+	}
+
+	voiceCall = NewVoiceCall("https://example.com/api/voice", url.Values{"step": []string{"language"}})
+	twiml, _, _ = voiceCall.HandleInput("2", "")
+	if voiceCall.Language != "es" || !strings.Contains(twiml, "lang=es") || !strings.Contains(twiml, "step=what") {
+		t.Errorf("Language not set from DTMF input")
+	}
+
+	voiceCall = NewVoiceCall("https://example.com/api/voice", url.Values{"step": []string{"what"}, "lang": []string{"en"}})
+	_, _, _ = voiceCall.HandleInput("", "food and housing")
+	if voiceCall.Step != voiceWho || voiceCall.What != "2 3" {
+		t.Errorf("What options not set from speech input")
+	}
+	if len(voiceCall.directoryChat().Params.What) != 2 {
+		t.Errorf("What options not parsed with chat filters")
+	}
+
+	voiceCall = NewVoiceCall("https://example.com/api/voice", url.Values{"step": []string{"who"}, "lang": []string{"en"}, "what": []string{"1"}})
+	_, _, _ = voiceCall.HandleInput("9", "")
+	if voiceCall.Step != voiceWho || voiceCall.Who != "" {
+		t.Errorf("Invalid who option accepted")
+	}
+
+	voiceCall = NewVoiceCall("https://example.com/api/voice", url.Values{"step": []string{"zip"}, "lang": []string{"en"}})
+	_, _, _ = voiceCall.HandleInput("123", "")
+	if voiceCall.Step != voiceZIP || voiceCall.ZIP != "" {
+		t.Errorf("Invalid ZIP accepted")
+	}
+}
+
+func TestVoiceCallTextResults(t *testing.T) {
+	resources := NewMemoryResourceStore([]Resource{
+		{ID: "1", Name: "Food pantry", Category: []string{"Food"}, Level: "City", Status: "Approved"},
+	})
+	query := url.Values{"step": []string{"results"}, "lang": []string{"en"}, "zip": []string{"60601"}}
+	voiceCall := NewVoiceCall("https://example.com/api/voice", query)
+	voiceCall.Resources = resources
+	twiml, textResults, _ := voiceCall.HandleInput("1", "")
+	if !textResults || !strings.Contains(twiml, "<Hangup>") {
+		t.Errorf("Results not sent by text when requested")
+	}
+
+	voiceCall = NewVoiceCall("https://example.com/api/voice", query)
+	voiceCall.Resources = resources
+	if _, textResults, _ := voiceCall.HandleInput("", "text them to me"); !textResults {
+		t.Errorf("Results not sent by text when requested by speech")
+	}
+}
+
+func TestTextVoiceResults(t *testing.T) {
+	store, _ := chat.NewMemoryStore("")
+	bus := &mocks.BusMock{}
+	messageHandler := &MessageHandler{Store: store, Bus: bus}
+	voiceCall := NewVoiceCall("https://example.com/api/voice", url.Values{
+		"step": []string{"results"}, "lang": []string{"en"}, "what": []string{"2"}, "zip": []string{"60601"},
+	})
+	voiceCall.Resources = NewMemoryResourceStore([]Resource{
+		{ID: "1", Name: "Food pantry", Category: []string{"Food"}, Level: "City", Status: "Approved"},
+	})
+	voiceCall.Caller = "+15555555555"
+	voiceCall.Called = "+15551234567"
+
+	if err := messageHandler.TextVoiceResults(voiceCall); err != nil || len(bus.Events) != 1 {
+		t.Fatalf("Results not texted to caller: %v", err)
+	}
+	if conversation, _ := store.ActiveConversation("+15555555555"); conversation == nil || conversation.State != string(results) {
+		t.Errorf("Conversation not saved at results step")
+	}
+
+	// Texts aren't sent to callers who can't receive them
+	_ = store.MarkUnreachable("+15555555555", "30006")
+	if err := messageHandler.TextVoiceResults(voiceCall); err != nil || len(bus.Events) != 1 {
+		t.Errorf("Results texted to unreachable caller: %v", err)
+	}
+
+	// Or to blocked callers, or over the outbound limit
+	limiter := chat.NewMemoryRateLimiter(chat.RateLimitPolicy{Burst: 10, Refill: time.Second, OutboundPerHour: 1})
+	messageHandler.Limiter = limiter
+	_ = limiter.Block("+15555555556", "spam")
+	voiceCall.Caller = "+15555555556"
+	if err := messageHandler.TextVoiceResults(voiceCall); err != nil || len(bus.Events) != 1 {
+		t.Errorf("Results texted to blocked caller: %v", err)
+	}
+	voiceCall.Caller = "+15555555557"
+	if err := messageHandler.TextVoiceResults(voiceCall); err != nil || len(bus.Events) != 1 {
+		t.Errorf("Results texted over outbound limit: %v", err)
+	}
+}
+
+func TestTextVoiceResultsRetriesConflicts(t *testing.T) {
+	memoryStore, _ := chat.NewMemoryStore("")
+	store := &racingStore{MemoryStore: memoryStore}
+	createdAt := time.Now()
+	message := chat.Message{ID: "SM1", Sender: "+15555555555", Recipient: "+15551234567", Body: "hi", CreatedAt: &createdAt}
+	_, _ = HandleReceivedMessage(message, store, nil)
+	other := message
+	other.ID, other.Body = "SM2", "0"
+	store.other = &other
+
+	bus := &mocks.BusMock{}
+	messageHandler := &MessageHandler{Store: store, Bus: bus}
+	voiceCall := NewVoiceCall("https://example.com/api/voice", url.Values{
+		"step": []string{"results"}, "lang": []string{"en"}, "zip": []string{"60601"},
+	})
+	voiceCall.Resources = NewMemoryResourceStore([]Resource{})
+	voiceCall.Caller = "+15555555555"
+	voiceCall.Called = "+15551234567"
+
+	// A text from the caller saves the conversation first, and the results are saved after it
+	if err := messageHandler.TextVoiceResults(voiceCall); err != nil || len(bus.Events) != 1 {
+		t.Fatalf("Results not texted after conflict: %v", err)
+	}
+	if conversation, _ := store.ActiveConversation("+15555555555"); conversation.State != string(results) {
+		t.Errorf("Results not saved after conflict")
+	}
+}
+
+func TestVoiceCallResultsRepeatsPrompt(t *testing.T) {
+	resources := NewMemoryResourceStore([]Resource{
+		{ID: "1", Name: "Food pantry", Category: []string{"Food"}, Level: "City", Status: "Approved"},
+	})
+	query := url.Values{"step": []string{"results"}, "lang": []string{"en"}, "zip": []string{"60601"}}
+	for _, input := range [][]string{{"", ""}, {"9", ""}, {"2", ""}, {"", "goodbye"}} {
+		voiceCall := NewVoiceCall("https://example.com/api/voice", query)
+		voiceCall.Resources = resources
+		twiml, textResults, err := voiceCall.HandleInput(input[0], input[1])
+		if err != nil || textResults || strings.Contains(twiml, "<Hangup>") || !strings.Contains(twiml, "step=results") {
+			t.Errorf("Results prompt not repeated for input %v: %s", input, twiml)
+		}
+	}
+
+	voiceCall := NewVoiceCall("https://example.com/api/voice", query)
+	voiceCall.Resources = resources
+	if _, _, _ = voiceCall.HandleInput("", "start over"); voiceCall.Step != voiceWhat || voiceCall.ZIP != "" {
+		t.Errorf("Call not restarted from speech")
+	}
+}
+
+func TestVoiceLanguagesTranslated(t *testing.T) {
+	var en map[string]interface{}
+	enJSON, _ := ioutil.ReadFile("i18n/en.json")
+	_ = json.Unmarshal(enJSON, &en)
+	for _, lang := range voiceLanguages() {
+		var messages map[string]interface{}
+		langJSON, _ := ioutil.ReadFile(fmt.Sprintf("i18n/%s.json", lang.Code))
+		if err := json.Unmarshal(langJSON, &messages); err != nil {
+			t.Fatalf("Messages for %s not loaded: %v", lang.Code, err)
+		}
+		// Prompts are read with the language's voice, so they can't fall back to English
+		for key := range en {
+			if _, ok := messages[key]; strings.HasPrefix(key, "voice-") && !ok {
+				t.Errorf("Voice prompt %s not translated for %s", key, lang.Code)
+			}
+		}
+	}
+}
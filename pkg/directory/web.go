@@ -0,0 +1,240 @@
+package directory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// webBotAddress is the sender address used for replies in web chats
+const webBotAddress = "web"
+
+// ErrWebSessionNotFound is returned when a token doesn't match an active web session
+var ErrWebSessionNotFound = errors.New("Web chat session not found")
+
+// WebReply is a structured reply for display in the web chat widget
+type WebReply struct {
+	ID        string        `json:"id"`
+	Text      string        `json:"text"`
+	Options   []chat.Option `json:"options,omitempty"`
+	Resources []Resource    `json:"resources,omitempty"`
+	CreatedAt *time.Time    `json:"created_at"`
+}
+
+// WebSession is returned to the widget when a session is created or messaged
+type WebSession struct {
+	Token   string     `json:"token,omitempty"`
+	Replies []WebReply `json:"replies"`
+	// Index to request replies after when polling
+	Cursor int `json:"cursor"`
+}
+
+func newWebMessageID() string {
+	idBytes := make([]byte, 16)
+	_, _ = rand.Read(idBytes)
+	return hex.EncodeToString(idBytes)
+}
+
+// Converts replies to structured replies, including results on the last reply
+func (c *DirectoryChat) webReplies(replies []chat.Message) []WebReply {
+	webReplies := []WebReply{}
+	for _, reply := range replies {
+		webReply := WebReply{ID: reply.ID, Text: reply.Body, CreatedAt: reply.CreatedAt}
+		if reply.Menu != nil {
+			webReply.Options = reply.Menu.Options
+		}
+		webReplies = append(webReplies, webReply)
+	}
+	if len(webReplies) > 0 {
+		webReplies[len(webReplies)-1].Resources = c.PageResults()
+	}
+	return webReplies
+}
+
+// Handles a web message, assigning IDs to its replies
+func (c *DirectoryChat) handleWebMessage(message chat.Message) ([]chat.Message, error) {
+	replies, err := c.HandleMessage(message)
+	if err != nil {
+		return replies, err
+	}
+	setWebReplyIDs(replies)
+	return replies, nil
+}
+
+func setWebReplyIDs(replies []chat.Message) {
+	for idx := range replies {
+		createdAt := time.Now()
+		replies[idx].ID = newWebMessageID()
+		replies[idx].CreatedAt = &createdAt
+	}
+}
+
+// Saves a web message and its replies to the conversation's transcript, returning the
+// number of messages in it to use as the cursor
+func saveWebTranscript(
+	store chat.ConversationStore,
+	conversation *chat.Conversation,
+	state chatState,
+	directoryChat *DirectoryChat,
+	message chat.Message,
+	replies []chat.Message,
+) (int, error) {
+	if err := recordMessage(store, conversation, state, chat.DirectionInbound, message, ""); err != nil {
+		return 0, err
+	}
+	for _, reply := range replies {
+		// Replies are returned directly to the widget
+		err := recordMessage(store, conversation, directoryChat.State, chat.DirectionOutbound, reply, chat.StatusDelivered)
+		if err != nil {
+			return 0, err
+		}
+	}
+	records, err := store.ConversationMessages(conversation.ID)
+	return len(records), err
+}
+
+// CreateWebSession starts a new web chat conversation and returns its token and first replies
+func CreateWebSession(db *gorm.DB) (*WebSession, error) {
+	token, err := svc.NewWebSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	contact := svc.WebAddress(token)
+	createdAt := time.Now()
+	directoryChat := NewDirectoryChat(contact)
+	state := directoryChat.State
+	message := chat.Message{
+		ID:        newWebMessageID(),
+		Sender:    contact,
+		Recipient: webBotAddress,
+		CreatedAt: &createdAt,
+	}
+	replies, err := directoryChat.handleWebMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	store := chat.NewGormStore(db)
+	conversation := chat.Conversation{Channel: svc.WebChannel, Tenant: webBotAddress}
+	if err := UpdateDirectoryChatConversation(directoryChat, &conversation, store); err != nil {
+		return nil, err
+	}
+	cursor, err := saveWebTranscript(store, &conversation, state, directoryChat, message, replies)
+	if err != nil {
+		return nil, err
+	}
+	return &WebSession{
+		Token:   token,
+		Replies: directoryChat.webReplies(replies),
+		Cursor:  cursor,
+	}, nil
+}
+
+// LoadWebSession returns the active conversation and chat for a web session token
+func LoadWebSession(token string, db *gorm.DB) (*chat.Conversation, *DirectoryChat, error) {
+	var conversation chat.Conversation
+	var directoryChat DirectoryChat
+	if token == "" {
+		return nil, nil, ErrWebSessionNotFound
+	}
+	err := db.Model(&chat.Conversation{}).Where(
+		"contact = ? AND channel = ? AND active IS TRUE", svc.WebAddress(token), svc.WebChannel,
+	).Last(&conversation).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil, ErrWebSessionNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(conversation.Data.RawMessage, &directoryChat); err != nil {
+		return nil, nil, err
+	}
+	return &conversation, &directoryChat, nil
+}
+
+// HandleWebMessage sends a message from the widget to a web session and returns the replies
+func HandleWebMessage(token, body string, db *gorm.DB, resources ResourceStore) (*WebSession, error) {
+	var session *WebSession
+	err := retryConflicts(func() error {
+		var err error
+		session, err = handleWebMessage(token, body, db, resources)
+		return err
+	})
+	return session, err
+}
+
+func handleWebMessage(token, body string, db *gorm.DB, resources ResourceStore) (*WebSession, error) {
+	conversation, directoryChat, err := LoadWebSession(token, db)
+	if err != nil {
+		return nil, err
+	}
+	directoryChat.Resources = resources
+	createdAt := time.Now()
+	state := directoryChat.State
+	message := chat.Message{
+		ID:        newWebMessageID(),
+		Sender:    directoryChat.ContactID,
+		Recipient: webBotAddress,
+		Body:      body,
+		CreatedAt: &createdAt,
+	}
+	replies, err := directoryChat.handleWebMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	store := chat.NewGormStore(db)
+	if directoryChat.privacyRequest != "" {
+		var deleted bool
+		replies, deleted, err = directoryChat.handlePrivacyRequest(message, store)
+		if err != nil {
+			return nil, err
+		}
+		setWebReplyIDs(replies)
+		if deleted {
+			return &WebSession{Replies: directoryChat.webReplies(replies)}, nil
+		}
+	}
+	if err := UpdateDirectoryChatConversation(directoryChat, conversation, store); err != nil {
+		return nil, err
+	}
+	cursor, err := saveWebTranscript(store, conversation, state, directoryChat, message, replies)
+	if err != nil {
+		return nil, err
+	}
+	return &WebSession{
+		Replies: directoryChat.webReplies(replies),
+		Cursor:  cursor,
+	}, nil
+}
+
+// PollWebSession returns replies in a web session after the cursor. Structured
+// resources are only included when replies are first returned
+func PollWebSession(token string, cursor int, db *gorm.DB) (*WebSession, error) {
+	conversation, directoryChat, err := LoadWebSession(token, db)
+	if err != nil {
+		return nil, err
+	}
+	records, err := chat.NewGormStore(db).ConversationMessages(conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	replies := []chat.Message{}
+	if cursor < 0 {
+		cursor = 0
+	}
+	for idx := cursor; idx < len(records); idx++ {
+		if records[idx].Direction == chat.DirectionOutbound {
+			replies = append(replies, records[idx].Message())
+		}
+	}
+	return &WebSession{
+		Replies: directoryChat.webReplies(replies),
+		Cursor:  len(records),
+	}, nil
+}
@@ -0,0 +1,23 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+func TestHandleWebMessage(t *testing.T) {
+	dirChat := NewDirectoryChat("web:test")
+	replies, _ := dirChat.handleWebMessage(chat.Message{Sender: "web:test", Recipient: webBotAddress})
+	if len(replies) != 1 || replies[0].ID == "" || replies[0].CreatedAt == nil {
+		t.Errorf("Web reply not assigned an ID")
+	}
+	if replies[0].Sender != webBotAddress {
+		t.Errorf("Web reply not sent from bot address")
+	}
+
+	webReplies := dirChat.webReplies(replies)
+	if len(webReplies) != 1 || len(webReplies[0].Options) != len(languageOptions()) {
+		t.Errorf("Language options not included in structured reply")
+	}
+}
@@ -75,7 +75,7 @@ const ZIPJSON = `{
     "60501",
     "60546",
     "60534",
-    "60130",
+    "60130"
   ],
   "60630": [
     "60630",
@@ -88,7 +88,7 @@ const ZIPJSON = `{
     "60631",
     "60706",
     "60656",
-    "60641",
+    "60641"
   ],
   "60043": ["60043", "60091", "60201", "60093"],
   "60636": ["60636", "60621", "60652", "60620", "60609", "60632", "60629"],
@@ -102,7 +102,7 @@ const ZIPJSON = `{
     "60639",
     "60657",
     "60614",
-    "60641",
+    "60641"
   ],
   "60053": [
     "60053",
@@ -112,7 +112,7 @@ const ZIPJSON = `{
     "60714",
     "60068",
     "60025",
-    "60029",
+    "60029"
   ],
   "60469": [
     "60469",
@@ -122,7 +122,7 @@ const ZIPJSON = `{
     "60428",
     "60803",
     "60827",
-    "60406",
+    "60406"
   ],
   "60712": [
     "60630",
@@ -134,7 +134,7 @@ const ZIPJSON = `{
     "60646",
     "60714",
     "60202",
-    "60076",
+    "60076"
   ],
   "60621": ["60636", "60621", "60619", "60615", "60637", "60620", "60609"],
   "60203": ["60203", "60091", "60077", "60202", "60076", "60201"],
@@ -147,7 +147,7 @@ const ZIPJSON = `{
     "60623",
     "60651",
     "60624",
-    "60302",
+    "60302"
   ],
   "60461": [
     "60461",
@@ -157,7 +157,7 @@ const ZIPJSON = `{
     "60422",
     "60411",
     "60443",
-    "60466",
+    "60466"
   ],
   "60173": [
     "60173",
@@ -168,7 +168,7 @@ const ZIPJSON = `{
     "60193",
     "60067",
     "60008",
-    "60194",
+    "60194"
   ],
   "60804": [
     "60402",
@@ -178,7 +178,7 @@ const ZIPJSON = `{
     "60623",
     "60624",
     "60632",
-    "60638",
+    "60638"
   ],
   "60163": [
     "60163",
@@ -189,7 +189,7 @@ const ZIPJSON = `{
     "60104",
     "60126",
     "60523",
-    "60154",
+    "60154"
   ],
   "60465": [
     "60465",
@@ -200,7 +200,7 @@ const ZIPJSON = `{
     "60464",
     "60453",
     "60455",
-    "60482",
+    "60482"
   ],
   "60457": [
     "60465",
@@ -210,7 +210,7 @@ const ZIPJSON = `{
     "60459",
     "60453",
     "60455",
-    "60458",
+    "60458"
   ],
   "60661": [
     "60661",
@@ -228,7 +228,7 @@ const ZIPJSON = `{
     "60616",
     "60622",
     "60607",
-    "60654",
+    "60654"
   ],
   "60301": [
     "60402",
@@ -241,7 +241,7 @@ const ZIPJSON = `{
     "60153",
     "60639",
     "60130",
-    "60302",
+    "60302"
   ],
   "60304": [
     "60402",
@@ -254,7 +254,7 @@ const ZIPJSON = `{
     "60153",
     "60546",
     "60130",
-    "60302",
+    "60302"
   ],
   "60463": ["60465", "60463", "60445", "60464", "60803", "60462", "60482"],
   "60141": [
@@ -269,7 +269,7 @@ const ZIPJSON = `{
     "60526",
     "60154",
     "60546",
-    "60130",
+    "60130"
   ],
   "60471": ["60471", "60449", "60423", "60417", "60443", "60466"],
   "60476": [
@@ -280,7 +280,7 @@ const ZIPJSON = `{
     "60425",
     "60426",
     "60429",
-    "60438",
+    "60438"
   ],
   "60165": [
     "60163",
@@ -291,7 +291,7 @@ const ZIPJSON = `{
     "60162",
     "60131",
     "60104",
-    "60153",
+    "60153"
   ],
   "60171": [
     "60171",
@@ -302,7 +302,7 @@ const ZIPJSON = `{
     "60305",
     "60131",
     "60176",
-    "60153",
+    "60153"
   ],
   "60619": ["60621", "60619", "60637", "60649", "60620", "60617", "60628"],
   "60623": [
@@ -313,7 +313,7 @@ const ZIPJSON = `{
     "60612",
     "60609",
     "60608",
-    "60632",
+    "60632"
   ],
   "60625": [
     "60630",
@@ -327,7 +327,7 @@ const ZIPJSON = `{
     "60640",
     "60613",
     "60626",
-    "60641",
+    "60641"
   ],
   "60634": [
     "60630",
@@ -339,7 +339,7 @@ const ZIPJSON = `{
     "60706",
     "60656",
     "60639",
-    "60641",
+    "60641"
   ],
   "60642": [
     "60661",
@@ -355,7 +355,7 @@ const ZIPJSON = `{
     "60622",
     "60614",
     "60607",
-    "60654",
+    "60654"
   ],
   "60645": [
     "60712",
@@ -366,7 +366,7 @@ const ZIPJSON = `{
     "60646",
     "60202",
     "60626",
-    "60076",
+    "60076"
   ],
   "60651": [
     "60644",
@@ -377,7 +377,7 @@ const ZIPJSON = `{
     "60647",
     "60639",
     "60622",
-    "60302",
+    "60302"
   ],
   "60652": [
     "60636",
@@ -389,7 +389,7 @@ const ZIPJSON = `{
     "60459",
     "60453",
     "60629",
-    "60638",
+    "60638"
   ],
   "60653": ["60621", "60653", "60615", "60637", "60609", "60616"],
   "60659": [
@@ -402,7 +402,7 @@ const ZIPJSON = `{
     "60646",
     "60640",
     "60626",
-    "60076",
+    "60076"
   ],
   "60660": ["60625", "60645", "60659", "60660", "60640", "60613", "60626"],
   "60805": ["60456", "60652", "60805", "60655", "60620", "60643", "60453"],
@@ -421,7 +421,7 @@ const ZIPJSON = `{
     "60608",
     "60616",
     "60607",
-    "60654",
+    "60654"
   ],
   "60605": [
     "60661",
@@ -435,7 +435,7 @@ const ZIPJSON = `{
     "60608",
     "60616",
     "60607",
-    "60654",
+    "60654"
   ],
   "60624": [
     "60644",
@@ -446,7 +446,7 @@ const ZIPJSON = `{
     "60612",
     "60608",
     "60647",
-    "60622",
+    "60622"
   ],
   "60155": [
     "60141",
@@ -458,7 +458,7 @@ const ZIPJSON = `{
     "60526",
     "60154",
     "60546",
-    "60130",
+    "60130"
   ],
   "60603": [
     "60661",
@@ -474,7 +474,7 @@ const ZIPJSON = `{
     "60608",
     "60616",
     "60607",
-    "60654",
+    "60654"
   ],
   "60637": [
     "60621",
@@ -484,7 +484,7 @@ const ZIPJSON = `{
     "60637",
     "60649",
     "60620",
-    "60609",
+    "60609"
   ],
   "60521": ["60521", "60525", "60523", "60558", "60154", "60527"],
   "60649": ["60619", "60637", "60649", "60617"],
@@ -499,7 +499,7 @@ const ZIPJSON = `{
     "60056",
     "60656",
     "60106",
-    "60016",
+    "60016"
   ],
   "60445": [
     "60469",
@@ -511,7 +511,7 @@ const ZIPJSON = `{
     "60428",
     "60803",
     "60462",
-    "60406",
+    "60406"
   ],
   "60160": [
     "60163",
@@ -524,7 +524,7 @@ const ZIPJSON = `{
     "60162",
     "60131",
     "60104",
-    "60153",
+    "60153"
   ],
   "60192": [
     "60173",
@@ -535,7 +535,7 @@ const ZIPJSON = `{
     "60010",
     "60067",
     "60107",
-    "60120",
+    "60120"
   ],
   "60015": ["60015", "60062", "60090", "60089", "60035"],
   "60133": ["60133", "60103", "60193", "60107", "60172", "60194"],
@@ -549,7 +549,7 @@ const ZIPJSON = `{
     "60501",
     "60546",
     "60534",
-    "60130",
+    "60130"
   ],
   "60606": [
     "60661",
@@ -567,7 +567,7 @@ const ZIPJSON = `{
     "60616",
     "60622",
     "60607",
-    "60654",
+    "60654"
   ],
   "60022": ["60022", "60062", "60035", "60093"],
   "60601": [
@@ -584,7 +584,7 @@ const ZIPJSON = `{
     "60616",
     "60614",
     "60607",
-    "60654",
+    "60654"
   ],
   "60091": [
     "60043",
@@ -596,7 +596,7 @@ const ZIPJSON = `{
     "60076",
     "60201",
     "60093",
-    "60029",
+    "60029"
   ],
   "60415": [
     "60465",
@@ -606,7 +606,7 @@ const ZIPJSON = `{
     "60453",
     "60803",
     "60455",
-    "60482",
+    "60482"
   ],
   "60164": [
     "60163",
@@ -617,7 +617,7 @@ const ZIPJSON = `{
     "60131",
     "60104",
     "60126",
-    "60106",
+    "60106"
   ],
   "60026": ["60026", "60062", "60025", "60093"],
   "60655": [
@@ -628,7 +628,7 @@ const ZIPJSON = `{
     "60453",
     "60803",
     "60827",
-    "60406",
+    "60406"
   ],
   "60077": [
     "60053",
@@ -641,7 +641,7 @@ const ZIPJSON = `{
     "60025",
     "60076",
     "60201",
-    "60029",
+    "60029"
   ],
   "60620": [
     "60636",
@@ -653,7 +653,7 @@ const ZIPJSON = `{
     "60620",
     "60643",
     "60629",
-    "60628",
+    "60628"
   ],
   "60646": [
     "60630",
@@ -667,7 +667,7 @@ const ZIPJSON = `{
     "60631",
     "60714",
     "60656",
-    "60076",
+    "60076"
   ],
   "60707": [
     "60171",
@@ -677,7 +677,7 @@ const ZIPJSON = `{
     "60707",
     "60305",
     "60639",
-    "60302",
+    "60302"
   ],
   "60062": [
     "60015",
@@ -691,7 +691,7 @@ const ZIPJSON = `{
     "60056",
     "60035",
     "60093",
-    "60016",
+    "60016"
   ],
   "60452": ["60445", "60452", "60478", "60429", "60477", "60428", "60462"],
   "60305": [
@@ -703,7 +703,7 @@ const ZIPJSON = `{
     "60305",
     "60153",
     "60130",
-    "60302",
+    "60302"
   ],
   "60430": [
     "60461",
@@ -717,7 +717,7 @@ const ZIPJSON = `{
     "60426",
     "60429",
     "60443",
-    "60428",
+    "60428"
   ],
   "60090": ["60015", "60062", "60090", "60089", "60070", "60056", "60004"],
   "60162": [
@@ -729,7 +729,7 @@ const ZIPJSON = `{
     "60126",
     "60523",
     "60526",
-    "60154",
+    "60154"
   ],
   "60640": [
     "60618",
@@ -739,7 +739,7 @@ const ZIPJSON = `{
     "60640",
     "60613",
     "60626",
-    "60657",
+    "60657"
   ],
   "60613": ["60618", "60625", "60660", "60640", "60613", "60657", "60614"],
   "60143": ["60143", "60007", "60172"],
@@ -757,7 +757,7 @@ const ZIPJSON = `{
     "60622",
     "60614",
     "60607",
-    "60654",
+    "60654"
   ],
   "60643": [
     "60652",
@@ -768,7 +768,7 @@ const ZIPJSON = `{
     "60628",
     "60803",
     "60827",
-    "60406",
+    "60406"
   ],
   "60007": [
     "60173",
@@ -781,7 +781,7 @@ const ZIPJSON = `{
     "60106",
     "60008",
     "60172",
-    "60194",
+    "60194"
   ],
   "60478": [
     "60461",
@@ -792,7 +792,7 @@ const ZIPJSON = `{
     "60429",
     "60443",
     "60477",
-    "60428",
+    "60428"
   ],
   "60089": ["60015", "60062", "60090", "60089", "60070", "60074", "60004"],
   "60070": ["60062", "60090", "60089", "60070", "60056", "60004", "60016"],
@@ -807,7 +807,7 @@ const ZIPJSON = `{
     "60131",
     "60126",
     "60176",
-    "60106",
+    "60106"
   ],
   "60104": [
     "60163",
@@ -818,7 +818,7 @@ const ZIPJSON = `{
     "60162",
     "60104",
     "60153",
-    "60154",
+    "60154"
   ],
   "60103": ["60133", "60103", "60107", "60120"],
   "60126": [
@@ -829,7 +829,7 @@ const ZIPJSON = `{
     "60126",
     "60523",
     "60154",
-    "60106",
+    "60106"
   ],
   "60631": [
     "60630",
@@ -840,7 +840,7 @@ const ZIPJSON = `{
     "60176",
     "60068",
     "60706",
-    "60656",
+    "60656"
   ],
   "60422": [
     "60461",
@@ -850,7 +850,7 @@ const ZIPJSON = `{
     "60411",
     "60429",
     "60443",
-    "60466",
+    "60466"
   ],
   "60449": ["60471", "60449", "60423", "60417", "60443", "60466"],
   "60473": [
@@ -862,7 +862,7 @@ const ZIPJSON = `{
     "60429",
     "60438",
     "60827",
-    "60419",
+    "60419"
   ],
   "60411": [
     "60461",
@@ -874,7 +874,7 @@ const ZIPJSON = `{
     "60417",
     "60475",
     "60438",
-    "60466",
+    "60466"
   ],
   "60169": [
     "60173",
@@ -886,7 +886,7 @@ const ZIPJSON = `{
     "60067",
     "60107",
     "60194",
-    "60120",
+    "60120"
   ],
   "60612": [
     "60623",
@@ -897,7 +897,7 @@ const ZIPJSON = `{
     "60608",
     "60647",
     "60622",
-    "60607",
+    "60607"
   ],
   "60423": ["60471", "60449", "60423", "60443", "60477", "60448", "60487"],
   "60480": [
@@ -908,7 +908,7 @@ const ZIPJSON = `{
     "60439",
     "60501",
     "60527",
-    "60458",
+    "60458"
   ],
   "60714": [
     "60053",
@@ -919,7 +919,7 @@ const ZIPJSON = `{
     "60714",
     "60068",
     "60025",
-    "60016",
+    "60016"
   ],
   "60176": [
     "60171",
@@ -929,7 +929,7 @@ const ZIPJSON = `{
     "60631",
     "60176",
     "60706",
-    "60656",
+    "60656"
   ],
   "60409": ["60473", "60409", "60438", "60633", "60827", "60419"],
   "60202": ["60712", "60203", "60645", "60202", "60626", "60076", "60201"],
@@ -941,7 +941,7 @@ const ZIPJSON = `{
     "60010",
     "60067",
     "60008",
-    "60194",
+    "60194"
   ],
   "60425": ["60476", "60430", "60411", "60425", "60438"],
   "60426": [
@@ -956,7 +956,7 @@ const ZIPJSON = `{
     "60428",
     "60827",
     "60406",
-    "60419",
+    "60419"
   ],
   "60464": ["60465", "60463", "60464", "60439", "60462", "60467", "60482"],
   "60459": [
@@ -967,7 +967,7 @@ const ZIPJSON = `{
     "60453",
     "60629",
     "60638",
-    "60455",
+    "60455"
   ],
   "60417": ["60471", "60449", "60411", "60417", "60475", "60466"],
   "60429": [
@@ -979,7 +979,7 @@ const ZIPJSON = `{
     "60473",
     "60426",
     "60429",
-    "60428",
+    "60428"
   ],
   "60441": ["60441", "60491", "60439"],
   "60010": [
@@ -991,7 +991,7 @@ const ZIPJSON = `{
     "60110",
     "60067",
     "60074",
-    "60120",
+    "60120"
   ],
   "60443": [
     "60461",
@@ -1003,7 +1003,7 @@ const ZIPJSON = `{
     "60423",
     "60443",
     "60477",
-    "60466",
+    "60466"
   ],
   "60491": ["60441", "60491", "60439", "60448", "60467"],
   "60068": [
@@ -1014,7 +1014,7 @@ const ZIPJSON = `{
     "60706",
     "60025",
     "60656",
-    "60016",
+    "60016"
   ],
   "60517": ["60517", "60439"],
   "60604": [
@@ -1031,7 +1031,7 @@ const ZIPJSON = `{
     "60608",
     "60616",
     "60607",
-    "60654",
+    "60654"
   ],
   "60453": [
     "60456",
@@ -1045,7 +1045,7 @@ const ZIPJSON = `{
     "60453",
     "60803",
     "60455",
-    "60482",
+    "60482"
   ],
   "60477": [
     "60452",
@@ -1056,7 +1056,7 @@ const ZIPJSON = `{
     "60428",
     "60448",
     "60487",
-    "60462",
+    "60462"
   ],
   "60472": ["60469", "60445", "60426", "60472", "60428", "60803", "60406"],
   "60475": ["60411", "60417", "60475", "60466"],
@@ -1071,7 +1071,7 @@ const ZIPJSON = `{
     "60153",
     "60154",
     "60546",
-    "60130",
+    "60130"
   ],
   "60611": [
     "60661",
@@ -1086,7 +1086,7 @@ const ZIPJSON = `{
     "60611",
     "60614",
     "60607",
-    "60654",
+    "60654"
   ],
   "60609": [
     "60636",
@@ -1099,7 +1099,7 @@ const ZIPJSON = `{
     "60608",
     "60632",
     "60629",
-    "60616",
+    "60616"
   ],
   "60608": [
     "60661",
@@ -1111,7 +1111,7 @@ const ZIPJSON = `{
     "60608",
     "60632",
     "60616",
-    "60607",
+    "60607"
   ],
   "60632": [
     "60636",
@@ -1121,7 +1121,7 @@ const ZIPJSON = `{
     "60608",
     "60632",
     "60629",
-    "60638",
+    "60638"
   ],
   "60629": [
     "60636",
@@ -1131,7 +1131,7 @@ const ZIPJSON = `{
     "60609",
     "60632",
     "60629",
-    "60638",
+    "60638"
   ],
   "60626": ["60625", "60645", "60659", "60660", "60640", "60202", "60626"],
   "60633": ["60409", "60633", "60617", "60628", "60827", "60419"],
@@ -1143,7 +1143,7 @@ const ZIPJSON = `{
     "60176",
     "60068",
     "60706",
-    "60656",
+    "60656"
   ],
   "60647": [
     "60618",
@@ -1156,7 +1156,7 @@ const ZIPJSON = `{
     "60657",
     "60622",
     "60614",
-    "60641",
+    "60641"
   ],
   "60525": [
     "60402",
@@ -1173,7 +1173,7 @@ const ZIPJSON = `{
     "60455",
     "60527",
     "60534",
-    "60458",
+    "60458"
   ],
   "60523": ["60163", "60521", "60162", "60126", "60523", "60558", "60154"],
   "60526": [
@@ -1185,7 +1185,7 @@ const ZIPJSON = `{
     "60526",
     "60558",
     "60154",
-    "60546",
+    "60546"
   ],
   "60638": [
     "60402",
@@ -1198,7 +1198,7 @@ const ZIPJSON = `{
     "60638",
     "60501",
     "60455",
-    "60534",
+    "60534"
   ],
   "60558": ["60521", "60525", "60523", "60526", "60558", "60154", "60527"],
   "60616": [
@@ -1210,7 +1210,7 @@ const ZIPJSON = `{
     "60609",
     "60608",
     "60616",
-    "60607",
+    "60607"
   ],
   "60617": ["60619", "60649", "60633", "60617", "60628"],
   "60628": [
@@ -1221,7 +1221,7 @@ const ZIPJSON = `{
     "60617",
     "60628",
     "60827",
-    "60406",
+    "60406"
   ],
   "60025": [
     "60053",
@@ -1236,7 +1236,7 @@ const ZIPJSON = `{
     "60076",
     "60093",
     "60016",
-    "60029",
+    "60029"
   ],
   "60005": [
     "60018",
@@ -1247,7 +1247,7 @@ const ZIPJSON = `{
     "60074",
     "60008",
     "60004",
-    "60016",
+    "60016"
   ],
   "60193": [
     "60173",
@@ -1257,7 +1257,7 @@ const ZIPJSON = `{
     "60193",
     "60107",
     "60172",
-    "60194",
+    "60194"
   ],
   "60056": [
     "60018",
@@ -1269,7 +1269,7 @@ const ZIPJSON = `{
     "60005",
     "60056",
     "60004",
-    "60016",
+    "60016"
   ],
   "60656": [
     "60630",
@@ -1280,7 +1280,7 @@ const ZIPJSON = `{
     "60176",
     "60068",
     "60706",
-    "60656",
+    "60656"
   ],
   "60067": [
     "60173",
@@ -1291,7 +1291,7 @@ const ZIPJSON = `{
     "60005",
     "60067",
     "60074",
-    "60008",
+    "60008"
   ],
   "60076": [
     "60053",
@@ -1303,7 +1303,7 @@ const ZIPJSON = `{
     "60202",
     "60025",
     "60076",
-    "60201",
+    "60201"
   ],
   "60201": ["60203", "60091", "60077", "60202", "60076", "60201"],
   "60439": [
@@ -1314,7 +1314,7 @@ const ZIPJSON = `{
     "60517",
     "60439",
     "60467",
-    "60527",
+    "60527"
   ],
   "60074": ["60089", "60010", "60005", "60067", "60074", "60008", "60004"],
   "60035": ["60015", "60022", "60062", "60035", "60093"],
@@ -1331,7 +1331,7 @@ const ZIPJSON = `{
     "60526",
     "60558",
     "60154",
-    "60546",
+    "60546"
   ],
   "60093": [
     "60043",
@@ -1341,7 +1341,7 @@ const ZIPJSON = `{
     "60062",
     "60025",
     "60035",
-    "60093",
+    "60093"
   ],
   "60639": [
     "60618",
@@ -1352,7 +1352,7 @@ const ZIPJSON = `{
     "60647",
     "60639",
     "60641",
-    "60302",
+    "60302"
   ],
   "60106": ["60018", "60164", "60007", "60131", "60126", "60106"],
   "60428": [
@@ -1366,7 +1366,7 @@ const ZIPJSON = `{
     "60477",
     "60472",
     "60428",
-    "60406",
+    "60406"
   ],
   "60107": [
     "60192",
@@ -1376,7 +1376,7 @@ const ZIPJSON = `{
     "60193",
     "60107",
     "60194",
-    "60120",
+    "60120"
   ],
   "60657": [
     "60618",
@@ -1387,7 +1387,7 @@ const ZIPJSON = `{
     "60647",
     "60657",
     "60622",
-    "60614",
+    "60614"
   ],
   "60008": ["60173", "60007", "60005", "60067", "60074", "60008", "60004"],
   "60448": ["60423", "60491", "60477", "60448", "60487", "60467"],
@@ -1400,7 +1400,7 @@ const ZIPJSON = `{
     "60647",
     "60622",
     "60614",
-    "60607",
+    "60607"
   ],
   "60004": [
     "60090",
@@ -1410,7 +1410,7 @@ const ZIPJSON = `{
     "60056",
     "60074",
     "60008",
-    "60004",
+    "60004"
   ],
   "60501": [
     "60402",
@@ -1421,7 +1421,7 @@ const ZIPJSON = `{
     "60501",
     "60455",
     "60534",
-    "60458",
+    "60458"
   ],
   "60546": [
     "60402",
@@ -1435,7 +1435,7 @@ const ZIPJSON = `{
     "60154",
     "60546",
     "60534",
-    "60130",
+    "60130"
   ],
   "60614": [
     "60618",
@@ -1447,7 +1447,7 @@ const ZIPJSON = `{
     "60657",
     "60622",
     "60614",
-    "60654",
+    "60654"
   ],
   "60172": ["60133", "60143", "60007", "60193", "60172"],
   "60016": [
@@ -1459,7 +1459,7 @@ const ZIPJSON = `{
     "60025",
     "60005",
     "60056",
-    "60016",
+    "60016"
   ],
   "60194": [
     "60173",
@@ -1470,7 +1470,7 @@ const ZIPJSON = `{
     "60193",
     "60107",
     "60194",
-    "60120",
+    "60120"
   ],
   "60803": [
     "60463",
@@ -1482,7 +1482,7 @@ const ZIPJSON = `{
     "60472",
     "60803",
     "60406",
-    "60482",
+    "60482"
   ],
   "60487": ["60423", "60477", "60448", "60487", "60462", "60467"],
   "60455": [
@@ -1496,7 +1496,7 @@ const ZIPJSON = `{
     "60501",
     "60455",
     "60458",
-    "60482",
+    "60482"
   ],
   "60462": [
     "60463",
@@ -1506,7 +1506,7 @@ const ZIPJSON = `{
     "60477",
     "60487",
     "60462",
-    "60467",
+    "60467"
   ],
   "60466": [
     "60461",
@@ -1517,7 +1517,7 @@ const ZIPJSON = `{
     "60417",
     "60443",
     "60475",
-    "60466",
+    "60466"
   ],
   "60467": ["60464", "60491", "60439", "60448", "60487", "60462", "60467"],
   "60827": [
@@ -1530,7 +1530,7 @@ const ZIPJSON = `{
     "60628",
     "60827",
     "60406",
-    "60419",
+    "60419"
   ],
   "60406": [
     "60469",
@@ -1543,7 +1543,7 @@ const ZIPJSON = `{
     "60428",
     "60803",
     "60827",
-    "60406",
+    "60406"
   ],
   "60641": ["60630", "60618", "60625", "60634", "60647", "60639", "60641"],
   "60120": [
@@ -1554,7 +1554,7 @@ const ZIPJSON = `{
     "60010",
     "60107",
     "60194",
-    "60120",
+    "60120"
   ],
   "60527": ["60521", "60480", "60525", "60558", "60439", "60527"],
   "60534": ["60402", "60513", "60525", "60638", "60501", "60546", "60534"],
@@ -1574,7 +1574,7 @@ const ZIPJSON = `{
     "60616",
     "60622",
     "60607",
-    "60654",
+    "60654"
   ],
   "60419": ["60473", "60409", "60426", "60633", "60827", "60419"],
   "60458": [
@@ -1585,7 +1585,7 @@ const ZIPJSON = `{
     "60638",
     "60501",
     "60455",
-    "60458",
+    "60458"
   ],
   "60029": ["60053", "60091", "60077", "60714", "60025", "60076", "60029"],
   "60654": [
@@ -1605,7 +1605,7 @@ const ZIPJSON = `{
     "60622",
     "60614",
     "60607",
-    "60654",
+    "60654"
   ],
   "60482": [
     "60465",
@@ -1616,7 +1616,7 @@ const ZIPJSON = `{
     "60453",
     "60803",
     "60455",
-    "60482",
+    "60482"
   ],
   "60130": [
     "60402",
@@ -1629,7 +1629,7 @@ const ZIPJSON = `{
     "60153",
     "60546",
     "60130",
-    "60302",
+    "60302"
   ],
   "60302": [
     "60644",
@@ -1640,19 +1640,32 @@ const ZIPJSON = `{
     "60305",
     "60639",
     "60130",
-    "60302",
-  ],
+    "60302"
+  ]
 }
 `
 
+// ZIP data is parsed once when the package is loaded and reused across invocations
+var chiZIPCodes []string
+var zipCodeMap map[string][]string
+
+func init() {
+	mustParseZIPs(CHIZIPJSON, &chiZIPCodes)
+	mustParseZIPs(ZIPJSON, &zipCodeMap)
+}
+
+func mustParseZIPs(zipJSON string, value interface{}) {
+	if err := json.Unmarshal([]byte(zipJSON), value); err != nil {
+		panic(err)
+	}
+}
+
+// ChiZIPCodes returns the ZIP codes in Chicago. The slice is shared and shouldn't be modified
 func ChiZIPCodes() []string {
-	var chiZips []string
-	_ = json.Unmarshal([]byte(CHIZIPJSON), &chiZips)
-	return chiZips
+	return chiZIPCodes
 }
 
+// ZIPCodeMap returns each ZIP code's neighboring ZIP codes. The map is shared and shouldn't be modified
 func ZIPCodeMap() map[string][]string {
-	var zipMap map[string][]string
-	_ = json.Unmarshal([]byte(ZIPJSON), &zipMap)
-	return zipMap
+	return zipCodeMap
 }
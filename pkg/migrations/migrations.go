@@ -0,0 +1,157 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration is a versioned schema change. Changes are either SQL statements or Go
+// functions for changes that need more than SQL
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   []string
+	DownSQL []string
+	Up      func(*gorm.DB) error
+	Down    func(*gorm.DB) error
+}
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	Version   int64 `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationStatus is whether a migration has been applied, and when
+type MigrationStatus struct {
+	Migration Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations, tracking them in schema_migrations
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// NewMigrator is a constructor for Migrator structs with all migrations
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{DB: db, Migrations: All()}
+}
+
+// Returns migrations sorted by version
+func (m *Migrator) sorted() []Migration {
+	sortedMigrations := make([]Migration, len(m.Migrations))
+	copy(sortedMigrations, m.Migrations)
+	sort.Slice(sortedMigrations, func(i, j int) bool {
+		return sortedMigrations[i].Version < sortedMigrations[j].Version
+	})
+	return sortedMigrations
+}
+
+// Returns applied migrations by version, creating schema_migrations if it doesn't exist
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := m.DB.AutoMigrate(&SchemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+	var schemaMigrations []SchemaMigration
+	if err := m.DB.Find(&schemaMigrations).Error; err != nil {
+		return nil, err
+	}
+	applied := map[int64]SchemaMigration{}
+	for _, schemaMigration := range schemaMigrations {
+		applied[schemaMigration.Version] = schemaMigration
+	}
+	return applied, nil
+}
+
+// Status returns every migration and when it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := []MigrationStatus{}
+	for _, migration := range m.sorted() {
+		status := MigrationStatus{Migration: migration}
+		if schemaMigration, ok := applied[migration.Version]; ok {
+			appliedAt := schemaMigration.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations in order, returning the ones applied
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	migrated := []Migration{}
+	for _, migration := range m.sorted() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := run(tx, migration.UpSQL, migration.Up); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("Migration %d %s failed: %v", migration.Version, migration.Name, err)
+		}
+		migrated = append(migrated, migration)
+	}
+	return migrated, nil
+}
+
+// Down rolls back the latest applied migrations, returning the ones rolled back
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	sortedMigrations := m.sorted()
+	rolledBack := []Migration{}
+	for idx := len(sortedMigrations) - 1; idx >= 0 && len(rolledBack) < steps; idx-- {
+		migration := sortedMigrations[idx]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := run(tx, migration.DownSQL, migration.Down); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("Rolling back migration %d %s failed: %v", migration.Version, migration.Name, err)
+		}
+		rolledBack = append(rolledBack, migration)
+	}
+	return rolledBack, nil
+}
+
+// Runs SQL statements followed by a function if either are set
+func run(tx *gorm.DB, statements []string, fn func(*gorm.DB) error) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	if fn != nil {
+		return fn(tx)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/migrations"
+)
+
+func TestMigrationsVersioned(t *testing.T) {
+	var lastVersion int64
+	for _, migration := range migrations.All() {
+		if migration.Version <= lastVersion {
+			t.Errorf("Migration %s version %d not after %d", migration.Name, migration.Version, lastVersion)
+		}
+		lastVersion = migration.Version
+		if len(migration.UpSQL) == 0 && migration.Up == nil {
+			t.Errorf("Migration %s has no changes", migration.Name)
+		}
+		if len(migration.DownSQL) == 0 && migration.Down == nil {
+			t.Errorf("Migration %s can't be rolled back", migration.Name)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package migrations
+
+// All returns every migration. Add new migrations to the end with the next version
+func All() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create_conversations",
+			// Matches the table previously created by AutoMigrate, so existing databases are unchanged
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS conversations (
+					id serial PRIMARY KEY,
+					created_at timestamp with time zone,
+					updated_at timestamp with time zone,
+					deleted_at timestamp with time zone,
+					active boolean DEFAULT true,
+					channel varchar(255) DEFAULT 'sms',
+					data jsonb
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations (deleted_at)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS conversations`},
+		},
+		{
+			Version: 2,
+			Name:    "create_inbound_messages",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS inbound_messages (
+					message_id varchar(255) PRIMARY KEY,
+					sender varchar(255),
+					created_at timestamp with time zone,
+					processed_at timestamp with time zone
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_inbound_messages_created_at ON inbound_messages (created_at)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS inbound_messages`},
+		},
+		{
+			Version: 3,
+			Name:    "create_messages",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS messages (
+					id serial PRIMARY KEY,
+					conversation_id integer REFERENCES conversations (id) ON DELETE CASCADE,
+					direction varchar(255),
+					provider_id varchar(255),
+					sender varchar(255),
+					recipient varchar(255),
+					body text,
+					media jsonb,
+					state varchar(255),
+					segments integer,
+					status varchar(255),
+					error_code varchar(255),
+					created_at timestamp with time zone,
+					updated_at timestamp with time zone
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_messages_provider_id ON messages (provider_id)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS messages`},
+		},
+		{
+			Version: 4,
+			Name:    "add_conversation_columns",
+			UpSQL: []string{
+				`ALTER TABLE conversations
+					ADD COLUMN IF NOT EXISTS contact varchar(255),
+					ADD COLUMN IF NOT EXISTS tenant varchar(255),
+					ADD COLUMN IF NOT EXISTS state varchar(255),
+					ADD COLUMN IF NOT EXISTS language varchar(255)`,
+				`UPDATE conversations SET
+					contact = data ->> 'id',
+					state = COALESCE(data ->> 'state', ''),
+					language = COALESCE(data ->> 'language', '')
+				WHERE contact IS NULL OR contact = ''`,
+				// Contacts can only have one active conversation, so older duplicates are
+				// marked inactive before the unique index is added
+				`UPDATE conversations SET active = FALSE
+				WHERE active IS TRUE AND deleted_at IS NULL AND id NOT IN (
+					SELECT MAX(id) FROM conversations
+					WHERE active IS TRUE AND deleted_at IS NULL
+					GROUP BY contact
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_conversations_contact ON conversations (contact)`,
+				`CREATE INDEX IF NOT EXISTS idx_conversations_tenant ON conversations (tenant)`,
+				`CREATE INDEX IF NOT EXISTS idx_conversations_state ON conversations (state)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_active_contact
+				ON conversations (contact) WHERE active IS TRUE AND deleted_at IS NULL`,
+			},
+			DownSQL: []string{
+				`DROP INDEX IF EXISTS idx_conversations_active_contact`,
+				`ALTER TABLE conversations
+					DROP COLUMN IF EXISTS contact,
+					DROP COLUMN IF EXISTS tenant,
+					DROP COLUMN IF EXISTS state,
+					DROP COLUMN IF EXISTS language`,
+			},
+		},
+		{
+			Version: 5,
+			Name:    "add_conversation_pseudonymized_at",
+			UpSQL: []string{
+				`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS pseudonymized_at timestamp with time zone`,
+				`CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations (updated_at)`,
+			},
+			DownSQL: []string{
+				`DROP INDEX IF EXISTS idx_conversations_updated_at`,
+				`ALTER TABLE conversations DROP COLUMN IF EXISTS pseudonymized_at`,
+			},
+		},
+		{
+			Version: 6,
+			Name:    "create_deletion_audits",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS deletion_audits (
+					id serial PRIMARY KEY,
+					channel varchar(255),
+					conversations integer,
+					messages integer,
+					created_at timestamp with time zone
+				)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS deletion_audits`},
+		},
+		{
+			Version: 7,
+			Name:    "create_unreachable_contacts",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS unreachable_contacts (
+					contact varchar(255) PRIMARY KEY,
+					error_code varchar(255),
+					created_at timestamp with time zone
+				)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS unreachable_contacts`},
+		},
+		{
+			Version: 8,
+			Name:    "create_rate_limits",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS rate_buckets (
+					contact varchar(255) PRIMARY KEY,
+					tokens double precision,
+					warned boolean DEFAULT false,
+					updated_at timestamp with time zone
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_rate_buckets_updated_at ON rate_buckets (updated_at)`,
+				`CREATE TABLE IF NOT EXISTS blocked_contacts (
+					contact varchar(255) PRIMARY KEY,
+					reason text,
+					created_at timestamp with time zone
+				)`,
+				`CREATE TABLE IF NOT EXISTS outbound_usage (
+					hour timestamp with time zone PRIMARY KEY,
+					segments integer DEFAULT 0
+				)`,
+			},
+			DownSQL: []string{
+				`DROP TABLE IF EXISTS outbound_usage`,
+				`DROP TABLE IF EXISTS blocked_contacts`,
+				`DROP TABLE IF EXISTS rate_buckets`,
+			},
+		},
+		{
+			Version: 9,
+			Name:    "add_conversation_version",
+			UpSQL: []string{
+				`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1`,
+			},
+			DownSQL: []string{`ALTER TABLE conversations DROP COLUMN IF EXISTS version`},
+		},
+		{
+			Version: 10,
+			Name:    "create_directory_resources",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS directory_resources (
+					position integer PRIMARY KEY,
+					id varchar(255),
+					data jsonb,
+					updated_at timestamp with time zone
+				)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS directory_resources`},
+		},
+		{
+			Version: 11,
+			Name:    "create_import_reports",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS import_reports (
+					id serial PRIMARY KEY,
+					created_at timestamp with time zone,
+					resources integer,
+					errors integer,
+					warnings integer,
+					report jsonb
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_import_reports_created_at ON import_reports (created_at)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS import_reports`},
+		},
+		{
+			Version: 12,
+			Name:    "create_resource_snapshots",
+			UpSQL: []string{
+				`CREATE TABLE IF NOT EXISTS resource_snapshots (
+					id varchar(255) PRIMARY KEY,
+					created_at timestamp with time zone,
+					resources jsonb
+				)`,
+			},
+			DownSQL: []string{`DROP TABLE IF EXISTS resource_snapshots`},
+		},
+		{
+			Version: 13,
+			Name:    "backfill_messages",
+			// Transcripts were kept in conversation data before the messages table, so they're
+			// copied into it and removed from the data. Messages from the contact are inbound, and
+			// conversations that already have rows in messages aren't copied twice
+			UpSQL: []string{
+				`INSERT INTO messages (
+					conversation_id, direction, provider_id, sender, recipient, body, media,
+					state, segments, status, error_code, created_at, updated_at
+				)
+				SELECT
+					conversations.id,
+					CASE WHEN message.value ->> 'sender' = conversations.data ->> 'id'
+						THEN 'inbound' ELSE 'outbound' END,
+					COALESCE(message.value ->> 'id', ''),
+					COALESCE(message.value ->> 'sender', ''),
+					COALESCE(message.value ->> 'recipient', ''),
+					COALESCE(message.value ->> 'body', ''),
+					'[]'::jsonb,
+					'',
+					0,
+					CASE WHEN message.value ->> 'sender' = conversations.data ->> 'id'
+						THEN '' ELSE 'sent' END,
+					'',
+					COALESCE((message.value ->> 'created_at')::timestamp with time zone, conversations.created_at),
+					COALESCE((message.value ->> 'created_at')::timestamp with time zone, conversations.created_at)
+				FROM conversations
+				CROSS JOIN LATERAL jsonb_array_elements(conversations.data -> 'messages')
+					WITH ORDINALITY AS message (value, position)
+				WHERE jsonb_typeof(conversations.data -> 'messages') = 'array'
+					AND NOT EXISTS (SELECT 1 FROM messages WHERE messages.conversation_id = conversations.id)
+				ORDER BY conversations.id, message.position`,
+				`UPDATE conversations SET data = data - 'messages'
+				WHERE jsonb_typeof(data -> 'messages') IS NOT NULL`,
+			},
+			DownSQL: []string{
+				`UPDATE conversations SET data = jsonb_set(data, '{messages}', (
+					SELECT COALESCE(jsonb_agg(jsonb_build_object(
+						'id', provider_id,
+						'sender', sender,
+						'recipient', recipient,
+						'body', body,
+						'created_at', created_at
+					) ORDER BY messages.id), '[]'::jsonb)
+					FROM messages WHERE messages.conversation_id = conversations.id
+				))
+				WHERE data IS NOT NULL`,
+				// The transcripts are back in conversation data, so running up again copies them once
+				`DELETE FROM messages`,
+			},
+		},
+		{
+			Version: 14,
+			Name:    "add_resource_snapshots_held",
+			// A rolled back snapshot is held so imports don't publish over it until it's released
+			UpSQL: []string{
+				`ALTER TABLE resource_snapshots ADD COLUMN IF NOT EXISTS held boolean NOT NULL DEFAULT false`,
+			},
+			DownSQL: []string{`ALTER TABLE resource_snapshots DROP COLUMN IF EXISTS held`},
+		},
+		{
+			Version: 15,
+			Name:    "add_inbound_messages_replies",
+			// Replies are kept until they're published, so a retried event can publish them
+			UpSQL: []string{
+				`ALTER TABLE inbound_messages ADD COLUMN IF NOT EXISTS replies jsonb`,
+			},
+			DownSQL: []string{`ALTER TABLE inbound_messages DROP COLUMN IF EXISTS replies`},
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// BandwidthAPI is a local fake of the Bandwidth Messaging API
+type BandwidthAPI struct {
+	Server    *httptest.Server
+	AccountID string
+	Username  string
+	Password  string
+	Requests  []map[string]interface{}
+	mutex     sync.Mutex
+}
+
+// NewBandwidthAPI starts a fake Messaging API server for an account that accepts
+// basic auth with username and password
+func NewBandwidthAPI(accountID, username, password string) *BandwidthAPI {
+	api := &BandwidthAPI{AccountID: accountID, Username: username, Password: password}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handleMessages))
+	return api
+}
+
+// URL returns the base URL of the fake server
+func (api *BandwidthAPI) URL() string {
+	return api.Server.URL
+}
+
+// Close shuts down the fake server
+func (api *BandwidthAPI) Close() {
+	api.Server.Close()
+}
+
+func (api *BandwidthAPI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" || r.URL.Path != fmt.Sprintf("/users/%s/messages", api.AccountID) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"type":"not-found","description":"Unknown path"}`))
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok || username != api.Username || password != api.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type":"unauthorized","description":"Authentication failed"}`))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var sendReq map[string]interface{}
+	if err := json.Unmarshal(body, &sendReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"request-validation","description":"Invalid JSON"}`))
+		return
+	}
+
+	api.mutex.Lock()
+	api.Requests = append(api.Requests, sendReq)
+	messageID := fmt.Sprintf("bw_%d", len(api.Requests))
+	api.mutex.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":            messageID,
+		"owner":         sendReq["from"],
+		"applicationId": sendReq["applicationId"],
+		"to":            sendReq["to"],
+		"from":          sendReq["from"],
+		"text":          sendReq["text"],
+		"direction":     "out",
+	})
+}
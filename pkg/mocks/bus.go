@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"sync"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+// BusMock is a mock for svc.Bus that records published events. If Err is set, events
+// aren't recorded and it's returned instead
+type BusMock struct {
+	Events []svc.Event
+	Err    error
+	mutex  sync.Mutex
+}
+
+// Publish mocks publishing an event
+func (m *BusMock) Publish(event svc.Event) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Events = append(m.Events, event)
+	return nil
+}
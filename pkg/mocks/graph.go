@@ -0,0 +1,68 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// GraphAPI is a local fake of the Facebook Graph API Send endpoint
+type GraphAPI struct {
+	Server      *httptest.Server
+	AccessToken string
+	Requests    []map[string]interface{}
+	mutex       sync.Mutex
+}
+
+// NewGraphAPI starts a fake Graph API server that accepts accessToken
+func NewGraphAPI(accessToken string) *GraphAPI {
+	api := &GraphAPI{AccessToken: accessToken}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handleMessages))
+	return api
+}
+
+// URL returns the base URL of the fake server
+func (api *GraphAPI) URL() string {
+	return api.Server.URL
+}
+
+// Close shuts down the fake server
+func (api *GraphAPI) Close() {
+	api.Server.Close()
+}
+
+func (api *GraphAPI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" || r.URL.Path != "/me/messages" {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"message":"Unknown path","code":803}}`))
+		return
+	}
+	if r.URL.Query().Get("access_token") != api.AccessToken {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"Invalid OAuth access token.","code":190}}`))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var sendReq map[string]interface{}
+	if err := json.Unmarshal(body, &sendReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"Invalid JSON","code":100}}`))
+		return
+	}
+
+	api.mutex.Lock()
+	api.Requests = append(api.Requests, sendReq)
+	messageID := fmt.Sprintf("m_%d", len(api.Requests))
+	api.mutex.Unlock()
+
+	recipient, _ := sendReq["recipient"].(map[string]interface{})
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"recipient_id": recipient["id"],
+		"message_id":   messageID,
+	})
+}
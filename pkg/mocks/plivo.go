@@ -0,0 +1,71 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// PlivoAPI is a local fake of the Plivo Message API
+type PlivoAPI struct {
+	Server    *httptest.Server
+	AuthID    string
+	AuthToken string
+	Requests  []map[string]interface{}
+	mutex     sync.Mutex
+}
+
+// NewPlivoAPI starts a fake Message API server that accepts authID and authToken
+func NewPlivoAPI(authID, authToken string) *PlivoAPI {
+	api := &PlivoAPI{AuthID: authID, AuthToken: authToken}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handleMessages))
+	return api
+}
+
+// URL returns the base URL of the fake server
+func (api *PlivoAPI) URL() string {
+	return api.Server.URL
+}
+
+// Close shuts down the fake server
+func (api *PlivoAPI) Close() {
+	api.Server.Close()
+}
+
+func (api *PlivoAPI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" || r.URL.Path != fmt.Sprintf("/Account/%s/Message/", api.AuthID) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"api_id":"fake","error":"not found"}`))
+		return
+	}
+	authID, authToken, ok := r.BasicAuth()
+	if !ok || authID != api.AuthID || authToken != api.AuthToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"api_id":"fake","error":"authentication failed"}`))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var sendReq map[string]interface{}
+	if err := json.Unmarshal(body, &sendReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"api_id":"fake","error":"invalid JSON"}`))
+		return
+	}
+
+	api.mutex.Lock()
+	api.Requests = append(api.Requests, sendReq)
+	messageUUID := fmt.Sprintf("plivo-%d", len(api.Requests))
+	api.mutex.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_id":       "fake",
+		"message":      "message(s) queued",
+		"message_uuid": []string{messageUUID},
+	})
+}
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// ProviderMock is a chat.Provider that records sent messages instead of sending them
+type ProviderMock struct {
+	Sent []chat.Message
+	// Errors are returned instead of sending messages with matching bodies
+	Errors map[string]error
+	mutex  sync.Mutex
+}
+
+// Capabilities returns SMS capabilities
+func (p *ProviderMock) Capabilities() chat.Capabilities {
+	return chat.Capabilities{Channel: "sms", MaxLength: 1600}
+}
+
+// VerifyWebhook accepts all requests
+func (p *ProviderMock) VerifyWebhook(chat.WebhookRequest) (bool, error) {
+	return true, nil
+}
+
+// ParseWebhook returns no messages
+func (p *ProviderMock) ParseWebhook(chat.WebhookRequest) ([]chat.Message, error) {
+	return []chat.Message{}, nil
+}
+
+// WebhookResponse returns an empty response
+func (p *ProviderMock) WebhookResponse() (string, string) {
+	return "", "text/plain"
+}
+
+// SendMessage records a message and returns its ID
+func (p *ProviderMock) SendMessage(message chat.Message) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err, ok := p.Errors[message.Body]; ok {
+		return "", err
+	}
+	p.Sent = append(p.Sent, message)
+	return fmt.Sprintf("SM%d", len(p.Sent)), nil
+}
+
+// ParseStatusCallback returns no statuses
+func (p *ProviderMock) ParseStatusCallback(chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	return []chat.DeliveryStatus{}, nil
+}
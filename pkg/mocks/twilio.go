@@ -1,8 +1,12 @@
 package mocks
 
 import (
+	"net/url"
+
 	"github.com/sfreiberg/gotwilio"
 	"github.com/stretchr/testify/mock"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
 )
 
 // TwilioClientMock is a mock for Twilio
@@ -15,3 +19,32 @@ func (m *TwilioClientMock) SendSMS(from, to, body, statusCallback, applicationSi
 	m.Called(from, to, body, statusCallback, applicationSid)
 	return nil, nil, nil
 }
+
+// SendMMS mocks sending Twilio MMS
+func (m *TwilioClientMock) SendMMS(from, to, body string, mediaURLs []string, statusCallback, applicationSid string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	m.Called(from, to, body, mediaURLs, statusCallback, applicationSid)
+	return nil, nil, nil
+}
+
+// GenerateSignature mocks generating a Twilio request signature
+func (m *TwilioClientMock) GenerateSignature(url string, values url.Values) ([]byte, error) {
+	args := m.Called(url, values)
+	return []byte(args.String(0)), nil
+}
+
+// TwilioContentClientMock is a mock for the Twilio Content API
+type TwilioContentClientMock struct {
+	mock.Mock
+}
+
+// CreateContent mocks creating a content template
+func (m *TwilioContentClientMock) CreateContent(template svc.ContentTemplate) (string, error) {
+	args := m.Called(template)
+	return args.String(0), nil
+}
+
+// SendContent mocks sending a message with a content template
+func (m *TwilioContentClientMock) SendContent(from, to, contentSid string, variables map[string]string, statusCallback string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	m.Called(from, to, contentSid, variables, statusCallback)
+	return nil, nil, nil
+}
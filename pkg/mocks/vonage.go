@@ -0,0 +1,74 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// VonageAPI is a local fake of the Vonage SMS API
+type VonageAPI struct {
+	Server    *httptest.Server
+	APIKey    string
+	APISecret string
+	Requests  []url.Values
+	mutex     sync.Mutex
+}
+
+// NewVonageAPI starts a fake SMS API server that accepts apiKey and apiSecret
+func NewVonageAPI(apiKey, apiSecret string) *VonageAPI {
+	api := &VonageAPI{APIKey: apiKey, APISecret: apiSecret}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.handleSMS))
+	return api
+}
+
+// URL returns the base URL of the fake server
+func (api *VonageAPI) URL() string {
+	return api.Server.URL
+}
+
+// Close shuts down the fake server
+func (api *VonageAPI) Close() {
+	api.Server.Close()
+}
+
+// The SMS API responds with 200 and reports errors in the status of each message
+func (api *VonageAPI) handleSMS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" || r.URL.Path != "/sms/json" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeVonageStatus(w, "", "", "3", "Invalid parameters")
+		return
+	}
+	if r.PostForm.Get("api_key") != api.APIKey || r.PostForm.Get("api_secret") != api.APISecret {
+		writeVonageStatus(w, r.PostForm.Get("to"), "", "4", "Bad Credentials")
+		return
+	}
+
+	api.mutex.Lock()
+	api.Requests = append(api.Requests, r.PostForm)
+	messageID := fmt.Sprintf("vonage-%d", len(api.Requests))
+	api.mutex.Unlock()
+
+	writeVonageStatus(w, r.PostForm.Get("to"), messageID, "0", "")
+}
+
+func writeVonageStatus(w http.ResponseWriter, to, messageID, status, errorText string) {
+	message := map[string]string{"to": to, "status": status}
+	if messageID != "" {
+		message["message-id"] = messageID
+	}
+	if errorText != "" {
+		message["error-text"] = errorText
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message-count": "1",
+		"messages":      []map[string]string{message},
+	})
+}
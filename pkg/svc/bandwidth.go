@@ -0,0 +1,221 @@
+package svc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// BandwidthProvider is the SMS provider name for Bandwidth
+const BandwidthProvider = "bandwidth"
+
+// Bandwidth accepts text up to 2048 characters
+const maxBandwidthLen = 2048
+
+// Bandwidth callback event types
+const (
+	bandwidthReceived  = "message-received"
+	bandwidthSending   = "message-sending"
+	bandwidthDelivered = "message-delivered"
+	bandwidthFailed    = "message-failed"
+)
+
+// Bandwidth error codes for invalid numbers (4720), numbers that aren't in service (4721)
+// and contacts who have opted out (4775)
+var bandwidthUnreachableErrorCodes = map[string]bool{
+	"4720": true,
+	"4721": true,
+	"4775": true,
+}
+
+// BandwidthChat implements the chat.Provider interface for the Bandwidth Messaging API
+type BandwidthChat struct {
+	AccountID     string
+	ApplicationID string
+	Username      string
+	Password      string
+	// Basic auth credentials Bandwidth is configured to send with callbacks
+	CallbackUsername string
+	CallbackPassword string
+	From             string
+	BaseURL          string
+	HTTPClient       *http.Client
+}
+
+type bandwidthMessage struct {
+	ID    string   `json:"id"`
+	Time  string   `json:"time"`
+	To    []string `json:"to"`
+	From  string   `json:"from"`
+	Text  string   `json:"text"`
+	Media []string `json:"media"`
+}
+
+type bandwidthEvent struct {
+	Type        string           `json:"type"`
+	Time        string           `json:"time"`
+	Description string           `json:"description"`
+	To          string           `json:"to"`
+	ErrorCode   int              `json:"errorCode"`
+	Message     bandwidthMessage `json:"message"`
+}
+
+type bandwidthSendRequest struct {
+	ApplicationID string   `json:"applicationId"`
+	To            []string `json:"to"`
+	From          string   `json:"from"`
+	Text          string   `json:"text"`
+	Media         []string `json:"media,omitempty"`
+}
+
+type bandwidthSendResponse struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// NewBandwidthChat is a constructor for BandwidthChat structs
+func NewBandwidthChat(accountID, applicationID, username, password, from string) *BandwidthChat {
+	return &BandwidthChat{
+		AccountID:     accountID,
+		ApplicationID: applicationID,
+		Username:      username,
+		Password:      password,
+		From:          from,
+		BaseURL:       "https://messaging.bandwidth.com/api/v2",
+		HTTPClient:    &http.Client{},
+	}
+}
+
+// Capabilities describes the Bandwidth SMS channel
+func (c *BandwidthChat) Capabilities() chat.Capabilities {
+	return chat.Capabilities{Channel: SMSChannel, MaxLength: maxBandwidthLen, Media: true}
+}
+
+// VerifyWebhook checks the basic auth credentials Bandwidth sends with callbacks
+func (c *BandwidthChat) VerifyWebhook(request chat.WebhookRequest) (bool, error) {
+	if c.CallbackUsername == "" || c.CallbackPassword == "" {
+		return false, nil
+	}
+	httpReq := http.Request{Header: http.Header{}}
+	httpReq.Header.Set("Authorization", request.Header("Authorization"))
+	username, password, ok := httpReq.BasicAuth()
+	if !ok {
+		return false, nil
+	}
+	return hmac.Equal([]byte(username), []byte(c.CallbackUsername)) &&
+		hmac.Equal([]byte(password), []byte(c.CallbackPassword)), nil
+}
+
+// ParseWebhook converts message-received events in a callback to chat.Message structs
+func (c *BandwidthChat) ParseWebhook(request chat.WebhookRequest) ([]chat.Message, error) {
+	var events []bandwidthEvent
+	var messages []chat.Message
+	if err := json.Unmarshal([]byte(request.Body), &events); err != nil {
+		return messages, err
+	}
+	for _, event := range events {
+		if event.Type != bandwidthReceived {
+			continue
+		}
+		createdAt := bandwidthTime(event.Time)
+		message := chat.Message{
+			ID:        event.Message.ID,
+			Sender:    event.Message.From,
+			Recipient: event.To,
+			Body:      event.Message.Text,
+			CreatedAt: &createdAt,
+		}
+		for _, mediaURL := range event.Message.Media {
+			message.Media = append(message.Media, chat.Media{URL: mediaURL})
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// WebhookResponse acknowledges callbacks, Bandwidth only checks the status code
+func (c *BandwidthChat) WebhookResponse() (string, string) {
+	return "", "text/plain"
+}
+
+// ParseStatusCallback converts delivery events in a callback to statuses
+func (c *BandwidthChat) ParseStatusCallback(request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	var events []bandwidthEvent
+	statuses := []chat.DeliveryStatus{}
+	if err := json.Unmarshal([]byte(request.Body), &events); err != nil {
+		return statuses, err
+	}
+	for _, event := range events {
+		status := chat.DeliveryStatus{MessageID: event.Message.ID, Recipient: event.To}
+		switch event.Type {
+		case bandwidthSending:
+			status.Status = chat.StatusSent
+		case bandwidthDelivered:
+			status.Status = chat.StatusDelivered
+		case bandwidthFailed:
+			status.Status = chat.StatusFailed
+			status.ErrorCode = strconv.Itoa(event.ErrorCode)
+			status.Unreachable = bandwidthUnreachableErrorCodes[status.ErrorCode]
+		default:
+			continue
+		}
+		createdAt := bandwidthTime(event.Time)
+		status.CreatedAt = &createdAt
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// SendMessage sends a chat.Message through the Messaging API, returning the message ID
+func (c *BandwidthChat) SendMessage(message chat.Message) (string, error) {
+	sendReq := bandwidthSendRequest{
+		ApplicationID: c.ApplicationID,
+		To:            []string{message.Recipient},
+		From:          c.From,
+		Text:          message.Body,
+		Media:         message.MediaURLs(),
+	}
+	reqJSON, _ := json.Marshal(sendReq)
+	req, _ := http.NewRequest(
+		"POST",
+		fmt.Sprintf("%s/users/%s/messages", c.BaseURL, c.AccountID),
+		bytes.NewReader(reqJSON),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.Username, c.Password)
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var sendRes bandwidthSendResponse
+	if err := json.Unmarshal(body, &sendRes); err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusAccepted {
+		return "", &chat.SendError{Code: strconv.Itoa(res.StatusCode), Message: sendRes.Description}
+	}
+	return sendRes.ID, nil
+}
+
+// Bandwidth timestamps are ISO 8601, falling back to the current time if missing
+func bandwidthTime(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Now()
+	}
+	return parsed
+}
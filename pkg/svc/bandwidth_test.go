@@ -0,0 +1,83 @@
+package svc_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+const bandwidthCallbackJSON = `[
+  {"type": "message-received", "time": "2020-05-01T12:00:00.000Z", "to": "+15555555555",
+   "message": {"id": "bw_in", "from": "+15555555556", "to": ["+15555555555"], "text": "Food",
+               "media": ["https://messaging.bandwidth.com/api/v2/users/acct/media/1.jpg"]}},
+  {"type": "message-failed", "time": "2020-05-01T12:00:01.000Z", "to": "+15555555556", "errorCode": 4720,
+   "message": {"id": "bw_out", "from": "+15555555555", "to": ["+15555555556"], "text": "Hi"}}
+]`
+
+func TestBandwidthVerifyWebhook(t *testing.T) {
+	bandwidthChat := svc.NewBandwidthChat("acct", "app", "user", "pass", "+15555555555")
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("callback:secret"))
+	request := chat.WebhookRequest{Headers: map[string]string{"authorization": auth}, Body: bandwidthCallbackJSON}
+	if isValid, _ := bandwidthChat.VerifyWebhook(request); isValid {
+		t.Errorf("Callback accepted without callback credentials configured")
+	}
+	bandwidthChat.CallbackUsername = "callback"
+	bandwidthChat.CallbackPassword = "secret"
+	if isValid, _ := bandwidthChat.VerifyWebhook(request); !isValid {
+		t.Errorf("Callback with valid credentials not accepted")
+	}
+	bandwidthChat.CallbackPassword = "other"
+	if isValid, _ := bandwidthChat.VerifyWebhook(request); isValid {
+		t.Errorf("Callback with invalid credentials accepted")
+	}
+}
+
+func TestBandwidthParseWebhook(t *testing.T) {
+	bandwidthChat := svc.NewBandwidthChat("acct", "app", "user", "pass", "+15555555555")
+	messages, err := bandwidthChat.ParseWebhook(chat.WebhookRequest{Body: bandwidthCallbackJSON})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Callback not ignoring delivery events")
+	}
+	if messages[0].ID != "bw_in" || messages[0].Sender != "+15555555556" || len(messages[0].Media) != 1 {
+		t.Errorf("Received message not converted with sender and media")
+	}
+
+	statuses, err := bandwidthChat.ParseStatusCallback(chat.WebhookRequest{Body: bandwidthCallbackJSON})
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("Callback not ignoring received messages for statuses")
+	}
+	if statuses[0].MessageID != "bw_out" || statuses[0].Status != chat.StatusFailed || statuses[0].ErrorCode != "4720" {
+		t.Errorf("Failed event not converted to failed status with error code")
+	}
+	if !statuses[0].Unreachable {
+		t.Errorf("Invalid destination error not marked unreachable")
+	}
+}
+
+func TestBandwidthSendMessage(t *testing.T) {
+	bandwidthAPI := mocks.NewBandwidthAPI("acct", "user", "pass")
+	defer bandwidthAPI.Close()
+
+	bandwidthChat := svc.NewBandwidthChat("acct", "app", "user", "pass", "+15555555555")
+	bandwidthChat.BaseURL = bandwidthAPI.URL()
+	messageID, err := bandwidthChat.SendMessage(chat.Message{
+		Recipient: "+15555555556",
+		Body:      "Test",
+		Media:     []chat.Media{{URL: "https://example.com/card.vcf", ContentType: "text/vcard"}},
+	})
+	if err != nil || messageID != "bw_1" {
+		t.Fatalf("Message not sent to Messaging API: %v", err)
+	}
+	if bandwidthAPI.Requests[0]["applicationId"] != "app" || len(bandwidthAPI.Requests[0]["media"].([]interface{})) != 1 {
+		t.Errorf("Message not sent with application ID and media")
+	}
+
+	bandwidthChat.Password = "invalid"
+	_, err = bandwidthChat.SendMessage(chat.Message{Recipient: "+15555555556", Body: "Test"})
+	if sendErr, ok := err.(*chat.SendError); !ok || sendErr.Code != "401" {
+		t.Errorf("Messaging API error not returned as SendError")
+	}
+}
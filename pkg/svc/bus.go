@@ -0,0 +1,156 @@
+package svc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// Bus transports events between handlers
+type Bus interface {
+	Publish(Event) error
+}
+
+// BusHandler handles an event published to a feed
+type BusHandler func(Event) error
+
+// NewBus returns the bus for the transport in BUS_TRANSPORT, either "sns" or "sqs".
+// SNS is used if it isn't set
+func NewBus() (Bus, error) {
+	switch transport := os.Getenv("BUS_TRANSPORT"); transport {
+	case "", "sns":
+		return NewSNSClient(), nil
+	case "sqs":
+		return NewSQSClient(), nil
+	default:
+		return nil, fmt.Errorf("Unknown bus transport %s", transport)
+	}
+}
+
+// PublishReceivedMessages publishes received events for messages from a webhook,
+// skipping any the ledger has already received from a retried webhook
+func PublishReceivedMessages(bus Bus, ledger chat.MessageLedger, messages []chat.Message) error {
+	for _, message := range messages {
+		isNew, err := ledger.ReceiveMessage(message)
+		if err != nil {
+			return err
+		}
+		if !isNew {
+			log.Printf("Skipping duplicate message %s", message.ID)
+			continue
+		}
+		if err := bus.Publish(ReceivedEvent(message)); err != nil {
+			// Forget the message so it's published when the webhook is retried
+			_ = ledger.ForgetMessage(message)
+			return err
+		}
+	}
+	return nil
+}
+
+type busMessage struct {
+	id   string
+	body string
+	feed string
+}
+
+// MemoryBus implements Bus in-process, delivering events to handlers subscribed to
+// each feed. Events are delivered one at a time in the order they're published, and
+// are encoded the same way as other transports so handlers can't share state
+type MemoryBus struct {
+	handlers map[string][]BusHandler
+	queue    []busMessage
+	pending  int
+	count    int
+	closed   bool
+	mutex    sync.Mutex
+	cond     *sync.Cond
+}
+
+// NewMemoryBus is a constructor for MemoryBus structs
+func NewMemoryBus() *MemoryBus {
+	bus := &MemoryBus{handlers: map[string][]BusHandler{}}
+	bus.cond = sync.NewCond(&bus.mutex)
+	return bus
+}
+
+// Subscribe adds a handler for events published to a feed
+func (b *MemoryBus) Subscribe(feed string, handler BusHandler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[feed] = append(b.handlers[feed], handler)
+}
+
+// Publish queues an event for delivery
+func (b *MemoryBus) Publish(event Event) error {
+	body, err := event.Body()
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.count++
+	b.queue = append(b.queue, busMessage{id: strconv.Itoa(b.count), body: body, feed: event.Feed})
+	b.pending++
+	b.cond.Broadcast()
+	return nil
+}
+
+// Run delivers queued events until the bus is closed. Handler errors are logged
+// rather than retried
+func (b *MemoryBus) Run() {
+	for {
+		b.mutex.Lock()
+		for len(b.queue) == 0 && !b.closed {
+			b.cond.Wait()
+		}
+		if b.closed {
+			b.mutex.Unlock()
+			return
+		}
+		next := b.queue[0]
+		b.queue = b.queue[1:]
+		handlers := b.handlers[next.feed]
+		b.mutex.Unlock()
+
+		if len(handlers) == 0 {
+			log.Printf("No handler for feed %s", next.feed)
+		}
+		for _, handler := range handlers {
+			event, err := DecodeEvent(next.feed, next.body)
+			event.ID = next.id
+			if err == nil {
+				err = handler(event)
+			}
+			if err != nil {
+				log.Printf("Error handling %s event: %v", next.feed, err)
+			}
+		}
+
+		b.mutex.Lock()
+		b.pending--
+		b.cond.Broadcast()
+		b.mutex.Unlock()
+	}
+}
+
+// Wait blocks until all published events, including any published by handlers, are delivered
+func (b *MemoryBus) Wait() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for b.pending > 0 && !b.closed {
+		b.cond.Wait()
+	}
+}
+
+// Close stops delivering events
+func (b *MemoryBus) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
@@ -0,0 +1,41 @@
+package svc_test
+
+import (
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestMemoryBusOrder(t *testing.T) {
+	bus := svc.NewMemoryBus()
+	go bus.Run()
+	defer bus.Close()
+
+	received := []string{}
+	bus.Subscribe(svc.ReceivedMessageFeed, func(event svc.Event) error {
+		received = append(received, event.Message.Body)
+		// Events published by handlers are delivered after ones already queued
+		return bus.Publish(svc.SendRequestEvent([]chat.Message{
+			{Recipient: event.Message.Sender, Body: "reply to " + event.Message.Body},
+		}))
+	})
+	bus.Subscribe(svc.SendSMSFeed, func(event svc.Event) error {
+		received = append(received, event.Messages[0].Body)
+		return nil
+	})
+
+	_ = bus.Publish(svc.ReceivedEvent(chat.Message{Sender: "+15555555555", Body: "first"}))
+	_ = bus.Publish(svc.ReceivedEvent(chat.Message{Sender: "+15555555555", Body: "second"}))
+	bus.Wait()
+
+	expected := []string{"first", "second", "reply to first", "reply to second"}
+	if len(received) != len(expected) {
+		t.Fatalf("Not all messages delivered: %v", received)
+	}
+	for idx := range expected {
+		if received[idx] != expected[idx] {
+			t.Errorf("Messages not delivered in order: %v", received)
+		}
+	}
+}
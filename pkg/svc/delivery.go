@@ -0,0 +1,191 @@
+package svc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Delivery tracks progress sending a batch of messages to a contact, so a retried
+// send request resumes from the first message that wasn't sent
+type Delivery struct {
+	ID        string    `json:"id"`
+	Recipient string    `json:"recipient"`
+	Total     int       `json:"total"`
+	Sent      int       `json:"sent"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Complete returns whether all messages in a delivery were sent
+func (d *Delivery) Complete() bool {
+	return d.Sent >= d.Total
+}
+
+// DeliveryError is returned when a batch is only partially sent
+type DeliveryError struct {
+	Delivery Delivery
+	Err      error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf(
+		"Sent %d of %d messages to %s: %v",
+		e.Delivery.Sent,
+		e.Delivery.Total,
+		e.Delivery.Recipient,
+		e.Err,
+	)
+}
+
+// DeliveryStore loads and saves delivery progress
+type DeliveryStore interface {
+	// LoadDelivery returns the delivery for a send request event ID, or nil if there isn't one
+	LoadDelivery(id string) (*Delivery, error)
+	SaveDelivery(*Delivery) error
+	// ExpireDeliveries removes deliveries last updated before a time, returning the number removed
+	ExpireDeliveries(before time.Time) (int64, error)
+}
+
+// MemoryDeliveryStore implements DeliveryStore in memory
+type MemoryDeliveryStore struct {
+	deliveries map[string]Delivery
+	mutex      sync.Mutex
+}
+
+// NewMemoryDeliveryStore is a constructor for MemoryDeliveryStore structs
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{deliveries: map[string]Delivery{}}
+}
+
+// LoadDelivery returns a copy of the delivery for an ID
+func (s *MemoryDeliveryStore) LoadDelivery(id string) (*Delivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+	return &delivery, nil
+}
+
+// SaveDelivery creates or updates a delivery
+func (s *MemoryDeliveryStore) SaveDelivery(delivery *Delivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// ExpireDeliveries removes deliveries last updated before a time
+func (s *MemoryDeliveryStore) ExpireDeliveries(before time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var count int64
+	for id, delivery := range s.deliveries {
+		if delivery.UpdatedAt.Before(before) {
+			delete(s.deliveries, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// S3DeliveryStore implements DeliveryStore with a JSON object for each delivery
+type S3DeliveryStore struct {
+	Client *s3.S3
+	Bucket string
+	Prefix string
+}
+
+// NewS3DeliveryStore creates an S3DeliveryStore object saving deliveries under
+// deliveries/ in S3_BUCKET
+func NewS3DeliveryStore() *S3DeliveryStore {
+	sess, _ := session.NewSession()
+	return &S3DeliveryStore{
+		Client: s3.New(sess),
+		Bucket: os.Getenv("S3_BUCKET"),
+		Prefix: "deliveries/",
+	}
+}
+
+// LoadDelivery returns the delivery for an ID
+func (s *S3DeliveryStore) LoadDelivery(id string) (*Delivery, error) {
+	result, err := s.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + id + ".json"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+	deliveryJSON, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return nil, err
+	}
+	var delivery Delivery
+	if err := json.Unmarshal(deliveryJSON, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// SaveDelivery creates or updates a delivery
+func (s *S3DeliveryStore) SaveDelivery(delivery *Delivery) error {
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.Prefix + delivery.ID + ".json"),
+		Body:        bytes.NewReader(deliveryJSON),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// ExpireDeliveries deletes objects under the prefix last modified before a time
+func (s *S3DeliveryStore) ExpireDeliveries(before time.Time) (int64, error) {
+	var count int64
+	var deleteErr error
+	err := s.Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(s.Prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		objects := []*s3.ObjectIdentifier{}
+		for _, object := range page.Contents {
+			if aws.TimeValue(object.LastModified).Before(before) {
+				objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+			}
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		// Pages have at most 1000 objects, which is also the most that can be deleted at once
+		_, deleteErr = s.Client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(s.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if deleteErr == nil {
+			count += int64(len(objects))
+		}
+		return deleteErr == nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, deleteErr
+}
@@ -0,0 +1,111 @@
+package svc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestSenderResumesFromFailedMessage(t *testing.T) {
+	bus := &mocks.BusMock{}
+	provider := &mocks.ProviderMock{Errors: map[string]error{"second": errors.New("Rate limited")}}
+	deliveries := svc.NewMemoryDeliveryStore()
+	sender := svc.NewSender(bus, deliveries)
+	sender.NewProvider = func(from, to string) (chat.Provider, error) { return provider, nil }
+
+	event := svc.SendRequestEvent([]chat.Message{
+		{Recipient: "+15555555555", Body: "first"},
+		{Recipient: "+15555555555", Body: "second"},
+		{Recipient: "+15555555555", Body: "third"},
+	})
+	event.ID = "1"
+
+	err := sender.HandleEvent(event)
+	deliveryErr, ok := err.(*svc.DeliveryError)
+	if !ok {
+		t.Fatalf("Expected delivery error, got %v", err)
+	}
+	if deliveryErr.Delivery.Sent != 1 || len(provider.Sent) != 1 {
+		t.Errorf("Expected 1 message sent before failure, got %d", deliveryErr.Delivery.Sent)
+	}
+
+	// Retrying the event resumes from the message that failed
+	delete(provider.Errors, "second")
+	if err := sender.HandleEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Sent) != 3 || provider.Sent[1].Body != "second" || provider.Sent[2].Body != "third" {
+		t.Errorf("Messages not resumed in order: %v", provider.Sent)
+	}
+	if len(bus.Events) != 3 || bus.Events[0].Feed != svc.SentMessageFeed {
+		t.Errorf("Expected a sent event for each message, got %v", bus.Events)
+	}
+	delivery, _ := deliveries.LoadDelivery("1")
+	if !delivery.Complete() || delivery.Attempts != 2 || delivery.Error != "" {
+		t.Errorf("Delivery not tracked: %v", delivery)
+	}
+
+	// Duplicate deliveries of a completed event aren't sent again
+	if err := sender.HandleEvent(event); err != nil || len(provider.Sent) != 3 {
+		t.Errorf("Completed event sent again")
+	}
+
+	if expired, _ := deliveries.ExpireDeliveries(delivery.UpdatedAt); expired != 0 {
+		t.Errorf("Recent delivery expired")
+	}
+	if expired, _ := deliveries.ExpireDeliveries(time.Now().Add(time.Second)); expired != 1 {
+		t.Errorf("Old delivery not expired")
+	}
+}
+
+func TestSQSFIFOGroupsByContact(t *testing.T) {
+	client := &svc.SQSClient{QueuePrefix: "https://sqs.us-east-2.amazonaws.com/123/chat-", FIFO: true}
+	input, err := client.SendMessageInput(svc.SendRequestEvent([]chat.Message{
+		{Recipient: "+15555555555", Body: "hi"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *input.QueueUrl != "https://sqs.us-east-2.amazonaws.com/123/chat-send_twilio_sms.fifo" {
+		t.Errorf("Unexpected queue URL %s", *input.QueueUrl)
+	}
+	if *input.MessageGroupId != "+15555555555" || input.MessageDeduplicationId == nil {
+		t.Errorf("FIFO attributes not set: %v", input)
+	}
+}
+
+func TestSenderDropsUnreachableRecipient(t *testing.T) {
+	bus := &mocks.BusMock{}
+	provider := &mocks.ProviderMock{Errors: map[string]error{
+		"first": &chat.SendError{Code: "21614", Message: "Not a valid mobile number", Unreachable: true},
+	}}
+	sender := svc.NewSender(bus, svc.NewMemoryDeliveryStore())
+	sender.NewProvider = func(from, to string) (chat.Provider, error) { return provider, nil }
+
+	err := sender.HandleEvent(svc.SendRequestEvent([]chat.Message{
+		{Recipient: "+15555555555", Body: "first"},
+		{Recipient: "+15555555555", Body: "second"},
+	}))
+	if err != nil || len(provider.Sent) != 0 {
+		t.Errorf("Messages to unreachable recipient not dropped: %v", err)
+	}
+	if len(bus.Events) != 1 || bus.Events[0].Feed != svc.DeliveryStatusFeed {
+		t.Fatalf("Expected a delivery status event, got %v", bus.Events)
+	}
+	status := bus.Events[0].Status
+	if status.Recipient != "+15555555555" || status.Status != chat.StatusFailed || status.ErrorCode != "21614" || !status.Unreachable {
+		t.Errorf("Failed send not published: %v", status)
+	}
+
+	// Other rejected messages are retried
+	provider.Errors["first"] = &chat.SendError{Code: "30001", Message: "Queue overflow"}
+	if _, ok := sender.HandleEvent(svc.SendRequestEvent([]chat.Message{
+		{Recipient: "+15555555555", Body: "first"},
+	})).(*svc.DeliveryError); !ok {
+		t.Errorf("Expected delivery error for temporary failure")
+	}
+}
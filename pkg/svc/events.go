@@ -0,0 +1,161 @@
+package svc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// DeliveryStatusFeed is the feed name for handling delivery status updates
+const DeliveryStatusFeed = "handle_delivery_status"
+
+// ErrUnknownFeed is returned when decoding an event for a feed without an event type
+var ErrUnknownFeed = errors.New("Unknown feed")
+
+// Event is a typed event published on a Bus. Feed determines which field is set
+// and which handlers receive it
+type Event struct {
+	Feed string
+	// Set by the transport when an event is delivered, and the same when delivery is retried
+	ID string
+	// Set for ReceivedMessageFeed and SentMessageFeed
+	Message chat.Message
+	// Set for send request feeds, messages are sent in order
+	Messages []chat.Message
+	// Set for DeliveryStatusFeed
+	Status chat.DeliveryStatus
+}
+
+// ReceivedEvent is published when a message is received from a contact
+func ReceivedEvent(message chat.Message) Event {
+	return Event{Feed: ReceivedMessageFeed, Message: message}
+}
+
+// SentEvent is published after a message is sent to a contact
+func SentEvent(message chat.Message) Event {
+	return Event{Feed: SentMessageFeed, Message: message}
+}
+
+// SendRequestEvent requests sending messages to a contact, on the feed for their channel
+func SendRequestEvent(messages []chat.Message) Event {
+	feed := SendSMSFeed
+	if len(messages) > 0 {
+		feed = SendFeedForRecipient(messages[0].Recipient)
+	}
+	return Event{Feed: feed, Messages: messages}
+}
+
+// DeliveryStatusEvent is published when a provider reports the status of a sent message
+func DeliveryStatusEvent(status chat.DeliveryStatus) Event {
+	return Event{Feed: DeliveryStatusFeed, Status: status}
+}
+
+// IsSendRequest returns whether an event is a request to send messages
+func (e Event) IsSendRequest() bool {
+	return e.Feed == SendSMSFeed || e.Feed == SendMessengerFeed
+}
+
+// GroupID returns the contact an event is for, so transports that support ordering
+// can deliver events for each contact in order
+func (e Event) GroupID() string {
+	var contact string
+	switch {
+	case e.Feed == ReceivedMessageFeed:
+		contact = e.Message.Sender
+	case e.Feed == SentMessageFeed:
+		contact = e.Message.Recipient
+	case e.IsSendRequest() && len(e.Messages) > 0:
+		contact = e.Messages[0].Recipient
+	case e.Feed == DeliveryStatusFeed:
+		contact = e.Status.Recipient
+	}
+	if contact == "" {
+		return e.Feed
+	}
+	return contact
+}
+
+// Body returns the JSON body an event is published with
+func (e Event) Body() (string, error) {
+	var body []byte
+	var err error
+	switch {
+	case e.Feed == ReceivedMessageFeed || e.Feed == SentMessageFeed:
+		body, err = json.Marshal(e.Message)
+	case e.IsSendRequest():
+		body, err = json.Marshal(e.Messages)
+	case e.Feed == DeliveryStatusFeed:
+		body, err = json.Marshal(e.Status)
+	default:
+		return "", ErrUnknownFeed
+	}
+	return string(body), err
+}
+
+// DecodeEvent parses the body of an event published to a feed
+func DecodeEvent(feed, body string) (Event, error) {
+	event := Event{Feed: feed}
+	var err error
+	switch {
+	case feed == ReceivedMessageFeed || feed == SentMessageFeed:
+		err = json.Unmarshal([]byte(body), &event.Message)
+	case event.IsSendRequest():
+		err = json.Unmarshal([]byte(body), &event.Messages)
+	case feed == DeliveryStatusFeed:
+		err = json.Unmarshal([]byte(body), &event.Status)
+	default:
+		err = ErrUnknownFeed
+	}
+	return event, err
+}
+
+// LambdaEvents decodes the events in a Lambda invocation from either SNS or SQS,
+// skipping any without a known feed
+func LambdaEvents(payload json.RawMessage) ([]Event, error) {
+	busEvents := []Event{}
+	var snsEvent events.SNSEvent
+	if err := json.Unmarshal(payload, &snsEvent); err != nil {
+		return busEvents, err
+	}
+	if len(snsEvent.Records) > 0 && snsEvent.Records[0].EventSource == "aws:sns" {
+		for _, record := range snsEvent.Records {
+			feedMap, _ := record.SNS.MessageAttributes[feedAttribute].(map[string]interface{})
+			feed, _ := feedMap["Value"].(string)
+			event, err := DecodeEvent(feed, record.SNS.Message)
+			if err == ErrUnknownFeed {
+				log.Printf("No handler for feed %s", feed)
+				continue
+			} else if err != nil {
+				return busEvents, err
+			}
+			event.ID = record.SNS.MessageID
+			busEvents = append(busEvents, event)
+		}
+		return busEvents, nil
+	}
+
+	var sqsEvent events.SQSEvent
+	if err := json.Unmarshal(payload, &sqsEvent); err != nil {
+		return busEvents, err
+	}
+	for _, record := range sqsEvent.Records {
+		var feed string
+		if attribute, ok := record.MessageAttributes[feedAttribute]; ok && attribute.StringValue != nil {
+			feed = *attribute.StringValue
+		}
+		event, err := DecodeEvent(feed, record.Body)
+		if err == ErrUnknownFeed {
+			log.Printf("No handler for feed %s", feed)
+			continue
+		} else if err != nil {
+			return busEvents, err
+		}
+		event.ID = record.MessageId
+		busEvents = append(busEvents, event)
+	}
+	return busEvents, nil
+}
@@ -0,0 +1,52 @@
+package svc_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestEventBodyRoundTrip(t *testing.T) {
+	event := svc.SendRequestEvent([]chat.Message{{Recipient: "messenger:123", Body: "hello"}})
+	if event.Feed != svc.SendMessengerFeed {
+		t.Errorf("Expected send request on %s, got %s", svc.SendMessengerFeed, event.Feed)
+	}
+	body, err := event.Body()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := svc.DecodeEvent(event.Feed, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Messages) != 1 || decoded.Messages[0].Body != "hello" {
+		t.Errorf("Event not decoded: %v", decoded)
+	}
+	if _, err := svc.DecodeEvent("unknown", body); err != svc.ErrUnknownFeed {
+		t.Errorf("Expected unknown feed error, got %v", err)
+	}
+}
+
+func TestLambdaEvents(t *testing.T) {
+	messageJSON, _ := json.Marshal(`{"sender":"+15555555555","body":"hi"}`)
+	snsPayload := `{"Records":[{"EventSource":"aws:sns","Sns":{"Message":` + string(messageJSON) +
+		`,"MessageAttributes":{"feed":{"Type":"String","Value":"handle_received_message"}}}},` +
+		`{"EventSource":"aws:sns","Sns":{"Message":"{}","MessageAttributes":{"feed":{"Type":"String","Value":"unknown"}}}}]}`
+	sqsPayload := `{"Records":[{"eventSource":"aws:sqs","body":` + string(messageJSON) +
+		`,"messageAttributes":{"feed":{"dataType":"String","stringValue":"handle_received_message"}}}]}`
+
+	for name, payload := range map[string]string{"sns": snsPayload, "sqs": sqsPayload} {
+		busEvents, err := svc.LambdaEvents(json.RawMessage(payload))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(busEvents) != 1 {
+			t.Fatalf("%s: expected 1 event, got %d", name, len(busEvents))
+		}
+		if busEvents[0].Feed != svc.ReceivedMessageFeed || busEvents[0].Message.Body != "hi" {
+			t.Errorf("%s: event not decoded: %v", name, busEvents[0])
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package svc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// MessengerChannel is the channel name for Facebook Messenger
+const MessengerChannel = "messenger"
+
+// Messenger allows up to 13 quick replies with titles of 20 characters
+const maxQuickReplies = 13
+const maxQuickReplyLen = 20
+
+// MaxMessengerLen is the maximum length of a Messenger text message
+const MaxMessengerLen = 2000
+
+const messengerPrefix = "messenger:"
+
+// MessengerChat implements the chat.Provider interface for Facebook Messenger
+type MessengerChat struct {
+	PageAccessToken string
+	AppSecret       string
+	VerifyToken     string
+	GraphURL        string
+	HTTPClient      *http.Client
+}
+
+type messengerWebhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID        string           `json:"id"`
+		Messaging []messengerEvent `json:"messaging"`
+	} `json:"entry"`
+}
+
+type messengerEvent struct {
+	Sender    messengerUser `json:"sender"`
+	Recipient messengerUser `json:"recipient"`
+	Timestamp int64         `json:"timestamp"`
+	Message   *struct {
+		MID        string `json:"mid"`
+		Text       string `json:"text"`
+		IsEcho     bool   `json:"is_echo"`
+		QuickReply *struct {
+			Payload string `json:"payload"`
+		} `json:"quick_reply"`
+		Attachments []struct {
+			Type    string `json:"type"`
+			Payload struct {
+				URL string `json:"url"`
+			} `json:"payload"`
+		} `json:"attachments"`
+	} `json:"message"`
+	Postback *struct {
+		MID     string `json:"mid"`
+		Title   string `json:"title"`
+		Payload string `json:"payload"`
+	} `json:"postback"`
+	Delivery *struct {
+		MIDs      []string `json:"mids"`
+		Watermark int64    `json:"watermark"`
+	} `json:"delivery"`
+	Read *struct {
+		Watermark int64 `json:"watermark"`
+	} `json:"read"`
+}
+
+type messengerUser struct {
+	ID string `json:"id"`
+}
+
+type messengerQuickReply struct {
+	ContentType string `json:"content_type"`
+	Title       string `json:"title"`
+	Payload     string `json:"payload"`
+}
+
+type messengerSendRequest struct {
+	Recipient     messengerUser `json:"recipient"`
+	MessagingType string        `json:"messaging_type"`
+	Message       struct {
+		Text         string                `json:"text"`
+		QuickReplies []messengerQuickReply `json:"quick_replies,omitempty"`
+	} `json:"message"`
+}
+
+type messengerSendResponse struct {
+	RecipientID string `json:"recipient_id"`
+	MessageID   string `json:"message_id"`
+	Error       *struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+// NewMessengerChat is a constructor for MessengerChat structs
+func NewMessengerChat(pageAccessToken, appSecret, verifyToken string) *MessengerChat {
+	return &MessengerChat{
+		PageAccessToken: pageAccessToken,
+		AppSecret:       appSecret,
+		VerifyToken:     verifyToken,
+		GraphURL:        "https://graph.facebook.com/v8.0",
+		HTTPClient:      &http.Client{},
+	}
+}
+
+// MessengerAddress prefixes a page-scoped ID so it isn't confused with phone numbers
+func MessengerAddress(id string) string {
+	return messengerPrefix + id
+}
+
+// IsMessengerAddress returns whether an address belongs to Messenger
+func IsMessengerAddress(address string) bool {
+	return strings.HasPrefix(address, messengerPrefix)
+}
+
+// VerifySubscription handles the verification handshake when subscribing a webhook,
+// returning the challenge to respond with if the verify token matches
+func (c *MessengerChat) VerifySubscription(query url.Values) (string, bool) {
+	if query.Get("hub.mode") != "subscribe" || c.VerifyToken == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(query.Get("hub.verify_token")), []byte(c.VerifyToken)) {
+		return "", false
+	}
+	return query.Get("hub.challenge"), true
+}
+
+// CheckSignature validates the X-Hub-Signature or X-Hub-Signature-256 header against the request body
+func (c *MessengerChat) CheckSignature(body []byte, signature string) bool {
+	var mac hash.Hash
+	var sigHex string
+	if strings.HasPrefix(signature, "sha256=") {
+		mac = hmac.New(sha256.New, []byte(c.AppSecret))
+		sigHex = strings.TrimPrefix(signature, "sha256=")
+	} else if strings.HasPrefix(signature, "sha1=") {
+		mac = hmac.New(sha1.New, []byte(c.AppSecret))
+		sigHex = strings.TrimPrefix(signature, "sha1=")
+	} else {
+		return false
+	}
+	expected, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return false
+	}
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Capabilities describes the Messenger channel
+func (c *MessengerChat) Capabilities() chat.Capabilities {
+	return chat.Capabilities{
+		Channel:       MessengerChannel,
+		MaxLength:     MaxMessengerLen,
+		Menus:         true,
+		SessionWindow: time.Hour * 24,
+	}
+}
+
+// VerifyWebhook checks the signature header of a webhook request
+func (c *MessengerChat) VerifyWebhook(request chat.WebhookRequest) (bool, error) {
+	signature := request.Header("X-Hub-Signature-256")
+	if signature == "" {
+		signature = request.Header("X-Hub-Signature")
+	}
+	return c.CheckSignature([]byte(request.Body), signature), nil
+}
+
+// ParseWebhook converts a webhook request into chat.Message structs
+func (c *MessengerChat) ParseWebhook(request chat.WebhookRequest) ([]chat.Message, error) {
+	return c.HandleWebhook([]byte(request.Body))
+}
+
+// WebhookResponse acknowledges webhook events
+func (c *MessengerChat) WebhookResponse() (string, string) {
+	return "EVENT_RECEIVED", "text/plain"
+}
+
+// ParseStatusCallback converts delivery and read events in a webhook request to statuses
+func (c *MessengerChat) ParseStatusCallback(request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	var webhook messengerWebhook
+	statuses := []chat.DeliveryStatus{}
+	if err := json.Unmarshal([]byte(request.Body), &webhook); err != nil {
+		return statuses, err
+	}
+	for _, entry := range webhook.Entry {
+		for _, event := range entry.Messaging {
+			createdAt := time.Unix(0, event.Timestamp*int64(time.Millisecond))
+			if event.Delivery != nil {
+				for _, mid := range event.Delivery.MIDs {
+					statuses = append(statuses, chat.DeliveryStatus{
+						MessageID: mid,
+						Recipient: MessengerAddress(event.Sender.ID),
+						Status:    chat.StatusDelivered,
+						CreatedAt: &createdAt,
+					})
+				}
+			} else if event.Read != nil {
+				// Read events only include a watermark, so they apply to all earlier messages
+				statuses = append(statuses, chat.DeliveryStatus{
+					Recipient: MessengerAddress(event.Sender.ID),
+					Status:    chat.StatusRead,
+					CreatedAt: &createdAt,
+				})
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// HandleWebhook converts a webhook request body into chat.Message structs
+func (c *MessengerChat) HandleWebhook(body []byte) ([]chat.Message, error) {
+	var webhook messengerWebhook
+	var messages []chat.Message
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return messages, err
+	}
+	if webhook.Object != "page" {
+		return messages, fmt.Errorf("Unsupported webhook object %s", webhook.Object)
+	}
+
+	for _, entry := range webhook.Entry {
+		for _, event := range entry.Messaging {
+			createdAt := time.Unix(0, event.Timestamp*int64(time.Millisecond))
+			message := chat.Message{
+				Sender:       MessengerAddress(event.Sender.ID),
+				Recipient:    MessengerAddress(event.Recipient.ID),
+				CreatedAt:    &createdAt,
+				SessionStart: &createdAt,
+			}
+			if event.Message != nil && !event.Message.IsEcho {
+				message.ID = event.Message.MID
+				message.Body = event.Message.Text
+				// Selecting a quick reply sends its payload, which is the option value
+				if event.Message.QuickReply != nil {
+					message.Body = event.Message.QuickReply.Payload
+				}
+				for _, attachment := range event.Message.Attachments {
+					if attachment.Payload.URL != "" {
+						message.Media = append(message.Media, chat.Media{
+							URL:         attachment.Payload.URL,
+							ContentType: attachment.Type,
+						})
+					}
+				}
+			} else if event.Postback != nil {
+				message.ID = event.Postback.MID
+				message.Body = event.Postback.Payload
+			} else {
+				// Ignore echoes, deliveries, reads and other events
+				continue
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// SendMessage sends a chat.Message through the Send API, returning the message ID
+func (c *MessengerChat) SendMessage(message chat.Message) (string, error) {
+	sendReq := messengerSendRequest{
+		Recipient:     messengerUser{ID: strings.TrimPrefix(message.Recipient, messengerPrefix)},
+		MessagingType: "RESPONSE",
+	}
+	sendReq.Message.Text = message.Body
+	sendReq.Message.QuickReplies = quickReplies(message.Menu)
+	for _, media := range message.Media {
+		sendReq.Message.Text += fmt.Sprintf("\n%s", media.URL)
+	}
+
+	reqJSON, _ := json.Marshal(sendReq)
+	reqURL := fmt.Sprintf("%s/me/messages?access_token=%s", c.GraphURL, url.QueryEscape(c.PageAccessToken))
+	res, err := c.HTTPClient.Post(reqURL, "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var sendRes messengerSendResponse
+	if err := json.Unmarshal(body, &sendRes); err != nil {
+		return "", err
+	}
+	if sendRes.Error != nil {
+		return "", &chat.SendError{Code: strconv.Itoa(sendRes.Error.Code), Message: sendRes.Error.Message}
+	}
+	return sendRes.MessageID, nil
+}
+
+// Menus are displayed as quick replies if they fit Messenger's limits
+func quickReplies(menu *chat.Menu) []messengerQuickReply {
+	var replies []messengerQuickReply
+	if menu == nil || len(menu.Options) > maxQuickReplies {
+		return replies
+	}
+	for _, option := range menu.Options {
+		title := []rune(option.Label)
+		if len(title) > maxQuickReplyLen {
+			title = title[:maxQuickReplyLen]
+		}
+		replies = append(replies, messengerQuickReply{
+			ContentType: "text",
+			Title:       string(title),
+			Payload:     option.Value,
+		})
+	}
+	return replies
+}
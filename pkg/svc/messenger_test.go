@@ -0,0 +1,109 @@
+package svc_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+const messengerWebhookJSON = `{
+  "object": "page",
+  "entry": [{
+    "id": "PAGE",
+    "messaging": [
+      {"sender": {"id": "USER"}, "recipient": {"id": "PAGE"}, "timestamp": 1590000000000,
+       "message": {"mid": "m_1", "text": "Food", "quick_reply": {"payload": "2"}}},
+      {"sender": {"id": "PAGE"}, "recipient": {"id": "USER"}, "timestamp": 1590000000000,
+       "message": {"mid": "m_2", "text": "Echo", "is_echo": true}},
+      {"sender": {"id": "USER"}, "recipient": {"id": "PAGE"}, "timestamp": 1590000000000,
+       "delivery": {"mids": ["m_2"]}}
+    ]
+  }]
+}`
+
+func TestMessengerVerifySubscription(t *testing.T) {
+	messengerChat := svc.NewMessengerChat("token", "secret", "verify")
+	challenge, ok := messengerChat.VerifySubscription(url.Values{
+		"hub.mode":         []string{"subscribe"},
+		"hub.verify_token": []string{"verify"},
+		"hub.challenge":    []string{"12345"},
+	})
+	if !ok || challenge != "12345" {
+		t.Errorf("Valid verify token not returning challenge")
+	}
+	_, ok = messengerChat.VerifySubscription(url.Values{
+		"hub.mode":         []string{"subscribe"},
+		"hub.verify_token": []string{"wrong"},
+		"hub.challenge":    []string{"12345"},
+	})
+	if ok {
+		t.Errorf("Invalid verify token accepted")
+	}
+}
+
+func TestMessengerCheckSignature(t *testing.T) {
+	messengerChat := svc.NewMessengerChat("token", "secret", "verify")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(messengerWebhookJSON))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !messengerChat.CheckSignature([]byte(messengerWebhookJSON), signature) {
+		t.Errorf("Valid signature not accepted")
+	}
+	if messengerChat.CheckSignature([]byte(messengerWebhookJSON+" "), signature) {
+		t.Errorf("Signature accepted for modified body")
+	}
+	if messengerChat.CheckSignature([]byte(messengerWebhookJSON), "") {
+		t.Errorf("Missing signature accepted")
+	}
+}
+
+func TestMessengerHandleWebhook(t *testing.T) {
+	messengerChat := svc.NewMessengerChat("token", "secret", "verify")
+	messages, err := messengerChat.HandleWebhook([]byte(messengerWebhookJSON))
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Webhook not ignoring echoes and delivery events")
+	}
+	if messages[0].Body != "2" || messages[0].Sender != "messenger:USER" || messages[0].ID != "m_1" {
+		t.Errorf("Quick reply not converted to message with option value")
+	}
+}
+
+func TestMessengerSendMessage(t *testing.T) {
+	graphAPI := mocks.NewGraphAPI("token")
+	defer graphAPI.Close()
+
+	messengerChat := svc.NewMessengerChat("token", "secret", "verify")
+	messengerChat.GraphURL = graphAPI.URL()
+	messageID, err := messengerChat.SendMessage(chat.Message{
+		Sender:    "messenger:PAGE",
+		Recipient: "messenger:USER",
+		Body:      "Pick one",
+		Menu: &chat.Menu{Options: []chat.Option{
+			chat.Option{Value: "0", Label: "All of these"},
+			chat.Option{Value: "1", Label: "A label that is much too long for a quick reply"},
+		}},
+	})
+	if err != nil || messageID == "" {
+		t.Fatalf("Message not sent to Graph API: %v", err)
+	}
+	recipient := graphAPI.Requests[0]["recipient"].(map[string]interface{})
+	if recipient["id"] != "USER" {
+		t.Errorf("Recipient not sent as page-scoped ID")
+	}
+	message := graphAPI.Requests[0]["message"].(map[string]interface{})
+	quickReplies := message["quick_replies"].([]interface{})
+	if len(quickReplies) != 2 || len([]rune(quickReplies[1].(map[string]interface{})["title"].(string))) > 20 {
+		t.Errorf("Menu not sent as quick replies within length limits")
+	}
+
+	messengerChat.PageAccessToken = "invalid"
+	if _, err := messengerChat.SendMessage(chat.Message{Recipient: "messenger:USER", Body: "Test"}); err == nil {
+		t.Errorf("Graph API error not returned")
+	}
+}
@@ -0,0 +1,184 @@
+package svc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// PlivoProvider is the SMS provider name for Plivo
+const PlivoProvider = "plivo"
+
+// Plivo splits and concatenates messages up to 1600 characters
+const maxPlivoLen = 1600
+
+// Plivo includes up to 10 numbered Media fields for inbound MMS
+const maxPlivoMedia = 10
+
+// Plivo error codes for invalid numbers (50), numbers that are permanently unavailable (70)
+// and contacts who have opted out (200)
+var plivoUnreachableErrorCodes = map[string]bool{
+	"50":  true,
+	"70":  true,
+	"200": true,
+}
+
+// PlivoChat implements the chat.Provider interface for the Plivo Message API
+type PlivoChat struct {
+	AuthID     string
+	AuthToken  string
+	From       string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type plivoSendRequest struct {
+	Src       string   `json:"src"`
+	Dst       string   `json:"dst"`
+	Text      string   `json:"text"`
+	Type      string   `json:"type,omitempty"`
+	MediaURLs []string `json:"media_urls,omitempty"`
+}
+
+type plivoSendResponse struct {
+	APIID       string   `json:"api_id"`
+	Message     string   `json:"message"`
+	MessageUUID []string `json:"message_uuid"`
+	Error       string   `json:"error"`
+}
+
+// NewPlivoChat is a constructor for PlivoChat structs
+func NewPlivoChat(authID, authToken, from string) *PlivoChat {
+	return &PlivoChat{
+		AuthID:     authID,
+		AuthToken:  authToken,
+		From:       from,
+		BaseURL:    "https://api.plivo.com/v1",
+		HTTPClient: &http.Client{},
+	}
+}
+
+// Capabilities describes the Plivo SMS channel
+func (c *PlivoChat) Capabilities() chat.Capabilities {
+	return chat.Capabilities{Channel: SMSChannel, MaxLength: maxPlivoLen, Media: true}
+}
+
+// VerifyWebhook checks the X-Plivo-Signature-V2 header, an HMAC of the URL and nonce
+func (c *PlivoChat) VerifyWebhook(request chat.WebhookRequest) (bool, error) {
+	signature := request.Header("X-Plivo-Signature-V2")
+	nonce := request.Header("X-Plivo-Signature-V2-Nonce")
+	if signature == "" || nonce == "" {
+		return false, nil
+	}
+	expected := PlivoSignature(request.URL, nonce, c.AuthToken)
+	return hmac.Equal([]byte(expected), []byte(signature)), nil
+}
+
+// ParseWebhook converts an inbound message webhook request to a chat.Message
+func (c *PlivoChat) ParseWebhook(request chat.WebhookRequest) ([]chat.Message, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	createdAt := time.Now()
+	message := chat.Message{
+		ID:        values.Get("MessageUUID"),
+		Sender:    E164(values.Get("From")),
+		Recipient: E164(values.Get("To")),
+		Body:      values.Get("Text"),
+		CreatedAt: &createdAt,
+	}
+	for i := 0; i < maxPlivoMedia; i++ {
+		if mediaURL := values.Get(fmt.Sprintf("Media%d", i)); mediaURL != "" {
+			message.Media = append(message.Media, chat.Media{URL: mediaURL})
+		}
+	}
+	return []chat.Message{message}, nil
+}
+
+// WebhookResponse returns an empty XML response so Plivo doesn't send a reply itself
+func (c *PlivoChat) WebhookResponse() (string, string) {
+	return `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`, "application/xml"
+}
+
+// ParseStatusCallback converts a Plivo message status callback to a delivery status
+func (c *PlivoChat) ParseStatusCallback(request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		return []chat.DeliveryStatus{}, err
+	}
+	status := values.Get("Status")
+	if status == "rejected" {
+		status = chat.StatusFailed
+	}
+	errorCode := values.Get("ErrorCode")
+	if errorCode == "000" {
+		errorCode = ""
+	}
+	createdAt := time.Now()
+	return []chat.DeliveryStatus{{
+		MessageID:   values.Get("MessageUUID"),
+		Recipient:   E164(values.Get("To")),
+		Status:      status,
+		ErrorCode:   errorCode,
+		Unreachable: plivoUnreachableErrorCodes[errorCode],
+		CreatedAt:   &createdAt,
+	}}, nil
+}
+
+// SendMessage sends a chat.Message through the Message API, returning the message UUID
+func (c *PlivoChat) SendMessage(message chat.Message) (string, error) {
+	sendReq := plivoSendRequest{
+		Src:  strings.TrimPrefix(c.From, "+"),
+		Dst:  strings.TrimPrefix(message.Recipient, "+"),
+		Text: message.Body,
+	}
+	if message.HasMedia() {
+		sendReq.Type = "mms"
+		sendReq.MediaURLs = message.MediaURLs()
+	}
+	reqJSON, _ := json.Marshal(sendReq)
+	req, _ := http.NewRequest(
+		"POST",
+		fmt.Sprintf("%s/Account/%s/Message/", c.BaseURL, c.AuthID),
+		bytes.NewReader(reqJSON),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.AuthID, c.AuthToken)
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var sendRes plivoSendResponse
+	if err := json.Unmarshal(body, &sendRes); err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusAccepted || len(sendRes.MessageUUID) == 0 {
+		return "", &chat.SendError{Code: strconv.Itoa(res.StatusCode), Message: sendRes.Error}
+	}
+	return sendRes.MessageUUID[0], nil
+}
+
+// PlivoSignature returns the V2 signature for a request URL and nonce
+func PlivoSignature(requestURL, nonce, authToken string) string {
+	mac := hmac.New(sha256.New, []byte(authToken))
+	mac.Write([]byte(requestURL + nonce))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,91 @@
+package svc_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestPlivoVerifyWebhook(t *testing.T) {
+	plivoChat := svc.NewPlivoChat("auth", "token", "+15555555555")
+	requestURL := "https://example.com/api/sms/plivo"
+	request := chat.WebhookRequest{
+		URL: requestURL,
+		Headers: map[string]string{
+			"X-Plivo-Signature-V2":       svc.PlivoSignature(requestURL, "12345", "token"),
+			"X-Plivo-Signature-V2-Nonce": "12345",
+		},
+	}
+	if isValid, _ := plivoChat.VerifyWebhook(request); !isValid {
+		t.Errorf("Valid signature not accepted")
+	}
+	request.URL = "https://example.com/api/sms/other"
+	if isValid, _ := plivoChat.VerifyWebhook(request); isValid {
+		t.Errorf("Signature accepted for a different URL")
+	}
+}
+
+func TestPlivoParseWebhook(t *testing.T) {
+	plivoChat := svc.NewPlivoChat("auth", "token", "+15555555555")
+	messages, err := plivoChat.ParseWebhook(chat.WebhookRequest{Body: url.Values{
+		"From":        []string{"15555555556"},
+		"To":          []string{"15555555555"},
+		"Text":        []string{"Food"},
+		"Type":        []string{"mms"},
+		"MessageUUID": []string{"uuid-in"},
+		"Media0":      []string{"https://media.plivo.com/1.jpg"},
+	}.Encode()})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Inbound webhook not parsed")
+	}
+	if messages[0].Sender != "+15555555556" || messages[0].ID != "uuid-in" || len(messages[0].Media) != 1 {
+		t.Errorf("Inbound message not converted with sender and media")
+	}
+
+	statuses, _ := plivoChat.ParseStatusCallback(chat.WebhookRequest{Body: url.Values{
+		"MessageUUID": []string{"plivo-1"},
+		"To":          []string{"15555555556"},
+		"Status":      []string{"rejected"},
+		"ErrorCode":   []string{"450"},
+	}.Encode()})
+	if statuses[0].Status != chat.StatusFailed || statuses[0].ErrorCode != "450" || statuses[0].Unreachable {
+		t.Errorf("Rejected status not converted to failed with error code")
+	}
+
+	statuses, _ = plivoChat.ParseStatusCallback(chat.WebhookRequest{Body: url.Values{
+		"MessageUUID": []string{"plivo-2"},
+		"To":          []string{"15555555556"},
+		"Status":      []string{"undelivered"},
+		"ErrorCode":   []string{"200"},
+	}.Encode()})
+	if !statuses[0].Unreachable {
+		t.Errorf("Opted out recipient not marked unreachable")
+	}
+}
+
+func TestPlivoSendMessage(t *testing.T) {
+	plivoAPI := mocks.NewPlivoAPI("auth", "token")
+	defer plivoAPI.Close()
+
+	plivoChat := svc.NewPlivoChat("auth", "token", "+15555555555")
+	plivoChat.BaseURL = plivoAPI.URL()
+	messageID, err := plivoChat.SendMessage(chat.Message{
+		Recipient: "+15555555556",
+		Body:      "Test",
+		Media:     []chat.Media{{URL: "https://example.com/card.vcf"}},
+	})
+	if err != nil || messageID != "plivo-1" {
+		t.Fatalf("Message not sent to Message API: %v", err)
+	}
+	if plivoAPI.Requests[0]["dst"] != "15555555556" || plivoAPI.Requests[0]["type"] != "mms" {
+		t.Errorf("Message with media not sent as MMS")
+	}
+
+	plivoChat.AuthToken = "invalid"
+	if _, err = plivoChat.SendMessage(chat.Message{Recipient: "+15555555556", Body: "Test"}); err == nil {
+		t.Errorf("Message API error not returned")
+	}
+}
@@ -0,0 +1,326 @@
+package svc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sfreiberg/gotwilio"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// ProviderConstructor creates a Provider for messages between an automated address and a contact
+type ProviderConstructor func(from, to string) chat.Provider
+
+// TwilioProvider is the SMS provider name for Twilio, used unless another is configured
+const TwilioProvider = "twilio"
+
+// Providers for each channel other than SMS, configured from environment variables.
+// New channels can be added here without updating handlers
+var providerConstructors = map[string]ProviderConstructor{
+	WhatsAppChannel:  newTwilioProvider,
+	MessengerChannel: newMessengerProvider,
+}
+
+// SMS providers, selected per automated number
+var smsProviderConstructors = map[string]ProviderConstructor{
+	TwilioProvider:    newTwilioProvider,
+	BandwidthProvider: newBandwidthProvider,
+	VonageProvider:    newVonageProvider,
+	PlivoProvider:     newPlivoProvider,
+}
+
+var _ chat.Provider = &TwilioChat{}
+var _ chat.Provider = &MessengerChat{}
+var _ chat.Provider = &BandwidthChat{}
+var _ chat.Provider = &VonageChat{}
+var _ chat.Provider = &PlivoChat{}
+
+// NewProvider returns the Provider for the channel of the contact address
+func NewProvider(from, to string) (chat.Provider, error) {
+	return NewChannelProvider(ChannelForAddress(to), from, to)
+}
+
+// NewChannelProvider returns the Provider for a channel
+func NewChannelProvider(channel, from, to string) (chat.Provider, error) {
+	if channel == SMSChannel || channel == MMSChannel {
+		return NewSMSProvider(SMSProviderForNumber(from), from, to)
+	}
+	constructor, ok := providerConstructors[channel]
+	if !ok {
+		return nil, fmt.Errorf("No provider for channel %s", channel)
+	}
+	return constructor(from, to), nil
+}
+
+// NewSMSProvider returns an SMS provider by name
+func NewSMSProvider(name, from, to string) (chat.Provider, error) {
+	constructor, ok := smsProviderConstructors[name]
+	if !ok {
+		return nil, fmt.Errorf("No SMS provider named %s", name)
+	}
+	return constructor(from, to), nil
+}
+
+// SMSProviderForNumber returns the SMS provider for an automated number from
+// SMS_PROVIDERS, a comma-separated list of number=provider pairs
+func SMSProviderForNumber(number string) string {
+	for _, pair := range strings.Split(os.Getenv("SMS_PROVIDERS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) == 2 && E164(parts[0]) == E164(number) {
+			return parts[1]
+		}
+	}
+	return TwilioProvider
+}
+
+// E164 adds the leading + to phone numbers from providers that omit it
+func E164(number string) string {
+	if number == "" || strings.HasPrefix(number, "+") {
+		return number
+	}
+	return "+" + number
+}
+
+func newTwilioProvider(from, to string) chat.Provider {
+	client := gotwilio.NewTwilioClient(
+		os.Getenv("TWILIO_ACCOUNT_SID"),
+		os.Getenv("TWILIO_AUTH_TOKEN"),
+	)
+	twilioChat := NewTwilioChat(client, from, to)
+	twilioChat.Content = NewTwilioContent(
+		os.Getenv("TWILIO_ACCOUNT_SID"),
+		os.Getenv("TWILIO_AUTH_TOKEN"),
+	)
+	if templateSid := os.Getenv("WHATSAPP_TEMPLATE_SID"); templateSid != "" {
+		twilioChat.DefaultTemplate = &chat.Template{ID: templateSid}
+	}
+	if endpoint := os.Getenv("GW_ENDPOINT"); endpoint != "" {
+		twilioChat.StatusCallback = fmt.Sprintf("%s/api/status/%s", endpoint, TwilioProvider)
+	}
+	return twilioChat
+}
+
+func newMessengerProvider(from, to string) chat.Provider {
+	return NewMessengerChat(
+		os.Getenv("MESSENGER_PAGE_ACCESS_TOKEN"),
+		os.Getenv("MESSENGER_APP_SECRET"),
+		os.Getenv("MESSENGER_VERIFY_TOKEN"),
+	)
+}
+
+func newBandwidthProvider(from, to string) chat.Provider {
+	bandwidthChat := NewBandwidthChat(
+		os.Getenv("BANDWIDTH_ACCOUNT_ID"),
+		os.Getenv("BANDWIDTH_APPLICATION_ID"),
+		os.Getenv("BANDWIDTH_USERNAME"),
+		os.Getenv("BANDWIDTH_PASSWORD"),
+		from,
+	)
+	bandwidthChat.CallbackUsername = os.Getenv("BANDWIDTH_CALLBACK_USERNAME")
+	bandwidthChat.CallbackPassword = os.Getenv("BANDWIDTH_CALLBACK_PASSWORD")
+	return bandwidthChat
+}
+
+func newVonageProvider(from, to string) chat.Provider {
+	return NewVonageChat(
+		os.Getenv("VONAGE_API_KEY"),
+		os.Getenv("VONAGE_API_SECRET"),
+		os.Getenv("VONAGE_SIGNATURE_SECRET"),
+		from,
+	)
+}
+
+func newPlivoProvider(from, to string) chat.Provider {
+	return NewPlivoChat(os.Getenv("PLIVO_AUTH_ID"), os.Getenv("PLIVO_AUTH_TOKEN"), from)
+}
+
+// NewWebhookRequest converts an API Gateway request into a chat.WebhookRequest,
+// using endpoint as the base of the URL the request was sent to
+func NewWebhookRequest(request events.APIGatewayProxyRequest, endpoint string) chat.WebhookRequest {
+	query := url.Values{}
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	requestURL := fmt.Sprintf("%s%s", endpoint, request.Path)
+	if len(query) > 0 {
+		requestURL = fmt.Sprintf("%s?%s", requestURL, query.Encode())
+	}
+	return chat.WebhookRequest{
+		URL:     requestURL,
+		Headers: request.Headers,
+		Query:   query,
+		Body:    request.Body,
+	}
+}
+
+// NewHTTPWebhookRequest converts an HTTP request into a chat.WebhookRequest, using
+// endpoint as the base of the URL the request was sent to
+func NewHTTPWebhookRequest(request *http.Request, endpoint string) (chat.WebhookRequest, error) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return chat.WebhookRequest{}, err
+	}
+	headers := map[string]string{}
+	for key := range request.Header {
+		headers[key] = request.Header.Get(key)
+	}
+	requestURL := fmt.Sprintf("%s%s", endpoint, request.URL.Path)
+	if request.URL.RawQuery != "" {
+		requestURL = fmt.Sprintf("%s?%s", requestURL, request.URL.RawQuery)
+	}
+	return chat.WebhookRequest{
+		URL:     requestURL,
+		Headers: headers,
+		Query:   request.URL.Query(),
+		Body:    string(body),
+	}, nil
+}
+
+// ReceiveWebhook verifies and parses an inbound webhook request with a provider
+func ReceiveWebhook(provider chat.Provider, request chat.WebhookRequest) ([]chat.Message, error) {
+	isValid, err := provider.VerifyWebhook(request)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	if !isValid {
+		return []chat.Message{}, fmt.Errorf("%s webhook signature is not valid", provider.Capabilities().Channel)
+	}
+	return provider.ParseWebhook(request)
+}
+
+// ReceiveStatusCallback verifies and parses a delivery status webhook request with a provider
+func ReceiveStatusCallback(provider chat.Provider, request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	isValid, err := provider.VerifyWebhook(request)
+	if err != nil {
+		return []chat.DeliveryStatus{}, err
+	}
+	if !isValid {
+		return []chat.DeliveryStatus{}, fmt.Errorf("%s webhook signature is not valid", provider.Capabilities().Channel)
+	}
+	return provider.ParseStatusCallback(request)
+}
+
+// Sender handles send request events, sending messages in order through the
+// provider for each recipient. If Deliveries is set, progress is saved after each
+// message so a retried event resumes from the first message that wasn't sent
+type Sender struct {
+	Bus         Bus
+	Deliveries  DeliveryStore
+	Interval    time.Duration // Pause between messages in a batch
+	NewProvider func(from, to string) (chat.Provider, error)
+}
+
+// NewSender is a constructor for Sender structs using providers configured from the
+// environment, pausing for SEND_INTERVAL (like "1s") between messages
+func NewSender(bus Bus, deliveries DeliveryStore) *Sender {
+	interval, _ := time.ParseDuration(os.Getenv("SEND_INTERVAL"))
+	return &Sender{Bus: bus, Deliveries: deliveries, Interval: interval, NewProvider: NewProvider}
+}
+
+// HandleEvent sends the messages in a send request event, returning a DeliveryError
+// if any weren't sent
+func (s *Sender) HandleEvent(event Event) error {
+	if len(event.Messages) == 0 {
+		return nil
+	}
+	delivery, err := s.loadDelivery(event)
+	if err != nil {
+		return err
+	}
+	if delivery.Complete() {
+		return nil
+	}
+	delivery.Attempts++
+
+	start := delivery.Sent
+	for idx := start; idx < len(event.Messages); idx++ {
+		if idx > start && s.Interval > 0 {
+			time.Sleep(s.Interval)
+		}
+		message := event.Messages[idx]
+		provider, err := s.NewProvider(message.Sender, message.Recipient)
+		if err == nil {
+			message.ID, err = provider.SendMessage(message)
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+			if saveErr := s.saveDelivery(delivery); saveErr != nil {
+				log.Println(saveErr)
+			}
+			return s.handleSendError(message, delivery, err)
+		}
+		delivery.Sent++
+		delivery.Error = ""
+		// Progress is saved before publishing so a retry doesn't send the message again
+		if err := s.saveDelivery(delivery); err != nil {
+			return err
+		}
+		createdAt := time.Now()
+		if err := s.Bus.Publish(SentEvent(chat.Message{
+			ID:        message.ID,
+			Sender:    message.Sender,
+			Recipient: message.Recipient,
+			Body:      message.Body,
+			Media:     message.Media,
+			CreatedAt: &createdAt,
+		})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publishes a failed status for messages a provider rejected. Batches to unreachable
+// recipients are dropped, since retrying won't deliver them
+func (s *Sender) handleSendError(message chat.Message, delivery *Delivery, err error) error {
+	sendErr, ok := err.(*chat.SendError)
+	if !ok {
+		return &DeliveryError{Delivery: *delivery, Err: err}
+	}
+	createdAt := time.Now()
+	if pubErr := s.Bus.Publish(DeliveryStatusEvent(chat.DeliveryStatus{
+		Recipient:   message.Recipient,
+		Status:      chat.StatusFailed,
+		ErrorCode:   sendErr.Code,
+		Unreachable: sendErr.Unreachable,
+		CreatedAt:   &createdAt,
+	})); pubErr != nil {
+		return pubErr
+	}
+	if sendErr.Unreachable {
+		log.Printf("Dropping %d messages to unreachable recipient: %v", delivery.Total-delivery.Sent, err)
+		return nil
+	}
+	return &DeliveryError{Delivery: *delivery, Err: err}
+}
+
+// Returns the saved delivery for an event, or a new one if there isn't one
+func (s *Sender) loadDelivery(event Event) (*Delivery, error) {
+	if s.Deliveries != nil && event.ID != "" {
+		delivery, err := s.Deliveries.LoadDelivery(event.ID)
+		if err != nil || delivery != nil {
+			return delivery, err
+		}
+	}
+	return &Delivery{
+		ID:        event.ID,
+		Recipient: event.Messages[0].Recipient,
+		Total:     len(event.Messages),
+	}, nil
+}
+
+func (s *Sender) saveDelivery(delivery *Delivery) error {
+	if s.Deliveries == nil || delivery.ID == "" {
+		return nil
+	}
+	delivery.UpdatedAt = time.Now()
+	return s.Deliveries.SaveDelivery(delivery)
+}
@@ -0,0 +1,142 @@
+package svc_test
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestNewProviderChannel(t *testing.T) {
+	provider, err := svc.NewProvider("+15555555555", "+15555555556")
+	if err != nil || provider.Capabilities().Channel != svc.SMSChannel {
+		t.Errorf("Phone number not using SMS provider")
+	}
+	provider, err = svc.NewProvider("messenger:PAGE", "messenger:USER")
+	if err != nil || provider.Capabilities().Channel != svc.MessengerChannel {
+		t.Errorf("Messenger address not using Messenger provider")
+	}
+	if _, err = svc.NewProvider("+15555555555", "web:123"); err == nil {
+		t.Errorf("Provider returned for channel without one")
+	}
+}
+
+func TestReceiveWebhookTwilio(t *testing.T) {
+	client := &mocks.TwilioClientMock{}
+	twilioChat := svc.NewTwilioChat(client, "+15555555555", "")
+	body := url.Values{
+		"MessageSid": []string{"SM123"},
+		"From":       []string{"+15555555556"},
+		"To":         []string{"+15555555555"},
+		"Body":       []string{"Hi"},
+	}.Encode()
+	request := svc.NewWebhookRequest(events.APIGatewayProxyRequest{
+		Path:    "/twilio",
+		Headers: map[string]string{"x-twilio-signature": "valid"},
+		Body:    body,
+	}, "https://example.com")
+	client.On("GenerateSignature", "https://example.com/twilio", mock.Anything).Return("valid")
+
+	messages, err := svc.ReceiveWebhook(twilioChat, request)
+	if err != nil || len(messages) != 1 || messages[0].ID != "SM123" || messages[0].Sender != "+15555555556" {
+		t.Errorf("Valid webhook not converted to message")
+	}
+
+	request.Headers = map[string]string{"X-Twilio-Signature": "invalid"}
+	if _, err = svc.ReceiveWebhook(twilioChat, request); err == nil {
+		t.Errorf("Webhook with invalid signature accepted")
+	}
+}
+
+func TestTwilioParseStatusCallback(t *testing.T) {
+	twilioChat := svc.NewTwilioChat(nil, "+15555555555", "")
+	statuses, err := twilioChat.ParseStatusCallback(chat.WebhookRequest{Body: url.Values{
+		"MessageSid":    []string{"SM123"},
+		"To":            []string{"+15555555556"},
+		"MessageStatus": []string{"undelivered"},
+		"ErrorCode":     []string{"30003"},
+	}.Encode()})
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("Status callback not parsed")
+	}
+	if statuses[0].Status != chat.StatusUndelivered || statuses[0].ErrorCode != "30003" {
+		t.Errorf("Status callback not including status and error code")
+	}
+}
+
+func TestReceiveStatusCallbackTwilio(t *testing.T) {
+	client := &mocks.TwilioClientMock{}
+	twilioChat := svc.NewTwilioChat(client, "+15555555555", "")
+	request := svc.NewWebhookRequest(events.APIGatewayProxyRequest{
+		Path:    "/api/status/twilio",
+		Headers: map[string]string{"X-Twilio-Signature": "valid"},
+		Body: url.Values{
+			"MessageSid":    []string{"SM123"},
+			"To":            []string{"+15555555556"},
+			"MessageStatus": []string{"undelivered"},
+			"ErrorCode":     []string{"30006"},
+		}.Encode(),
+	}, "https://example.com")
+	client.On("GenerateSignature", "https://example.com/api/status/twilio", mock.Anything).Return("valid")
+
+	statuses, err := svc.ReceiveStatusCallback(twilioChat, request)
+	if err != nil || len(statuses) != 1 || statuses[0].ErrorCode != "30006" || !statuses[0].Unreachable {
+		t.Errorf("Valid status callback not parsed")
+	}
+
+	request.Headers = map[string]string{"X-Twilio-Signature": "invalid"}
+	if _, err = svc.ReceiveStatusCallback(twilioChat, request); err == nil {
+		t.Errorf("Status callback with invalid signature accepted")
+	}
+}
+
+func TestTwilioStatusCallbackURL(t *testing.T) {
+	os.Setenv("GW_ENDPOINT", "https://example.com")
+	defer os.Unsetenv("GW_ENDPOINT")
+	provider, _ := svc.NewSMSProvider(svc.TwilioProvider, "+15555555555", "+15555555556")
+	if provider.(*svc.TwilioChat).StatusCallback != "https://example.com/api/status/twilio" {
+		t.Errorf("Status callback not set from GW_ENDPOINT")
+	}
+
+	client := &mocks.TwilioClientMock{}
+	twilioChat := svc.NewTwilioChat(client, "+15555555555", "+15555555556")
+	twilioChat.StatusCallback = "https://example.com/api/status/twilio"
+	client.On("SendSMS", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Test"})
+	client.AssertCalled(t, "SendSMS", "+15555555555", "+15555555556", "Test", "https://example.com/api/status/twilio", "")
+}
+
+func TestMessengerParseStatusCallback(t *testing.T) {
+	messengerChat := svc.NewMessengerChat("token", "secret", "verify")
+	statuses, err := messengerChat.ParseStatusCallback(chat.WebhookRequest{Body: messengerWebhookJSON})
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("Delivery event not parsed as status")
+	}
+	if statuses[0].MessageID != "m_2" || statuses[0].Status != chat.StatusDelivered {
+		t.Errorf("Delivery event not converted to delivered status")
+	}
+}
+
+func TestSMSProviderForNumber(t *testing.T) {
+	os.Setenv("SMS_PROVIDERS", "+15555555555=bandwidth, 15555555556=vonage")
+	defer os.Unsetenv("SMS_PROVIDERS")
+	if svc.SMSProviderForNumber("+15555555555") != svc.BandwidthProvider {
+		t.Errorf("Configured provider not returned for number")
+	}
+	if svc.SMSProviderForNumber("+15555555556") != svc.VonageProvider {
+		t.Errorf("Configured number without + not matched")
+	}
+	if svc.SMSProviderForNumber("+15555555557") != svc.TwilioProvider {
+		t.Errorf("Twilio not used for unconfigured number")
+	}
+	provider, err := svc.NewProvider("+15555555555", "+15555555558")
+	if _, ok := provider.(*svc.BandwidthChat); err != nil || !ok {
+		t.Errorf("Provider not selected by automated number")
+	}
+}
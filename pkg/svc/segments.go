@@ -0,0 +1,58 @@
+package svc
+
+import "strings"
+
+// GSM7Encoding is the default SMS encoding, which fits 160 characters in a segment
+const GSM7Encoding = "GSM-7"
+
+// UCS2Encoding is used when a message has characters outside of GSM-7, which fits
+// 70 characters in a segment
+const UCS2Encoding = "UCS-2"
+
+// Characters in the GSM 03.38 basic character set
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// Characters in the GSM 03.38 extension table, which take two septets
+const gsm7Extended = "^{}\\[~]|€\f"
+
+// SMSSegments returns how many segments a message body is sent as and the
+// encoding used. Segments of concatenated messages lose space to a header
+func SMSSegments(body string) (int, string) {
+	length, isGSM7 := gsm7Length(body)
+	encoding := GSM7Encoding
+	single, multi := 160, 153
+	if !isGSM7 {
+		// UCS-2 counts UTF-16 code units, so characters outside the BMP take two
+		encoding = UCS2Encoding
+		single, multi = 70, 67
+		length = 0
+		for _, r := range body {
+			if r > 0xFFFF {
+				length += 2
+			} else {
+				length++
+			}
+		}
+	}
+	if length <= single {
+		return 1, encoding
+	}
+	return (length + multi - 1) / multi, encoding
+}
+
+// Returns the length of a body in septets and whether it can be encoded as GSM-7
+func gsm7Length(body string) (int, bool) {
+	length := 0
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			length++
+		case strings.ContainsRune(gsm7Extended, r):
+			length += 2
+		default:
+			return 0, false
+		}
+	}
+	return length, true
+}
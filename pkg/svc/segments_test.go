@@ -0,0 +1,28 @@
+package svc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestSMSSegments(t *testing.T) {
+	if count, encoding := svc.SMSSegments(strings.Repeat("a", 160)); count != 1 || encoding != svc.GSM7Encoding {
+		t.Errorf("160 GSM-7 characters not sent in one segment")
+	}
+	if count, _ := svc.SMSSegments(strings.Repeat("a", 161)); count != 2 {
+		t.Errorf("161 GSM-7 characters not split into two segments")
+	}
+	// Extension characters take two septets
+	if count, _ := svc.SMSSegments(strings.Repeat("€", 80) + "a"); count != 2 {
+		t.Errorf("Extension characters not counted twice")
+	}
+	if count, encoding := svc.SMSSegments(strings.Repeat("ñ", 70)); count != 1 || encoding != svc.GSM7Encoding {
+		t.Errorf("GSM-7 accented characters not using GSM-7")
+	}
+	// The punctuation space used to force Unicode switches to UCS-2
+	if count, encoding := svc.SMSSegments(strings.Repeat("a", 70) + " "); count != 2 || encoding != svc.UCS2Encoding {
+		t.Errorf("Non-GSM-7 characters not using UCS-2 segments")
+	}
+}
@@ -1,6 +1,8 @@
 package svc
 
 import (
+	"os"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
@@ -15,32 +17,47 @@ const SentMessageFeed = "handle_sent_message"
 // SendSMSFeed is the feed name for sending a Twilio SMS message
 const SendSMSFeed = "send_twilio_sms"
 
-// SNS is an interface for the SNSClient and associated mock
-type SNS interface {
-	Publish(string, string, string) error
+// SendMessengerFeed is the feed name for sending a Facebook Messenger message
+const SendMessengerFeed = "send_messenger"
+
+// Events are routed to handlers with a message attribute for their feed
+const feedAttribute = "feed"
+
+// SendFeedForRecipient returns the feed that sends messages to a recipient's channel
+func SendFeedForRecipient(recipient string) string {
+	if IsMessengerAddress(recipient) {
+		return SendMessengerFeed
+	}
+	return SendSMSFeed
 }
 
-// SNSClient implements SNS for a generic way of managing the SNS service
+// SNSClient implements Bus with an SNS topic, using subscription filter policies on
+// the feed attribute to route events to handlers
 type SNSClient struct {
-	Client *sns.SNS
+	Client   *sns.SNS
+	TopicArn string
 }
 
-// NewSNSClient creates an SNSClient object
+// NewSNSClient creates an SNSClient object for the topic in SNS_TOPIC_ARN
 func NewSNSClient() *SNSClient {
 	sess, _ := session.NewSession()
 	client := sns.New(sess)
-	return &SNSClient{Client: client}
+	return &SNSClient{Client: client, TopicArn: os.Getenv("SNS_TOPIC_ARN")}
 }
 
-// Publish sends a message to a given topic and feed
-func (c *SNSClient) Publish(message string, topicArn string, feed string) error {
-	_, err := c.Client.Publish(&sns.PublishInput{
-		Message:  aws.String(message),
-		TopicArn: aws.String(topicArn),
+// Publish sends an event to the topic with its feed
+func (c *SNSClient) Publish(event Event) error {
+	body, err := event.Body()
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.Publish(&sns.PublishInput{
+		Message:  aws.String(body),
+		TopicArn: aws.String(c.TopicArn),
 		MessageAttributes: map[string]*sns.MessageAttributeValue{
-			"feed": &sns.MessageAttributeValue{
+			feedAttribute: &sns.MessageAttributeValue{
 				DataType:    aws.String("String"),
-				StringValue: aws.String(feed),
+				StringValue: aws.String(event.Feed),
 			},
 		},
 	})
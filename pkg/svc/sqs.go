@@ -0,0 +1,76 @@
+package svc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSClient implements Bus with a queue for each feed, named with a shared prefix
+// followed by the feed name. With FIFO queues, events for each contact are delivered
+// in order, and later events for a contact wait while an earlier one is retried
+type SQSClient struct {
+	Client      *sqs.SQS
+	QueuePrefix string
+	FIFO        bool
+}
+
+// NewSQSClient creates an SQSClient object for queues starting with SQS_QUEUE_PREFIX,
+// which is the queue URL without the feed name. Set SQS_FIFO to "true" for FIFO queues
+func NewSQSClient() *SQSClient {
+	sess, _ := session.NewSession()
+	client := sqs.New(sess)
+	return &SQSClient{
+		Client:      client,
+		QueuePrefix: os.Getenv("SQS_QUEUE_PREFIX"),
+		FIFO:        os.Getenv("SQS_FIFO") == "true",
+	}
+}
+
+// QueueURL returns the URL of the queue for a feed
+func (c *SQSClient) QueueURL(feed string) string {
+	if c.FIFO {
+		return c.QueuePrefix + feed + ".fifo"
+	}
+	return c.QueuePrefix + feed
+}
+
+// SendMessageInput returns the input for sending an event to the queue for its feed
+func (c *SQSClient) SendMessageInput(event Event) (*sqs.SendMessageInput, error) {
+	body, err := event.Body()
+	if err != nil {
+		return nil, err
+	}
+	input := &sqs.SendMessageInput{
+		MessageBody: aws.String(body),
+		QueueUrl:    aws.String(c.QueueURL(event.Feed)),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			feedAttribute: &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.Feed),
+			},
+		},
+	}
+	if c.FIFO {
+		// Bodies include message IDs or timestamps, so retried sends are deduplicated
+		// without dropping identical replies to separate messages
+		hash := sha256.Sum256([]byte(body))
+		input.MessageGroupId = aws.String(event.GroupID())
+		input.MessageDeduplicationId = aws.String(hex.EncodeToString(hash[:]))
+	}
+	return input, nil
+}
+
+// Publish sends an event to the queue for its feed
+func (c *SQSClient) Publish(event Event) error {
+	input, err := c.SendMessageInput(event)
+	if err != nil {
+		return err
+	}
+	_, err = c.Client.SendMessage(input)
+	return err
+}
@@ -2,25 +2,85 @@ package svc
 
 import (
 	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/gorilla/schema"
 	"github.com/sfreiberg/gotwilio"
 )
 
+// SMSChannel is the channel name for plain text messages
+const SMSChannel = "sms"
+
+// MMSChannel is the channel name for messages that can include media
+const MMSChannel = "mms"
+
+// WhatsAppChannel is the channel name for WhatsApp messages sent through Twilio
+const WhatsAppChannel = "whatsapp"
+
+// WhatsAppSessionWindow is how long after a user's last message free-form replies are allowed
+const WhatsAppSessionWindow = time.Hour * 24
+
+// WhatsApp list messages can include at most 10 items with titles of 24 characters
+const maxWhatsAppListItems = 10
+const maxWhatsAppListItemLen = 24
+
+const whatsAppPrefix = "whatsapp:"
+
+// Twilio splits and concatenates messages up to 1600 characters
+const maxTwilioLen = 1600
+
+// Twilio error codes for numbers that won't be able to receive messages, like landlines
+// (30006), unknown numbers (30005, 21614) and contacts who have opted out (21610)
+var twilioUnreachableErrorCodes = map[string]bool{
+	"21211": true,
+	"21610": true,
+	"21614": true,
+	"30004": true,
+	"30005": true,
+	"30006": true,
+}
+
+// ErrOutsideSessionWindow is returned when a free-form WhatsApp message can't be
+// sent because the session has expired and no template is available
+var ErrOutsideSessionWindow = errors.New("WhatsApp session window has expired and no template is set")
+
 // TwilioClient generalizes access to Twilio
 type TwilioClient interface {
 	SendSMS(string, string, string, string, string) (*gotwilio.SmsResponse, *gotwilio.Exception, error)
+	SendMMS(string, string, string, []string, string, string) (*gotwilio.SmsResponse, *gotwilio.Exception, error)
 	GenerateSignature(string, url.Values) ([]byte, error)
 }
 
 // TwilioChat implements the chat.Provider interface for Twilio messaging
 type TwilioChat struct {
 	Client  TwilioClient
-	From    string // The Twilio automated number
-	To      string // The user sending SMS
-	Channel string // TODO: Should be SMS, MMS, WhatsApp?
+	Content TwilioContentClient // Optional, used for interactive WhatsApp messages
+	From    string              // The Twilio automated number
+	To      string              // The user sending SMS
+	Channel string              // One of SMSChannel, MMSChannel or WhatsAppChannel
+	// Pre-approved template sent when a WhatsApp session has expired
+	DefaultTemplate *chat.Template
+	// URL Twilio sends delivery status updates to, if set
+	StatusCallback string
+}
+
+// Content templates created for menus are reused across invocations
+var listPickerSids = map[string]string{}
+var listPickerMutex sync.Mutex
+
+// twilioInteractiveWebhook includes fields sent for replies to interactive messages
+type twilioInteractiveWebhook struct {
+	ButtonPayload string `form:"ButtonPayload"`
+	ListID        string `form:"ListId"`
 }
 
 // NewTwilioChat is a constructor for Twilio Chat structs
@@ -29,12 +89,216 @@ func NewTwilioChat(client TwilioClient, from, to string) *TwilioChat {
 		Client:  client,
 		From:    from,
 		To:      to,
-		Channel: "",
+		Channel: ChannelForAddress(to),
+	}
+}
+
+// ChannelForAddress returns the channel an address belongs to based on its prefix
+func ChannelForAddress(address string) string {
+	switch {
+	case IsWhatsAppAddress(address):
+		return WhatsAppChannel
+	case IsMessengerAddress(address):
+		return MessengerChannel
+	case IsWebAddress(address):
+		return WebChannel
+	default:
+		return SMSChannel
 	}
 }
 
+// MaxMenuOptions returns the most options a channel can display in a menu, or 0 if
+// there's no limit
+func MaxMenuOptions(channel string) int {
+	switch channel {
+	case WhatsAppChannel:
+		return maxWhatsAppListItems
+	case MessengerChannel:
+		return maxQuickReplies
+	default:
+		return 0
+	}
+}
+
+// IsWhatsAppAddress returns whether an address is a Twilio WhatsApp address
+func IsWhatsAppAddress(address string) bool {
+	return strings.HasPrefix(address, whatsAppPrefix)
+}
+
+// InSessionWindow returns whether a WhatsApp session started at sessionStart is still open
+func InSessionWindow(sessionStart *time.Time) bool {
+	return sessionStart != nil && time.Since(*sessionStart) < WhatsAppSessionWindow
+}
+
 func (c *TwilioChat) SendSMS(body string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
-	return c.Client.SendSMS(c.From, c.To, body, "", "")
+	return c.Client.SendSMS(c.From, c.To, body, c.StatusCallback, "")
+}
+
+// SendMMS sends a message with media attachments, falling back to SMS if none are included
+func (c *TwilioChat) SendMMS(body string, mediaURLs []string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	if len(mediaURLs) == 0 {
+		return c.SendSMS(body)
+	}
+	return c.Client.SendMMS(c.From, c.To, body, mediaURLs, c.StatusCallback, "")
+}
+
+// Capabilities describes the Twilio channel used for this chat
+func (c *TwilioChat) Capabilities() chat.Capabilities {
+	if c.Channel == WhatsAppChannel {
+		return chat.Capabilities{
+			Channel:       WhatsAppChannel,
+			MaxLength:     maxTwilioLen,
+			Media:         true,
+			Menus:         c.Content != nil,
+			SessionWindow: WhatsAppSessionWindow,
+		}
+	}
+	return chat.Capabilities{Channel: c.Channel, MaxLength: maxTwilioLen, Media: true}
+}
+
+// VerifyWebhook checks the X-Twilio-Signature header of a webhook request
+func (c *TwilioChat) VerifyWebhook(request chat.WebhookRequest) (bool, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		return false, err
+	}
+	return c.CheckSignature(request.URL, request.Header("X-Twilio-Signature"), values)
+}
+
+// ParseWebhook converts an inbound message webhook request to a chat.Message
+func (c *TwilioChat) ParseWebhook(request chat.WebhookRequest) ([]chat.Message, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	message, err := c.HandleWebhookValues(values)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	return []chat.Message{message}, nil
+}
+
+// WebhookResponse returns empty TwiML so that Twilio doesn't send a reply itself
+func (c *TwilioChat) WebhookResponse() (string, string) {
+	return `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`, "text/html"
+}
+
+// ParseStatusCallback converts a Twilio status callback request to a delivery status
+func (c *TwilioChat) ParseStatusCallback(request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	values, err := url.ParseQuery(request.Body)
+	if err != nil {
+		return []chat.DeliveryStatus{}, err
+	}
+	createdAt := time.Now()
+	return []chat.DeliveryStatus{{
+		MessageID:   values.Get("MessageSid"),
+		Recipient:   values.Get("To"),
+		Status:      values.Get("MessageStatus"),
+		ErrorCode:   values.Get("ErrorCode"),
+		Unreachable: twilioUnreachableErrorCodes[values.Get("ErrorCode")],
+		CreatedAt:   &createdAt,
+	}}, nil
+}
+
+// SendMessage sends a chat.Message and returns the Twilio message SID
+func (c *TwilioChat) SendMessage(message chat.Message) (string, error) {
+	res, exception, err := c.sendMessage(message)
+	if err != nil {
+		return "", err
+	}
+	if exception != nil {
+		code := strconv.Itoa(int(exception.Code))
+		return "", &chat.SendError{Code: code, Message: exception.Message, Unreachable: twilioUnreachableErrorCodes[code]}
+	}
+	if res == nil {
+		return "", nil
+	}
+	return res.Sid, nil
+}
+
+// Sends a chat.Message using the best format available for the channel
+func (c *TwilioChat) sendMessage(message chat.Message) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	if c.Channel == WhatsAppChannel {
+		return c.sendWhatsApp(message)
+	}
+	if message.HasMedia() {
+		c.Channel = MMSChannel
+		return c.SendMMS(message.Body, message.MediaURLs())
+	}
+	return c.SendSMS(message.Body)
+}
+
+func (c *TwilioChat) sendWhatsApp(message chat.Message) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	// Outside of the session window only pre-approved templates can be sent
+	if !InSessionWindow(message.SessionStart) {
+		template := message.Template
+		if template == nil {
+			template = c.DefaultTemplate
+		}
+		if template == nil || c.Content == nil {
+			return nil, nil, ErrOutsideSessionWindow
+		}
+		return c.Content.SendContent(c.From, c.To, template.ID, template.Variables, c.StatusCallback)
+	}
+	if c.Content != nil && canSendListPicker(message.Menu) {
+		contentSid, err := c.listPickerSid(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c.Content.SendContent(c.From, c.To, contentSid, nil, c.StatusCallback)
+	}
+	return c.SendMMS(message.Body, message.MediaURLs())
+}
+
+func canSendListPicker(menu *chat.Menu) bool {
+	if menu == nil || len(menu.Options) == 0 || len(menu.Options) > maxWhatsAppListItems {
+		return false
+	}
+	for _, option := range menu.Options {
+		if len([]rune(option.Label)) > maxWhatsAppListItemLen {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the SID of a list picker template for a menu, creating it if it doesn't exist
+func (c *TwilioChat) listPickerSid(message chat.Message) (string, error) {
+	items := []ListPickerItem{}
+	for _, option := range message.Menu.Options {
+		items = append(items, ListPickerItem{ID: option.Value, Item: option.Label})
+	}
+	language := message.Menu.Language
+	if language == "" {
+		language = "en"
+	}
+	template := ContentTemplate{
+		Language: language,
+		Types: map[string]interface{}{
+			"twilio/list-picker": ListPicker{
+				Body:   message.Menu.Prompt,
+				Button: message.Menu.Button,
+				Items:  items,
+			},
+			"twilio/text": map[string]string{"body": message.Body},
+		},
+	}
+	templateJSON, _ := json.Marshal(template)
+	hash := sha256.Sum256(templateJSON)
+	key := hex.EncodeToString(hash[:])
+
+	listPickerMutex.Lock()
+	defer listPickerMutex.Unlock()
+	if sid, ok := listPickerSids[key]; ok {
+		return sid, nil
+	}
+	template.FriendlyName = "menu_" + key[:16]
+	sid, err := c.Content.CreateContent(template)
+	if err != nil {
+		return "", err
+	}
+	listPickerSids[key] = sid
+	return sid, nil
 }
 
 // HandleSMSWebhook manages incoming SMS webhooks and converts them to chat.Message structs
@@ -45,11 +309,38 @@ func (c *TwilioChat) HandleSMSWebhook(data gotwilio.SMSWebhook) (chat.Message, e
 		Sender:    data.From,
 		Recipient: data.To,
 		Body:      data.Body,
+		Media:     webhookMedia(data),
 		CreatedAt: &createdAt,
 	}
 	return message, nil
 }
 
+// HandleWebhookValues decodes a webhook request body and converts it to a chat.Message,
+// using the selected option as the body for replies to interactive messages
+func (c *TwilioChat) HandleWebhookValues(values url.Values) (chat.Message, error) {
+	var smsWebhook gotwilio.SMSWebhook
+	var interactive twilioInteractiveWebhook
+
+	// Create custom decoder ignoring keys not in webhook struct
+	formDecoder := schema.NewDecoder()
+	formDecoder.IgnoreUnknownKeys(true)
+	formDecoder.SetAliasTag("form")
+	if err := formDecoder.Decode(&smsWebhook, values); err != nil {
+		return chat.Message{}, err
+	}
+	if err := formDecoder.Decode(&interactive, values); err != nil {
+		return chat.Message{}, err
+	}
+
+	message, err := c.HandleSMSWebhook(smsWebhook)
+	if interactive.ListID != "" {
+		message.Body = interactive.ListID
+	} else if interactive.ButtonPayload != "" {
+		message.Body = interactive.ButtonPayload
+	}
+	return message, err
+}
+
 func (c *TwilioChat) CheckSignature(url, signature string, values url.Values) (bool, error) {
 	expected, err := c.Client.GenerateSignature(url, values)
 	if err != nil {
@@ -58,3 +349,27 @@ func (c *TwilioChat) CheckSignature(url, signature string, values url.Values) (b
 
 	return hmac.Equal(expected, []byte(signature)), nil
 }
+
+// Twilio sends media as numbered MediaUrl and MediaContentType fields
+func webhookMedia(data gotwilio.SMSWebhook) []chat.Media {
+	pairs := [][2]string{
+		{data.MediaUrl0, data.MediaContentType0},
+		{data.MediaUrl1, data.MediaContentType1},
+		{data.MediaUrl2, data.MediaContentType2},
+		{data.MediaUrl3, data.MediaContentType3},
+		{data.MediaUrl4, data.MediaContentType4},
+		{data.MediaUrl5, data.MediaContentType5},
+		{data.MediaUrl6, data.MediaContentType6},
+		{data.MediaUrl7, data.MediaContentType7},
+		{data.MediaUrl8, data.MediaContentType8},
+		{data.MediaUrl9, data.MediaContentType9},
+		{data.MediaUrl10, data.MediaContentType10},
+	}
+	var media []chat.Media
+	for _, pair := range pairs {
+		if pair[0] != "" {
+			media = append(media, chat.Media{URL: pair[0], ContentType: pair[1]})
+		}
+	}
+	return media
+}
@@ -0,0 +1,132 @@
+package svc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sfreiberg/gotwilio"
+)
+
+// TwilioContentClient generalizes access to Twilio Content API templates,
+// which are used for interactive WhatsApp messages
+type TwilioContentClient interface {
+	CreateContent(ContentTemplate) (string, error)
+	SendContent(string, string, string, map[string]string, string) (*gotwilio.SmsResponse, *gotwilio.Exception, error)
+}
+
+// ContentTemplate is the request body for creating a Twilio Content API template
+type ContentTemplate struct {
+	FriendlyName string                 `json:"friendly_name"`
+	Language     string                 `json:"language"`
+	Types        map[string]interface{} `json:"types"`
+}
+
+// ListPicker is the twilio/list-picker content type
+type ListPicker struct {
+	Body   string           `json:"body"`
+	Button string           `json:"button"`
+	Items  []ListPickerItem `json:"items"`
+}
+
+// ListPickerItem is a single item in a ListPicker
+type ListPickerItem struct {
+	ID          string `json:"id"`
+	Item        string `json:"item"`
+	Description string `json:"description,omitempty"`
+}
+
+// TwilioContent implements TwilioContentClient over HTTP
+type TwilioContent struct {
+	AccountSid string
+	AuthToken  string
+	BaseURL    string
+	ContentURL string
+	HTTPClient *http.Client
+}
+
+// NewTwilioContent is a constructor for TwilioContent structs
+func NewTwilioContent(accountSid, authToken string) *TwilioContent {
+	return &TwilioContent{
+		AccountSid: accountSid,
+		AuthToken:  authToken,
+		BaseURL:    "https://api.twilio.com/2010-04-01",
+		ContentURL: "https://content.twilio.com/v1",
+		HTTPClient: &http.Client{},
+	}
+}
+
+// CreateContent creates a content template and returns its SID
+func (c *TwilioContent) CreateContent(template ContentTemplate) (string, error) {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/Content", c.ContentURL), strings.NewReader(string(templateJSON)))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.AccountSid, c.AuthToken)
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Twilio Content API returned status %d: %s", res.StatusCode, string(body))
+	}
+
+	var content struct {
+		Sid string `json:"sid"`
+	}
+	err = json.Unmarshal(body, &content)
+	return content.Sid, err
+}
+
+// SendContent sends a message using a content template
+func (c *TwilioContent) SendContent(from, to, contentSid string, variables map[string]string, statusCallback string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	values := url.Values{}
+	values.Set("From", from)
+	values.Set("To", to)
+	values.Set("ContentSid", contentSid)
+	if len(variables) > 0 {
+		variablesJSON, _ := json.Marshal(variables)
+		values.Set("ContentVariables", string(variablesJSON))
+	}
+	if statusCallback != "" {
+		values.Set("StatusCallback", statusCallback)
+	}
+
+	req, _ := http.NewRequest(
+		"POST",
+		fmt.Sprintf("%s/Accounts/%s/Messages.json", c.BaseURL, c.AccountSid),
+		strings.NewReader(values.Encode()),
+	)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.AccountSid, c.AuthToken)
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusCreated {
+		exception := new(gotwilio.Exception)
+		err = json.Unmarshal(body, exception)
+		return nil, exception, err
+	}
+
+	smsResponse := new(gotwilio.SmsResponse)
+	err = json.Unmarshal(body, smsResponse)
+	return smsResponse, nil, err
+}
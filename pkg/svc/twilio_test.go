@@ -0,0 +1,91 @@
+package svc_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func TestNewTwilioChatChannel(t *testing.T) {
+	if svc.NewTwilioChat(nil, "+15555555555", "+15555555556").Channel != svc.SMSChannel {
+		t.Errorf("Phone number not using SMS channel")
+	}
+	if svc.NewTwilioChat(nil, "whatsapp:+15555555555", "whatsapp:+15555555556").Channel != svc.WhatsAppChannel {
+		t.Errorf("WhatsApp address not using WhatsApp channel")
+	}
+}
+
+func TestSendMessageWhatsAppSession(t *testing.T) {
+	client := &mocks.TwilioClientMock{}
+	content := &mocks.TwilioContentClientMock{}
+	twilioChat := svc.NewTwilioChat(client, "whatsapp:+15555555555", "whatsapp:+15555555556")
+	twilioChat.Content = content
+
+	expired := time.Now().Add(-svc.WhatsAppSessionWindow - time.Minute)
+	_, err := twilioChat.SendMessage(chat.Message{Body: "Test", SessionStart: &expired})
+	if err != svc.ErrOutsideSessionWindow {
+		t.Errorf("Free-form message sent outside of session window")
+	}
+
+	twilioChat.DefaultTemplate = &chat.Template{ID: "HX123"}
+	content.On("SendContent", mock.Anything, mock.Anything, "HX123", mock.Anything, mock.Anything)
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Test", SessionStart: &expired})
+	content.AssertCalled(t, "SendContent", "whatsapp:+15555555555", "whatsapp:+15555555556", "HX123", mock.Anything, "")
+	client.AssertNotCalled(t, "SendSMS", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSendMessageWhatsAppMenu(t *testing.T) {
+	client := &mocks.TwilioClientMock{}
+	content := &mocks.TwilioContentClientMock{}
+	twilioChat := svc.NewTwilioChat(client, "whatsapp:+15555555555", "whatsapp:+15555555556")
+	twilioChat.Content = content
+	now := time.Now()
+
+	content.On("CreateContent", mock.Anything).Return("HX456")
+	content.On("SendContent", mock.Anything, mock.Anything, "HX456", mock.Anything, mock.Anything)
+	menu := &chat.Menu{Prompt: "Pick one", Button: "Options", Options: []chat.Option{
+		chat.Option{Value: "0", Label: "All of these"},
+		chat.Option{Value: "1", Label: "Food"},
+	}}
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Pick one\n0 All\n1 Food", Menu: menu, SessionStart: &now})
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Pick one\n0 All\n1 Food", Menu: menu, SessionStart: &now})
+	content.AssertNumberOfCalls(t, "CreateContent", 1)
+	content.AssertNumberOfCalls(t, "SendContent", 2)
+
+	// Templates are created in the menu's language
+	spanish := &chat.Menu{Prompt: "Elija uno", Button: "Opciones", Language: "es", Options: menu.Options}
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Elija uno\n0 Todos\n1 Alimentos", Menu: spanish, SessionStart: &now})
+	content.AssertCalled(t, "CreateContent", mock.MatchedBy(func(template svc.ContentTemplate) bool {
+		return template.Language == "es"
+	}))
+
+	// Menus with too many options for a list are sent as text
+	for len(menu.Options) <= 10 {
+		menu.Options = append(menu.Options, chat.Option{Value: "2", Label: "Other"})
+	}
+	client.On("SendSMS", mock.Anything, mock.Anything, "Long menu", "", "")
+	_, _ = twilioChat.SendMessage(chat.Message{Body: "Long menu", Menu: menu, SessionStart: &now})
+	client.AssertCalled(t, "SendSMS", "whatsapp:+15555555555", "whatsapp:+15555555556", "Long menu", "", "")
+}
+
+func TestHandleWebhookValuesListReply(t *testing.T) {
+	twilioChat := svc.NewTwilioChat(nil, "whatsapp:+15555555555", "")
+	values := url.Values{
+		"MessageSid": []string{"SM123"},
+		"From":       []string{"whatsapp:+15555555556"},
+		"To":         []string{"whatsapp:+15555555555"},
+		"Body":       []string{"Food"},
+		"ListId":     []string{"2"},
+		"ListTitle":  []string{"Food"},
+	}
+	message, err := twilioChat.HandleWebhookValues(values)
+	if err != nil || message.Body != "2" || message.ID != "SM123" {
+		t.Errorf("List reply not using selected option as message body")
+	}
+}
@@ -0,0 +1,251 @@
+package svc
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+)
+
+// VonageProvider is the SMS provider name for Vonage
+const VonageProvider = "vonage"
+
+// Longer messages are split into more parts than Vonage recommends
+const maxVonageLen = 1600
+
+// Vonage delivery receipt statuses that differ from chat statuses
+var vonageStatuses = map[string]string{
+	"accepted": chat.StatusSent,
+	"buffered": chat.StatusSent,
+	"expired":  chat.StatusUndelivered,
+	"rejected": chat.StatusFailed,
+}
+
+// Vonage delivery receipt error codes for numbers that are permanently absent (3), contacts
+// who have barred messages (4) and invalid numbers (9)
+var vonageUnreachableErrorCodes = map[string]bool{
+	"3": true,
+	"4": true,
+	"9": true,
+}
+
+// VonageChat implements the chat.Provider interface for the Vonage SMS API
+type VonageChat struct {
+	APIKey    string
+	APISecret string
+	// Secret used to sign webhooks with the MD5 hash method
+	SignatureSecret string
+	From            string
+	BaseURL         string
+	HTTPClient      *http.Client
+}
+
+type vonageSendResponse struct {
+	MessageCount string `json:"message-count"`
+	Messages     []struct {
+		To        string `json:"to"`
+		MessageID string `json:"message-id"`
+		Status    string `json:"status"`
+		ErrorText string `json:"error-text"`
+	} `json:"messages"`
+}
+
+// NewVonageChat is a constructor for VonageChat structs
+func NewVonageChat(apiKey, apiSecret, signatureSecret, from string) *VonageChat {
+	return &VonageChat{
+		APIKey:          apiKey,
+		APISecret:       apiSecret,
+		SignatureSecret: signatureSecret,
+		From:            from,
+		BaseURL:         "https://rest.nexmo.com",
+		HTTPClient:      &http.Client{},
+	}
+}
+
+// Capabilities describes the Vonage SMS channel
+func (c *VonageChat) Capabilities() chat.Capabilities {
+	return chat.Capabilities{Channel: SMSChannel, MaxLength: maxVonageLen}
+}
+
+// VerifyWebhook checks the sig parameter of a signed webhook request
+func (c *VonageChat) VerifyWebhook(request chat.WebhookRequest) (bool, error) {
+	params, err := vonageParams(request)
+	if err != nil {
+		return false, err
+	}
+	if c.SignatureSecret == "" || params["sig"] == "" {
+		return false, nil
+	}
+	expected := VonageSignature(params, c.SignatureSecret)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(params["sig"]))), nil
+}
+
+// ParseWebhook converts an inbound message webhook request to a chat.Message
+func (c *VonageChat) ParseWebhook(request chat.WebhookRequest) ([]chat.Message, error) {
+	params, err := vonageParams(request)
+	if err != nil {
+		return []chat.Message{}, err
+	}
+	// Concatenated messages are delivered in parts, which aren't reassembled
+	createdAt := vonageTime(params["message-timestamp"])
+	return []chat.Message{{
+		ID:        params["messageId"],
+		Sender:    E164(params["msisdn"]),
+		Recipient: E164(params["to"]),
+		Body:      params["text"],
+		CreatedAt: &createdAt,
+	}}, nil
+}
+
+// WebhookResponse acknowledges webhooks, Vonage only checks the status code
+func (c *VonageChat) WebhookResponse() (string, string) {
+	return "", "text/plain"
+}
+
+// ParseStatusCallback converts a delivery receipt webhook request to a delivery status
+func (c *VonageChat) ParseStatusCallback(request chat.WebhookRequest) ([]chat.DeliveryStatus, error) {
+	params, err := vonageParams(request)
+	if err != nil {
+		return []chat.DeliveryStatus{}, err
+	}
+	status, ok := vonageStatuses[params["status"]]
+	if !ok {
+		status = params["status"]
+	}
+	errorCode := params["err-code"]
+	if errorCode == "0" {
+		errorCode = ""
+	}
+	createdAt := vonageTime(params["message-timestamp"])
+	return []chat.DeliveryStatus{{
+		MessageID:   params["messageId"],
+		Recipient:   E164(params["msisdn"]),
+		Status:      status,
+		ErrorCode:   errorCode,
+		Unreachable: vonageUnreachableErrorCodes[errorCode],
+		CreatedAt:   &createdAt,
+	}}, nil
+}
+
+// SendMessage sends a chat.Message through the SMS API, returning the message ID.
+// Media isn't supported, so URLs are included in the text
+func (c *VonageChat) SendMessage(message chat.Message) (string, error) {
+	text := message.Body
+	for _, media := range message.Media {
+		text += fmt.Sprintf("\n%s", media.URL)
+	}
+	values := url.Values{}
+	values.Set("api_key", c.APIKey)
+	values.Set("api_secret", c.APISecret)
+	values.Set("from", strings.TrimPrefix(c.From, "+"))
+	values.Set("to", strings.TrimPrefix(message.Recipient, "+"))
+	values.Set("text", text)
+	if !isASCII(text) {
+		values.Set("type", "unicode")
+	}
+
+	res, err := c.HTTPClient.PostForm(fmt.Sprintf("%s/sms/json", c.BaseURL), values)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var sendRes vonageSendResponse
+	if err := json.Unmarshal(body, &sendRes); err != nil {
+		return "", err
+	}
+	if len(sendRes.Messages) == 0 {
+		return "", fmt.Errorf("Vonage returned status %d without messages", res.StatusCode)
+	}
+	// Each part of a concatenated message has its own ID, the first is used for the message
+	for _, part := range sendRes.Messages {
+		if part.Status != "0" {
+			return "", &chat.SendError{Code: part.Status, Message: part.ErrorText}
+		}
+	}
+	return sendRes.Messages[0].MessageID, nil
+}
+
+// VonageSignature returns the MD5 hash signature for webhook parameters, which is
+// the sorted parameters joined as &key=value followed by the signature secret
+func VonageSignature(params map[string]string, secret string) string {
+	keys := []string{}
+	for key := range params {
+		if key != "sig" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Vonage replaces & and = in values so they can't be confused with separators
+	replacer := strings.NewReplacer("&", "_", "=", "_")
+	var signed strings.Builder
+	for _, key := range keys {
+		signed.WriteString(fmt.Sprintf("&%s=%s", key, replacer.Replace(params[key])))
+	}
+	signed.WriteString(secret)
+	hash := md5.Sum([]byte(signed.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// Vonage sends webhooks as query parameters, form values or JSON depending on
+// configuration, so all are merged into one map
+func vonageParams(request chat.WebhookRequest) (map[string]string, error) {
+	params := map[string]string{}
+	for key := range request.Query {
+		params[key] = request.Query.Get(key)
+	}
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		return params, nil
+	}
+	if strings.HasPrefix(body, "{") {
+		var jsonParams map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &jsonParams); err != nil {
+			return params, err
+		}
+		for key, value := range jsonParams {
+			params[key] = fmt.Sprint(value)
+		}
+		return params, nil
+	}
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return params, err
+	}
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	return params, nil
+}
+
+// Vonage timestamps are UTC in the format 2020-01-01 12:00:00
+func vonageTime(value string) time.Time {
+	parsed, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		return time.Now()
+	}
+	return parsed
+}
+
+func isASCII(text string) bool {
+	for _, r := range text {
+		if r > 127 {
+			return false
+		}
+	}
+	return true
+}
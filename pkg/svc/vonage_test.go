@@ -0,0 +1,101 @@
+package svc_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/City-Bureau/chicovidchat/pkg/chat"
+	"github.com/City-Bureau/chicovidchat/pkg/mocks"
+	"github.com/City-Bureau/chicovidchat/pkg/svc"
+)
+
+func vonageInboundParams() map[string]string {
+	return map[string]string{
+		"msisdn":            "15555555556",
+		"to":                "15555555555",
+		"messageId":         "0A0000000123ABCD1",
+		"text":              "Food & drink",
+		"type":              "text",
+		"message-timestamp": "2020-05-01 12:00:00",
+		"timestamp":         "1588334400",
+	}
+}
+
+func TestVonageVerifyWebhook(t *testing.T) {
+	vonageChat := svc.NewVonageChat("key", "secret", "signing", "+15555555555")
+	params := vonageInboundParams()
+	params["sig"] = svc.VonageSignature(params, "signing")
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	if isValid, err := vonageChat.VerifyWebhook(chat.WebhookRequest{Query: query}); err != nil || !isValid {
+		t.Errorf("Valid signature in query not accepted")
+	}
+	if isValid, _ := vonageChat.VerifyWebhook(chat.WebhookRequest{Body: query.Encode()}); !isValid {
+		t.Errorf("Valid signature in form body not accepted")
+	}
+	query.Set("text", "Changed")
+	if isValid, _ := vonageChat.VerifyWebhook(chat.WebhookRequest{Query: query}); isValid {
+		t.Errorf("Signature accepted for modified parameters")
+	}
+}
+
+func TestVonageParseWebhook(t *testing.T) {
+	vonageChat := svc.NewVonageChat("key", "secret", "signing", "+15555555555")
+	body := `{"msisdn": "15555555556", "to": "15555555555", "messageId": "0A0000000123ABCD1", "text": "Food", "type": "text"}`
+	messages, err := vonageChat.ParseWebhook(chat.WebhookRequest{Body: body})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("JSON webhook not parsed")
+	}
+	if messages[0].Sender != "+15555555556" || messages[0].Recipient != "+15555555555" || messages[0].Body != "Food" {
+		t.Errorf("Inbound message not converted with E.164 numbers")
+	}
+
+	statuses, err := vonageChat.ParseStatusCallback(chat.WebhookRequest{Query: url.Values{
+		"msisdn":    []string{"15555555556"},
+		"messageId": []string{"vonage-1"},
+		"status":    []string{"expired"},
+		"err-code":  []string{"5"},
+	}})
+	if err != nil || statuses[0].Status != chat.StatusUndelivered || statuses[0].ErrorCode != "5" || statuses[0].Unreachable {
+		t.Errorf("Delivery receipt not converted to undelivered status")
+	}
+
+	statuses, _ = vonageChat.ParseStatusCallback(chat.WebhookRequest{Query: url.Values{
+		"msisdn":    []string{"15555555556"},
+		"messageId": []string{"vonage-2"},
+		"status":    []string{"failed"},
+		"err-code":  []string{"4"},
+	}})
+	if !statuses[0].Unreachable {
+		t.Errorf("Barred recipient not marked unreachable")
+	}
+}
+
+func TestVonageSendMessage(t *testing.T) {
+	vonageAPI := mocks.NewVonageAPI("key", "secret")
+	defer vonageAPI.Close()
+
+	vonageChat := svc.NewVonageChat("key", "secret", "signing", "+15555555555")
+	vonageChat.BaseURL = vonageAPI.URL()
+	messageID, err := vonageChat.SendMessage(chat.Message{
+		Recipient: "+15555555556",
+		Body:      "Información",
+		Media:     []chat.Media{{URL: "https://example.com/card.vcf"}},
+	})
+	if err != nil || messageID != "vonage-1" {
+		t.Fatalf("Message not sent to SMS API: %v", err)
+	}
+	sent := vonageAPI.Requests[0]
+	if sent.Get("to") != "15555555556" || sent.Get("type") != "unicode" || sent.Get("text") != "Información\nhttps://example.com/card.vcf" {
+		t.Errorf("Message not sent as unicode with media URLs in text")
+	}
+
+	vonageChat.APISecret = "invalid"
+	_, err = vonageChat.SendMessage(chat.Message{Recipient: "+15555555556", Body: "Test"})
+	if sendErr, ok := err.(*chat.SendError); !ok || sendErr.Code != "4" {
+		t.Errorf("SMS API error status not returned as SendError")
+	}
+}
@@ -0,0 +1,34 @@
+package svc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// WebChannel is the channel name for the website chat widget
+const WebChannel = "web"
+
+const webPrefix = "web:"
+
+// NewWebSessionToken generates a random token identifying a web chat session
+func NewWebSessionToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+// WebAddress returns the address for a web chat session. Tokens are hashed so
+// that they can't be used to access a session if the database is exposed
+func WebAddress(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return webPrefix + hex.EncodeToString(hash[:])
+}
+
+// IsWebAddress returns whether an address belongs to a web chat session
+func IsWebAddress(address string) bool {
+	return strings.HasPrefix(address, webPrefix)
+}